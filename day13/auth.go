@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt only uses the first 72 bytes of a password
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// tokenTTL is how long a token from POST /tokens lasts
+var tokenTTL = 30 * 24 * time.Hour
+
+// passwordCost is the bcrypt cost of the new passwords, the tests lower it
+var passwordCost = bcrypt.DefaultCost
+
+// contextKey keys the values a request carries
+type contextKey int
+
+// userKey carries the authenticated user
+const userKey contextKey = 0
+
+// unknownUser is compared when the user does not exist, so a login
+// takes as long for a missing user as for a wrong password
+var unknownUser, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+
+// credentials is the body of POST /users and POST /tokens
+type credentials struct {
+	Name     string `json:"name" valid:"alphanum,required"`
+	Password string `json:"password" valid:"required"`
+}
+
+// session is a token handed out by POST /tokens
+type session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// hashToken is how a token is kept, only the client has it in clear
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearer returns the token of the Authorization header, empty when there's none
+func bearer(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	return ""
+}
+
+// public tells if a request is allowed without a token
+func public(r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		switch r.URL.Path {
+		case "/openapi.json", "/healthz", "/readyz":
+			return true
+		}
+	}
+	return r.Method == http.MethodPost && (r.URL.Path == "/users" || r.URL.Path == "/tokens")
+}
+
+// identify is a middleware that passes the user of the token on to the
+// handlers. It does not reject anything, so the limiter that runs next
+// also counts the requests authenticate rejects
+func identify(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	token := bearer(r)
+	if token == "" {
+		next(w, r)
+		return
+	}
+	user, err := db.TokenUser(hashToken(token))
+	switch err {
+	case nil:
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	case database.ErrTokenNotFound:
+		next(w, r)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// authenticate is a middleware that rejects the requests identify
+// found no user for, unless they are public
+func authenticate(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	switch {
+	case public(r) || currentUser(r) != nil:
+		next(w, r)
+	case bearer(r) == "":
+		unauthorized(w, "missing bearer token")
+	default:
+		unauthorized(w, database.ErrTokenNotFound.Error())
+	}
+}
+
+// unauthorized tells the client to authenticate
+func unauthorized(w http.ResponseWriter, reason string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="cards"`)
+	// STATUS 401 - UNAUTHORIZED
+	renderProblem(w, reason, http.StatusUnauthorized)
+}
+
+// currentUser is the user authenticated by the middleware
+func currentUser(r *http.Request) *cards.User {
+	user, _ := r.Context().Value(userKey).(*cards.User)
+	return user
+}
+
+// store is the view of the database for the user of the request,
+// it only sees the things of the user and records the changes as made by them
+func store(r *http.Request) database.Database {
+	user := currentUser(r)
+	return db.For(user.ID).As(user.Name)
+}
+
+// userScope keeps apart the idempotency keys of each user, the public
+// routes share the keys of no user
+func userScope(r *http.Request) string {
+	if user := currentUser(r); user != nil {
+		return strconv.FormatInt(user.ID, 10)
+	}
+	return "0"
+}
+
+// readCredentials decodes and validates the body, rendering the error
+func readCredentials(w http.ResponseWriter, r *http.Request) (*credentials, bool) {
+	c := credentials{}
+	err := json.NewDecoder(r.Body).Decode(&c)
+	defer r.Body.Close()
+	if err != nil {
+		// STATUS 422 - Unprocessable entity
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	if _, err = valid.ValidateStruct(c); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return nil, false
+	}
+	return &c, true
+}
+
+// signup creates a user
+func signup(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCredentials(w, r)
+	if !ok {
+		return
+	}
+	if len(c.Password) < minPasswordLength || len(c.Password) > maxPasswordLength {
+		renderProblem(w, "password must have from 8 to 72 bytes", http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(c.Password), passwordCost)
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	account := &database.Account{User: cards.User{Name: c.Name}, PasswordHash: hash}
+	switch err = db.CreateUser(account); err {
+	case nil:
+		RenderJSON(w, account.User, http.StatusCreated)
+	case database.ErrUserExists:
+		// STATUS 409 - CONFLICT
+		renderError(w, err, http.StatusConflict)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// login hands out a token for the name and password
+func login(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCredentials(w, r)
+	if !ok {
+		return
+	}
+	account, err := db.GetAccount(c.Name)
+	if err == database.ErrUserNotFound {
+		bcrypt.CompareHashAndPassword(unknownUser, []byte(c.Password))
+		unauthorized(w, "wrong name or password")
+		return
+	}
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(c.Password)) != nil {
+		unauthorized(w, "wrong name or password")
+		return
+	}
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s := session{Token: hex.EncodeToString(random), ExpiresAt: time.Now().Add(tokenTTL).UTC()}
+	if err = db.CreateToken(account.ID, hashToken(s.Token), s.ExpiresAt); err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, s, http.StatusCreated)
+}
+
+// logout revokes the token of the request
+func logout(w http.ResponseWriter, r *http.Request) {
+	if err := db.RemoveToken(hashToken(bearer(r))); err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// me returns the authenticated user
+func me(w http.ResponseWriter, r *http.Request) {
+	RenderJSON(w, currentUser(r), http.StatusOK)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/patch"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+)
+
+// maxBatch is how many operations a batch can have
+const maxBatch = 1000
+
+// operations of a batch
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opPatch  = "patch"
+	opDelete = "delete"
+)
+
+// errBatchFailed rolls back a batch where an operation failed
+var errBatchFailed = errors.New("batch failed")
+
+// batchOperation is an operation of POST /cards/batch. Version plays
+// the role of If-Match and Patch is a merge patch when it's an object
+// and a JSON Patch when it's an array
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version int64           `json:"version"`
+	Card    *cards.Card     `json:"card"`
+	Patch   json.RawMessage `json:"patch"`
+}
+
+// batchRequest is the body of POST /cards/batch. The operations are
+// all or nothing, unless BestEffort keeps the ones that succeed
+type batchRequest struct {
+	BestEffort bool             `json:"best_effort"`
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchResult is the outcome of an operation, in the order they were
+// sent. Error is the problem of an operation that failed
+type batchResult struct {
+	Status int         `json:"status"`
+	Card   *cards.Card `json:"card,omitempty"`
+	Error  *problem    `json:"error,omitempty"`
+}
+
+// batchResponse is the body of a batch that was kept
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// batchProblem is the problem of a batch that was rolled back
+type batchProblem struct {
+	problem
+	Results []batchResult `json:"results"`
+}
+
+// failed is the result of an operation that did not happen
+func failed(status int, err error) batchResult {
+	p := errorProblem(err, status)
+	return batchResult{Status: status, Error: &p}
+}
+
+// ok tells if the operation succeeded
+func (b batchResult) ok() bool {
+	return b.Status < http.StatusBadRequest
+}
+
+// check validates an operation before running any of them,
+// returning the result of the operation when it's invalid
+func (op *batchOperation) check() *batchResult {
+	var result batchResult
+	switch {
+	case op.Op != opCreate && op.Op != opUpdate && op.Op != opPatch && op.Op != opDelete:
+		result = failed(http.StatusBadRequest, fmt.Errorf("op must be create, update, patch or delete"))
+	case op.Op != opCreate && op.ID < 1:
+		result = failed(http.StatusBadRequest, fmt.Errorf("id is required"))
+	case op.Op != opCreate && op.Version == 0 && requireIfMatch:
+		// STATUS 428 - PRECONDITION REQUIRED
+		result = failed(http.StatusPreconditionRequired, fmt.Errorf("version is required"))
+	case (op.Op == opCreate || op.Op == opUpdate) && op.Card == nil:
+		result = failed(http.StatusBadRequest, fmt.Errorf("card is required"))
+	case op.Op == opPatch && len(op.Patch) == 0:
+		result = failed(http.StatusBadRequest, fmt.Errorf("patch is required"))
+	case op.Card != nil:
+		if _, err := valid.ValidateStruct(op.Card); err != nil {
+			result = failed(http.StatusBadRequest, err)
+		} else if err = validDates(op.Card); err != nil {
+			result = failed(http.StatusBadRequest, err)
+		} else {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &result
+}
+
+// run runs an operation on view, the events of the changes are
+// appended to published, to be sent once the changes are kept
+func (op *batchOperation) run(view database.Database, published *[]func()) batchResult {
+	switch op.Op {
+	case opCreate:
+		card := *op.Card
+		switch err := view.CreateCard(&card); err {
+		case nil:
+			*published = append(*published, func() { publish(webhook.EventCreated, &card) })
+			return batchResult{Status: http.StatusCreated, Card: &card}
+		case database.ErrListNotFound:
+			return failed(http.StatusUnprocessableEntity, err)
+		default:
+			return failed(http.StatusInternalServerError, err)
+		}
+	case opUpdate:
+		card := *op.Card
+		card.ID, card.Version = op.ID, op.Version
+		before, _ := view.GetCard(op.ID)
+		updated, err := view.UpdateCard(&card)
+		switch err {
+		case nil:
+			*published = append(*published, func() { publishUpdate(before, updated) })
+			return batchResult{Status: http.StatusOK, Card: updated}
+		case database.ErrCardNotFound:
+			return failed(http.StatusNotFound, err)
+		case database.ErrVersionMismatch:
+			return failed(http.StatusPreconditionFailed, err)
+		default:
+			return failed(http.StatusInternalServerError, err)
+		}
+	case opPatch:
+		apply := patch.MergePatch
+		if op.Patch[0] == '[' {
+			apply = patch.JSONPatch
+		}
+		before, updated, status, err := patchCard(view, op.ID, op.Version, apply, op.Patch)
+		if err != nil {
+			return failed(status, err)
+		}
+		*published = append(*published, func() { publishUpdate(before, updated) })
+		return batchResult{Status: status, Card: updated}
+	default:
+		removed, err := view.GetCard(op.ID)
+		if err != nil {
+			removed = &cards.Card{ID: op.ID}
+		}
+		switch err = view.RemoveCard(op.ID, op.Version); err {
+		case nil:
+			*published = append(*published, func() { publish(webhook.EventDeleted, removed) })
+			return batchResult{Status: http.StatusNoContent}
+		case database.ErrCardNotFound:
+			return failed(http.StatusNotFound, err)
+		case database.ErrVersionMismatch:
+			return failed(http.StatusPreconditionFailed, err)
+		default:
+			return failed(http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// batchCards runs many operations on cards at once. By default they
+// run in a transaction and, when one fails, none is kept and the
+// others answer 424. With best_effort each one is kept on its own
+func batchCards(w http.ResponseWriter, r *http.Request) {
+	batch := batchRequest{}
+	err := json.NewDecoder(r.Body).Decode(&batch)
+	defer r.Body.Close()
+	if err != nil {
+		// STATUS 422 - Unprocessable entity
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if len(batch.Operations) == 0 || len(batch.Operations) > maxBatch {
+		renderProblem(w, fmt.Sprintf("a batch must have from 1 to %d operations", maxBatch), http.StatusBadRequest)
+		return
+	}
+	results := make([]batchResult, len(batch.Operations))
+	succeeded := true
+	for i := range batch.Operations {
+		if result := batch.Operations[i].check(); result != nil {
+			results[i] = *result
+			succeeded = false
+		}
+	}
+	published := []func(){}
+	if batch.BestEffort {
+		// invalid operations are skipped
+		for i := range batch.Operations {
+			if results[i].Status == 0 {
+				results[i] = batch.Operations[i].run(store(r), &published)
+			}
+		}
+		succeeded = true
+	} else if succeeded {
+		err = store(r).Batch(func(tx database.Database) error {
+			for i := range batch.Operations {
+				if results[i] = batch.Operations[i].run(tx, &published); !results[i].ok() {
+					return errBatchFailed
+				}
+			}
+			return nil
+		})
+		if err != nil && err != errBatchFailed {
+			renderError(w, err, http.StatusInternalServerError)
+			return
+		}
+		succeeded = err == nil
+	}
+	if !succeeded {
+		// STATUS 424 - FAILED DEPENDENCY
+		for i := range results {
+			if results[i].Status == 0 || results[i].ok() {
+				results[i] = failed(http.StatusFailedDependency, errBatchFailed)
+			}
+		}
+		writeProblem(w, batchProblem{
+			problem: newProblem("an operation failed, none was kept", http.StatusUnprocessableEntity),
+			Results: results,
+		}, http.StatusUnprocessableEntity)
+		return
+	}
+	RenderJSON(w, batchResponse{Results: results}, http.StatusOK)
+	for _, event := range published {
+		event()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestBatchCards(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		body    string
+		status  int
+		results []int
+		// cards is how many cards are kept
+		cards int
+		// invalid is the name of the invalid param of the first failed result
+		invalid string
+	}{
+		{
+			name:    "all kept",
+			body:    `{"operations":[{"op":"create","card":{"title":"a","text":"text"}},{"op":"patch","id":1,"patch":{"done":true}},{"op":"delete","id":1,"version":2}]}`,
+			status:  http.StatusOK,
+			results: []int{http.StatusCreated, http.StatusOK, http.StatusNoContent},
+		},
+		{
+			name:    "rolled back",
+			body:    `{"operations":[{"op":"create","card":{"title":"a","text":"text"}},{"op":"update","id":7,"card":{"title":"b","text":"text"}}]}`,
+			status:  http.StatusUnprocessableEntity,
+			results: []int{http.StatusFailedDependency, http.StatusNotFound},
+		},
+		{
+			name:    "version mismatch",
+			body:    `{"operations":[{"op":"create","card":{"title":"a","text":"text"}},{"op":"patch","id":1,"version":5,"patch":{"done":true}}]}`,
+			status:  http.StatusUnprocessableEntity,
+			results: []int{http.StatusFailedDependency, http.StatusPreconditionFailed},
+		},
+		{
+			name:    "invalid operation",
+			body:    `{"operations":[{"op":"create","card":{"title":"a","text":"text"}},{"op":"create","card":{"title":"b","text":"text","due_at":"2030-01-01T00:00:00Z","remind_at":"2030-01-02T00:00:00Z"}}]}`,
+			status:  http.StatusUnprocessableEntity,
+			results: []int{http.StatusFailedDependency, http.StatusBadRequest},
+			invalid: "remind_at",
+		},
+		{
+			name:    "best effort",
+			body:    `{"best_effort":true,"operations":[{"op":"create","card":{"title":"a","text":"text"}},{"op":"delete","id":7},{"op":"create","card":{"title":"c","text":"text","due_at":"2030-01-01T00:00:00Z","remind_at":"2030-01-02T00:00:00Z"}},{"op":"create","card":{"title":"b","text":"text"}}]}`,
+			status:  http.StatusOK,
+			results: []int{http.StatusCreated, http.StatusNotFound, http.StatusBadRequest, http.StatusCreated},
+			cards:   2,
+			invalid: "remind_at",
+		},
+		{
+			name:   "empty",
+			body:   `{"operations":[]}`,
+			status: http.StatusBadRequest,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := testServer(t)
+			token := testToken(t, server, "alice")
+			resp, content := call(t, server, token, http.MethodPost, "/cards/batch", test.body)
+			if resp.StatusCode != test.status {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, content)
+			}
+			body := batchProblem{}
+			if err := json.Unmarshal(content, &body); err != nil {
+				t.Fatal(err)
+			}
+			var statuses []int
+			for i, result := range body.Results {
+				statuses = append(statuses, result.Status)
+				if result.ok() {
+					continue
+				}
+				// every failure is a problem
+				if p := result.Error; p == nil || p.Status != result.Status || p.Title != http.StatusText(result.Status) || p.Type != "about:blank" {
+					t.Errorf("result %d: error = %+v", i, p)
+				}
+			}
+			if fmt.Sprint(statuses) != fmt.Sprint(test.results) {
+				t.Errorf("results = %v, want %v", statuses, test.results)
+			}
+			if test.invalid != "" {
+				for _, result := range body.Results {
+					if result.Status == http.StatusBadRequest && (len(result.Error.InvalidParams) != 1 || result.Error.InvalidParams[0].Name != test.invalid) {
+						t.Errorf("error = %+v", result.Error)
+					}
+				}
+			}
+			_, content = call(t, server, token, http.MethodGet, "/cards", "")
+			page := cardPage{}
+			if err := json.Unmarshal(content, &page); err != nil || len(page.Cards) != test.cards {
+				t.Errorf("cards = %s", content)
+			}
+		})
+	}
+}
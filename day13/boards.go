@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+	"github.com/gorilla/mux"
+)
+
+// renderBoardError maps the errors of boards and lists to a status
+func renderBoardError(w http.ResponseWriter, err error) {
+	switch err {
+	case database.ErrBoardNotFound, database.ErrListNotFound, database.ErrCardNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case database.ErrBoardNotEmpty, database.ErrListNotEmpty:
+		// STATUS 409 - CONFLICT
+		renderError(w, err, http.StatusConflict)
+	case database.ErrVersionMismatch:
+		renderError(w, err, http.StatusPreconditionFailed)
+	case errInvalidID:
+		renderError(w, err, http.StatusBadRequest)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// boardList reads the list in path, only when it belongs to the board in path
+func boardList(r *http.Request) (*cards.List, error) {
+	vars := mux.Vars(r)
+	boardID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		return nil, errInvalidID
+	}
+	id, err := strconv.ParseInt(vars["list"], 10, 64)
+	if err != nil {
+		return nil, errInvalidID
+	}
+	list, err := store(r).GetList(id)
+	if err != nil {
+		return nil, err
+	}
+	if list.BoardID != boardID {
+		return nil, database.ErrListNotFound
+	}
+	return list, nil
+}
+
+func createBoard(w http.ResponseWriter, r *http.Request) {
+	board := cards.Board{}
+	err := json.NewDecoder(r.Body).Decode(&board)
+	defer r.Body.Close()
+	if err != nil {
+		// STATUS 422 - Unprocessable entity
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if _, err = valid.ValidateStruct(board); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err = store(r).CreateBoard(&board); err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, board, http.StatusCreated)
+}
+
+func allBoards(w http.ResponseWriter, r *http.Request) {
+	boards, err := store(r).AllBoards()
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, boards, http.StatusOK)
+}
+
+func getBoard(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	board, err := store(r).GetBoard(id)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	RenderJSON(w, board, http.StatusOK)
+}
+
+func updateBoard(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	board := cards.Board{}
+	err = json.NewDecoder(r.Body).Decode(&board)
+	defer r.Body.Close()
+	if err != nil {
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if _, err = valid.ValidateStruct(board); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	board.ID = id
+	updated, err := store(r).UpdateBoard(&board)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	RenderJSON(w, updated, http.StatusOK)
+}
+
+func deleteBoard(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	if err = store(r).RemoveBoard(id); err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func createList(w http.ResponseWriter, r *http.Request) {
+	// Get the board from path
+	vars := mux.Vars(r)
+	boardID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	list := cards.List{}
+	err = json.NewDecoder(r.Body).Decode(&list)
+	defer r.Body.Close()
+	if err != nil {
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if _, err = valid.ValidateStruct(list); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	list.BoardID = boardID
+	if err = store(r).CreateList(&list); err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	RenderJSON(w, list, http.StatusCreated)
+}
+
+func boardLists(w http.ResponseWriter, r *http.Request) {
+	// Get the board from path
+	vars := mux.Vars(r)
+	boardID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	lists, err := store(r).BoardLists(boardID)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	RenderJSON(w, lists, http.StatusOK)
+}
+
+func getList(w http.ResponseWriter, r *http.Request) {
+	list, err := boardList(r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	RenderJSON(w, list, http.StatusOK)
+}
+
+// updateList renames a list or, with a position, moves it inside the board
+func updateList(w http.ResponseWriter, r *http.Request) {
+	list, err := boardList(r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	new := cards.List{}
+	err = json.NewDecoder(r.Body).Decode(&new)
+	defer r.Body.Close()
+	if err != nil {
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	new.ID = list.ID
+	updated, err := store(r).UpdateList(&new)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	RenderJSON(w, updated, http.StatusOK)
+}
+
+func deleteList(w http.ResponseWriter, r *http.Request) {
+	list, err := boardList(r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	if err = store(r).RemoveList(list.ID); err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// move is the body of POST /cards/{id}/move
+type move struct {
+	ListID int64 `json:"list_id"`
+	// Index is where the card goes in the list, the end when omitted
+	Index *int `json:"index"`
+}
+
+func moveCard(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	m := move{}
+	err = json.NewDecoder(r.Body).Decode(&m)
+	defer r.Body.Close()
+	if err != nil {
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	index := math.MaxInt32
+	if m.Index != nil {
+		index = *m.Index
+	}
+	version, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	card, err := store(r).MoveCard(id, m.ListID, index, version)
+	switch err {
+	case database.ErrListNotFound:
+		renderError(w, err, http.StatusUnprocessableEntity)
+	case nil:
+		setETag(w, card)
+		RenderJSON(w, card, http.StatusOK)
+		publish(webhook.EventUpdated, card)
+	default:
+		renderBoardError(w, err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+func TestBoards(t *testing.T) {
+	server := testServer(t)
+	alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+	// each step runs on what the ones before it left
+	for _, test := range []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		status int
+		// result is a part expected in the body
+		result string
+	}{
+		{"create a board", alice, http.MethodPost, "/boards", `{"name":"work"}`, http.StatusCreated, `"id":1`},
+		{"create a board without name", alice, http.MethodPost, "/boards", `{}`, http.StatusBadRequest, `"name":"name"`},
+		{"create a broken board", alice, http.MethodPost, "/boards", `{"name":`, http.StatusUnprocessableEntity, ""},
+		{"get a board", alice, http.MethodGet, "/boards/1", "", http.StatusOK, `"name":"work"`},
+		{"get a board of another user", bob, http.MethodGet, "/boards/1", "", http.StatusNotFound, ""},
+		{"list the boards of another user", bob, http.MethodGet, "/boards", "", http.StatusOK, `[]`},
+		{"rename a board", alice, http.MethodPut, "/boards/1", `{"name":"job"}`, http.StatusOK, `"name":"job"`},
+		{"rename a board of another user", bob, http.MethodPut, "/boards/1", `{"name":"mine"}`, http.StatusNotFound, ""},
+		{"create a list", alice, http.MethodPost, "/boards/1/lists", `{"name":"todo"}`, http.StatusCreated, `"position":1`},
+		{"create a second list", alice, http.MethodPost, "/boards/1/lists", `{"name":"done"}`, http.StatusCreated, `"position":2`},
+		{"create a list without name", alice, http.MethodPost, "/boards/1/lists", `{}`, http.StatusBadRequest, ""},
+		{"create a list in an unknown board", alice, http.MethodPost, "/boards/9/lists", `{"name":"todo"}`, http.StatusNotFound, ""},
+		{"create a list in a board of another user", bob, http.MethodPost, "/boards/1/lists", `{"name":"todo"}`, http.StatusNotFound, ""},
+		{"get a list", alice, http.MethodGet, "/boards/1/lists/2", "", http.StatusOK, `"name":"done"`},
+		{"get a list of another board", alice, http.MethodGet, "/boards/2/lists/2", "", http.StatusNotFound, ""},
+		{"move a list first", alice, http.MethodPut, "/boards/1/lists/2", `{"name":"done","position":0.5}`, http.StatusOK, `"position":0.5`},
+		{"lists by position", alice, http.MethodGet, "/boards/1/lists", "", http.StatusOK, `"name":"done","board_id":1,"position":0.5,"id":2},{"name":"todo"`},
+		{"delete a board with lists", alice, http.MethodDelete, "/boards/1", "", http.StatusConflict, ""},
+		{"delete a list", alice, http.MethodDelete, "/boards/1/lists/1", "", http.StatusNoContent, ""},
+		{"delete a deleted list", alice, http.MethodDelete, "/boards/1/lists/1", "", http.StatusNotFound, ""},
+		{"delete the last list", alice, http.MethodDelete, "/boards/1/lists/2", "", http.StatusNoContent, ""},
+		{"delete an empty board", alice, http.MethodDelete, "/boards/1", "", http.StatusNoContent, ""},
+		{"no boards left", alice, http.MethodGet, "/boards", "", http.StatusOK, `[]`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := call(t, server, test.token, test.method, test.path, test.body)
+			if resp.StatusCode != test.status || !strings.Contains(string(body), test.result) {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			if test.status >= http.StatusBadRequest && resp.Header.Get("Content-Type") != problemType {
+				t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+// listOrder returns the titles of the cards of a list by position
+func listOrder(t *testing.T, server *httptest.Server, token, listID string) string {
+	t.Helper()
+	return strings.Join(listTitles(t, server, token, "/cards?sort=position&limit=100&list_id="+listID), "|")
+}
+
+func TestMoveCard(t *testing.T) {
+	server := testServer(t)
+	alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+	call(t, server, alice, http.MethodPost, "/boards", `{"name":"work"}`)
+	call(t, server, alice, http.MethodPost, "/boards/1/lists", `{"name":"todo"}`)
+	call(t, server, alice, http.MethodPost, "/boards/1/lists", `{"name":"done"}`)
+	createCards(t, server, alice, "a", "b", "c")
+	createCards(t, server, bob, "d")
+
+	for _, test := range []struct {
+		name    string
+		token   string
+		path    string
+		body    string
+		ifMatch string
+		status  int
+		// todo and done are the titles of each list after the move
+		todo, done string
+	}{
+		{"to the end", alice, "/cards/1/move", `{"list_id":1}`, "", http.StatusOK, "a", ""},
+		{"to the end again", alice, "/cards/2/move", `{"list_id":1}`, "", http.StatusOK, "a b", ""},
+		{"to the start", alice, "/cards/3/move", `{"list_id":1,"index":0}`, "", http.StatusOK, "c a b", ""},
+		{"between two cards", alice, "/cards/2/move", `{"list_id":1,"index":1}`, "", http.StatusOK, "c b a", ""},
+		{"past the end", alice, "/cards/3/move", `{"list_id":1,"index":99}`, "", http.StatusOK, "b a c", ""},
+		{"to another list", alice, "/cards/1/move", `{"list_id":2}`, `"2"`, http.StatusOK, "b c", "a"},
+		{"of a stale version", alice, "/cards/1/move", `{"list_id":1}`, `"2"`, http.StatusPreconditionFailed, "b c", "a"},
+		{"to an unknown list", alice, "/cards/1/move", `{"list_id":9}`, "", http.StatusUnprocessableEntity, "b c", "a"},
+		{"of a card of another user", bob, "/cards/1/move", `{"list_id":1}`, "", http.StatusNotFound, "b c", "a"},
+		{"to a list of another user", bob, "/cards/4/move", `{"list_id":1}`, "", http.StatusUnprocessableEntity, "b c", "a"},
+		{"of an unknown card", alice, "/cards/9/move", `{"list_id":1}`, "", http.StatusNotFound, "b c", "a"},
+		{"broken", alice, "/cards/1/move", `{"list_id":`, "", http.StatusUnprocessableEntity, "b c", "a"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var headers []string
+			if test.ifMatch != "" {
+				headers = []string{"If-Match", test.ifMatch}
+			}
+			resp, body := call(t, server, test.token, http.MethodPost, test.path, test.body, headers...)
+			if resp.StatusCode != test.status {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			if todo, done := listOrder(t, server, alice, "1"), listOrder(t, server, alice, "2"); todo != test.todo || done != test.done {
+				t.Errorf("expected %q and %q but %q and %q were obtained", test.todo, test.done, todo, done)
+			}
+		})
+	}
+
+	// a list with cards can not be deleted
+	if resp, body := call(t, server, alice, http.MethodDelete, "/boards/1/lists/2", ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+	}
+}
+
+func TestMoveCardStableOrder(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	call(t, server, token, http.MethodPost, "/boards", `{"name":"work"}`)
+	call(t, server, token, http.MethodPost, "/boards/1/lists", `{"name":"todo"}`)
+	createCards(t, server, token, "a", "b", "c")
+	for _, id := range []string{"1", "2", "3"} {
+		call(t, server, token, http.MethodPost, "/cards/"+id+"/move", `{"list_id":1}`)
+	}
+	// the card moved between a and the card before the last one halves
+	// the gap every time, until there's no room and the list is renumbered
+	want := []string{"a"}
+	for i := 0; i < 60; i++ {
+		title := "n" + strconv.Itoa(i)
+		createCards(t, server, token, title)
+		resp, body := call(t, server, token, http.MethodPost, "/cards/"+strconv.Itoa(4+i)+"/move", `{"list_id":1,"index":1}`)
+		card := cards.Card{}
+		if err := json.Unmarshal(body, &card); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+		}
+		want = append(want[:1], append([]string{title}, want[1:]...)...)
+	}
+	want = append(want, "b", "c")
+	if order := listOrder(t, server, token, "1"); order != strings.Join(want, " ") {
+		t.Errorf("expected %q but %q was obtained", strings.Join(want, " "), order)
+	}
+	// b was renumbered, the tag of its move is stale
+	resp, body := call(t, server, token, http.MethodPut, "/cards/2", `{"title":"b","text":"stale"}`, "If-Match", `"2"`)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,18 @@
+package cards
+
+// Board groups lists of cards
+type Board struct {
+	Name string `json:"name" valid:"required" db:"name"`
+	// OwnerID is the user the board, and its lists, belong to
+	OwnerID int64 `json:"owner_id,omitempty" db:"owner_id"`
+	ID      int64 `json:"id,omitempty" db:"id"`
+}
+
+// List is an ordered column of cards inside a board
+type List struct {
+	Name    string `json:"name" valid:"required" db:"name"`
+	BoardID int64  `json:"board_id" db:"board_id"`
+	// Position orders the lists of a board
+	Position float64 `json:"position" db:"position"`
+	ID       int64   `json:"id,omitempty" db:"id"`
+}
@@ -1,9 +1,29 @@
 package cards
 
+import "time"
+
 // Card is item in todo list
 type Card struct {
-	Title string `json:"title" valid:"alphanum, required"`
-	Text  string `json:"text" valid:"alphanum, required"`
-	Done  bool   `json:"done"`
-	ID    int64  `json:"id,omitempty"`
+	Title string `json:"title" valid:"alphanum, required" db:"title"`
+	Text  string `json:"text" valid:"alphanum, required" db:"text"`
+	Done  bool   `json:"done" db:"done"`
+	ID    int64  `json:"id,omitempty" db:"id"`
+	// OwnerID is the user the card belongs to
+	OwnerID int64 `json:"owner_id,omitempty" db:"owner_id"`
+	// Version is incremented on every update
+	Version int64 `json:"version" db:"version"`
+	// ListID is the list holding the card, zero when it's in none
+	ListID int64 `json:"list_id,omitempty" db:"list_id"`
+	// Position orders the cards of a list
+	Position float64 `json:"position" db:"position"`
+	// Labels are the ids of the labels attached, in order
+	Labels []int64 `json:"labels,omitempty" db:"-"`
+	// DueAt is when the card is due
+	DueAt *time.Time `json:"due_at,omitempty" db:"due_at"`
+	// RemindAt is when a reminder of the card is fired
+	RemindAt *time.Time `json:"remind_at,omitempty" db:"remind_at"`
+	// Reminded is set once the reminder is fired, a new RemindAt clears it
+	Reminded bool `json:"reminded,omitempty" db:"reminded"`
+	// DeletedAt is set while the card is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
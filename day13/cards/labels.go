@@ -0,0 +1,11 @@
+package cards
+
+// Label tags cards, a card can have many labels
+type Label struct {
+	Name string `json:"name" valid:"required" db:"name"`
+	// Color is a hex color like #00ff00
+	Color string `json:"color" valid:"hexcolor" db:"color"`
+	// OwnerID is the user the label belongs to
+	OwnerID int64 `json:"owner_id,omitempty" db:"owner_id"`
+	ID      int64 `json:"id,omitempty" db:"id"`
+}
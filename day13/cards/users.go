@@ -0,0 +1,7 @@
+package cards
+
+// User owns cards, boards and labels
+type User struct {
+	Name string `json:"name" valid:"alphanum,required" db:"name"`
+	ID   int64  `json:"id,omitempty" db:"id"`
+}
@@ -0,0 +1,308 @@
+// Package cardsclient is a client of the cards api. Every call takes a
+// context, the errors answered by the server are returned as *Error,
+// except the missing cards and the version conflicts, which are the
+// ErrCardNotFound and ErrVersionMismatch sentinels.
+package cardsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/patch"
+)
+
+var (
+	// ErrCardNotFound returned when the card does not exist or belongs to another user
+	ErrCardNotFound = errors.New("card not found")
+	// ErrVersionMismatch returned when the card was changed by someone else
+	ErrVersionMismatch = errors.New("card version mismatch")
+)
+
+// Error is an error answered by the server, a RFC 7807 problem
+type Error struct {
+	Status        int            `json:"status"`
+	Title         string         `json:"title"`
+	Detail        string         `json:"detail"`
+	InvalidParams []InvalidParam `json:"invalid_params"`
+}
+
+// InvalidParam is a field of the request that did not validate
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("cards: %d %s", e.Status, e.Title)
+	}
+	return fmt.Sprintf("cards: %d %s: %s", e.Status, e.Title, e.Detail)
+}
+
+// Client calls the api at BaseURL, like http://localhost:3000, as the
+// user of Token
+type Client struct {
+	BaseURL string
+	Token   string
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// New returns a client of the api at baseURL
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// httpClient is the client sending the requests
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// request is a call to the api
+type request struct {
+	method string
+	// path with the query string, relative to the base url
+	path        string
+	contentType string
+	body        interface{}
+	// version is sent as If-Match when it's not zero
+	version int64
+}
+
+// do sends req and decodes the response into out, when out is not nil
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	var body io.Reader
+	if req.body != nil {
+		b, err := json.Marshal(req.body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(req.method, c.BaseURL+req.path, body)
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Accept", "application/json")
+	if req.body != nil {
+		contentType := req.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		r.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if req.version != 0 {
+		r.Header.Set("If-Match", strconv.Quote(strconv.FormatInt(req.version, 10)))
+	}
+	resp, err := c.httpClient().Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return responseError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// responseError reads the problem of a response
+func responseError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrCardNotFound
+	case http.StatusPreconditionFailed:
+		return ErrVersionMismatch
+	}
+	e := &Error{}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || json.Unmarshal(body, e) != nil || e.Status == 0 {
+		// not a problem, like the error of a proxy
+		e = &Error{Detail: strings.TrimSpace(string(body))}
+	}
+	e.Status, e.Title = resp.StatusCode, http.StatusText(resp.StatusCode)
+	return e
+}
+
+// cardPath is the path of a card
+func cardPath(id int64) string {
+	return "/cards/" + strconv.FormatInt(id, 10)
+}
+
+// CreateCard creates a card, returning it with its id and version
+func (c *Client) CreateCard(ctx context.Context, card *cards.Card) (*cards.Card, error) {
+	created := &cards.Card{}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/cards", body: card}, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetCard reads a card
+func (c *Client) GetCard(ctx context.Context, id int64) (*cards.Card, error) {
+	card := &cards.Card{}
+	if err := c.do(ctx, request{method: http.MethodGet, path: cardPath(id)}, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// UpdateCard replaces the card with the id of card. When card has a
+// version it's only replaced if it was not changed since that version
+func (c *Client) UpdateCard(ctx context.Context, card *cards.Card) (*cards.Card, error) {
+	updated := &cards.Card{}
+	req := request{method: http.MethodPut, path: cardPath(card.ID), body: card, version: card.Version}
+	if err := c.do(ctx, req, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// PatchCard changes some fields of a card. A []patch.Operation is sent as
+// a JSON Patch and anything else, like a map of the fields, as a merge
+// patch. A version that is not zero must be the version of the card
+func (c *Client) PatchCard(ctx context.Context, id, version int64, changes interface{}) (*cards.Card, error) {
+	contentType := patch.MergePatchType
+	if _, ok := changes.([]patch.Operation); ok {
+		contentType = patch.JSONPatchType
+	}
+	updated := &cards.Card{}
+	req := request{method: http.MethodPatch, path: cardPath(id), contentType: contentType, body: changes, version: version}
+	if err := c.do(ctx, req, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteCard moves a card to the trash. A version that is not zero must
+// be the version of the card
+func (c *Client) DeleteCard(ctx context.Context, id, version int64) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: cardPath(id), version: version}, nil)
+}
+
+// ListOptions filter and sort the cards listed, zero values are left out
+type ListOptions struct {
+	TitlePrefix string
+	Done        *bool
+	ListID      int64
+	DueBefore   *time.Time
+	// Labels are names, LabelOp tells if a card needs all of them (and)
+	// or any of them (or)
+	Labels  []string
+	LabelOp string
+	// Sort is id, title, -id or position
+	Sort string
+	// Limit is the size of each page fetched
+	Limit int
+}
+
+// query is the query string of the options
+func (opts ListOptions) query() string {
+	values := url.Values{}
+	if opts.TitlePrefix != "" {
+		values.Set("title_prefix", opts.TitlePrefix)
+	}
+	if opts.Done != nil {
+		values.Set("done", strconv.FormatBool(*opts.Done))
+	}
+	if opts.ListID != 0 {
+		values.Set("list_id", strconv.FormatInt(opts.ListID, 10))
+	}
+	if opts.DueBefore != nil {
+		values.Set("due_before", opts.DueBefore.Format(time.RFC3339))
+	}
+	if len(opts.Labels) > 0 {
+		values.Set("label", strings.Join(opts.Labels, ","))
+	}
+	if opts.LabelOp != "" {
+		values.Set("label_op", opts.LabelOp)
+	}
+	if opts.Sort != "" {
+		values.Set("sort", opts.Sort)
+	}
+	if opts.Limit != 0 {
+		values.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// page is a page of cards, next is the path of the next one
+type page struct {
+	Cards []*cards.Card `json:"cards"`
+	Next  string        `json:"next"`
+}
+
+// CardIterator walks the cards of a list, fetching a page at a time:
+//
+//	it := client.ListCards(ctx, cardsclient.ListOptions{})
+//	for it.Next() {
+//		card := it.Card()
+//	}
+//	if err := it.Err(); err != nil {
+type CardIterator struct {
+	ctx    context.Context
+	client *Client
+	// next is the path of the next page, empty after the last one
+	next  string
+	cards []*cards.Card
+	card  *cards.Card
+	err   error
+}
+
+// ListCards lists the cards matching opts. No request is sent until
+// the first call to Next
+func (c *Client) ListCards(ctx context.Context, opts ListOptions) *CardIterator {
+	return &CardIterator{ctx: ctx, client: c, next: "/cards" + opts.query()}
+}
+
+// Next moves to the next card, fetching the next page when the current
+// one is over. It returns false at the end of the list or on an error
+func (it *CardIterator) Next() bool {
+	for len(it.cards) == 0 {
+		if it.err != nil || it.next == "" {
+			it.card = nil
+			return false
+		}
+		p := page{}
+		if it.err = it.client.do(it.ctx, request{method: http.MethodGet, path: it.next}, &p); it.err != nil {
+			it.card = nil
+			return false
+		}
+		it.cards, it.next = p.Cards, p.Next
+	}
+	it.card, it.cards = it.cards[0], it.cards[1:]
+	return true
+}
+
+// Card is the current card
+func (it *CardIterator) Card() *cards.Card {
+	return it.card
+}
+
+// Err is the error that stopped the iteration, if any
+func (it *CardIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/cardsclient"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/idempotency"
+	"github.com/cassiobotaro/60-days-of-go/day13/patch"
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+	"github.com/cassiobotaro/60-days-of-go/day13/stream"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer serves the api on a memory database
+func testServer(t *testing.T) *httptest.Server {
+	return limitedServer(t, ratelimit.New(ratelimit.NewMemoryStore(time.Minute), ratelimit.Limit{}))
+}
+
+// limitedServer is a testServer whose requests pass through limiter
+func limitedServer(t *testing.T, limiter *ratelimit.Limiter) *httptest.Server {
+	passwordCost = bcrypt.MinCost
+	db = database.NewMemoryDB()
+	hooks = webhook.NewDispatcher(webhook.Options{})
+	events = newStreams(10, stream.DefaultHeartbeat)
+	n, err := newServer(newRouter(), limiter, idempotency.New(idempotency.NewMemoryStore(time.Minute), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(n)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testToken signs up a user and logs them in, returning their token
+func testToken(t *testing.T, server *httptest.Server, name string) string {
+	body := `{"name":"` + name + `","password":"secretpass"}`
+	if resp, _ := call(t, server, "", http.MethodPost, "/users", body); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /users: status = %d", resp.StatusCode)
+	}
+	resp, content := call(t, server, "", http.MethodPost, "/tokens", body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /tokens: status = %d", resp.StatusCode)
+	}
+	s := session{}
+	if err := json.Unmarshal(content, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s.Token
+}
+
+// call sends a request with the token, when there's one, and the
+// headers given as name and value pairs. It returns the response
+// with its body already read
+func call(t *testing.T, server *httptest.Server, token, method, path, body string, headers ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, content
+}
+
+// testClient signs up a user and returns a client with their token
+func testClient(t *testing.T, server *httptest.Server, name string) *cardsclient.Client {
+	client := cardsclient.New(server.URL, testToken(t, server, name))
+	client.HTTPClient = server.Client()
+	return client
+}
+
+func TestClientCards(t *testing.T) {
+	server := testServer(t)
+	client := testClient(t, server, "alice")
+	ctx := context.Background()
+
+	card, err := client.CreateCard(ctx, &cards.Card{Title: "milk", Text: "buy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.ID != 1 || card.Version != 1 || card.Title != "milk" {
+		t.Fatalf("card = %+v", card)
+	}
+	if card, err = client.GetCard(ctx, 1); err != nil || card.Text != "buy" {
+		t.Fatalf("card = %+v, err = %v", card, err)
+	}
+
+	card.Done = true
+	updated, err := client.UpdateCard(ctx, card)
+	if err != nil || !updated.Done || updated.Version != 2 {
+		t.Fatalf("card = %+v, err = %v", updated, err)
+	}
+	// card still has version 1
+	if _, err = client.UpdateCard(ctx, card); err != cardsclient.ErrVersionMismatch {
+		t.Fatalf("err = %v", err)
+	}
+
+	patched, err := client.PatchCard(ctx, 1, 2, map[string]interface{}{"text": "sell"})
+	if err != nil || patched.Text != "sell" || !patched.Done || patched.Version != 3 {
+		t.Fatalf("card = %+v, err = %v", patched, err)
+	}
+	ops := []patch.Operation{{Op: "replace", Path: "/done", Value: json.RawMessage("false")}}
+	if patched, err = client.PatchCard(ctx, 1, 0, ops); err != nil || patched.Done {
+		t.Fatalf("card = %+v, err = %v", patched, err)
+	}
+	if _, err = client.PatchCard(ctx, 1, 1, ops); err != cardsclient.ErrVersionMismatch {
+		t.Fatalf("err = %v", err)
+	}
+
+	if err = client.DeleteCard(ctx, 1, 1); err != cardsclient.ErrVersionMismatch {
+		t.Fatalf("err = %v", err)
+	}
+	if err = client.DeleteCard(ctx, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetCard(ctx, 1); err != cardsclient.ErrCardNotFound {
+		t.Fatalf("err = %v", err)
+	}
+	if err = client.DeleteCard(ctx, 1, 0); err != cardsclient.ErrCardNotFound {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := testServer(t)
+	alice := testClient(t, server, "alice")
+	bob := testClient(t, server, "bob")
+	ctx := context.Background()
+
+	_, err := alice.CreateCard(ctx, &cards.Card{Title: "no spaces", Text: "text"})
+	e, ok := err.(*cardsclient.Error)
+	if !ok || e.Status != http.StatusBadRequest || len(e.InvalidParams) != 1 || e.InvalidParams[0].Name != "title" {
+		t.Fatalf("err = %#v", err)
+	}
+
+	card, err := alice.CreateCard(ctx, &cards.Card{Title: "secret", Text: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cards of other users are not found
+	if _, err = bob.GetCard(ctx, card.ID); err != cardsclient.ErrCardNotFound {
+		t.Fatalf("err = %v", err)
+	}
+
+	anonymous := cardsclient.New(server.URL, "wrong")
+	if _, err = anonymous.GetCard(ctx, card.ID); err == nil || err.(*cardsclient.Error).Status != http.StatusUnauthorized {
+		t.Fatalf("err = %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = alice.GetCard(canceled, card.ID); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestClientListCards(t *testing.T) {
+	server := testServer(t)
+	client := testClient(t, server, "alice")
+	ctx := context.Background()
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		card, err := client.CreateCard(ctx, &cards.Card{Title: title, Text: "text"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if title == "b" || title == "d" {
+			if _, err = client.PatchCard(ctx, card.ID, 0, map[string]bool{"done": true}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// pages of two cards
+	it := client.ListCards(ctx, cardsclient.ListOptions{Limit: 2, Sort: "-id"})
+	var titles []string
+	for it.Next() {
+		titles = append(titles, it.Card().Title)
+	}
+	if it.Err() != nil || strings.Join(titles, "") != "edcba" {
+		t.Fatalf("titles = %v, err = %v", titles, it.Err())
+	}
+
+	notDone := false
+	it = client.ListCards(ctx, cardsclient.ListOptions{Done: &notDone, Limit: 1})
+	titles = nil
+	for it.Next() {
+		titles = append(titles, it.Card().Title)
+	}
+	if it.Err() != nil || strings.Join(titles, "") != "ace" {
+		t.Fatalf("titles = %v, err = %v", titles, it.Err())
+	}
+
+	it = client.ListCards(ctx, cardsclient.ListOptions{Limit: 1000})
+	if it.Next() || it.Card() != nil {
+		t.Fatal("an invalid limit listed cards")
+	}
+	if e, ok := it.Err().(*cardsclient.Error); !ok || e.Status != http.StatusBadRequest {
+		t.Fatalf("err = %v", it.Err())
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/cardsclient"
+)
+
+// parseFlags parses the flags of a command, the usage is printed by run
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// parseID reads the only argument, the id of a card
+func parseID(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id < 1 {
+		return 0, errUsage
+	}
+	return id, nil
+}
+
+// printJSON writes v indented
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// formatDue is the due date of a card, - when it has none
+func formatDue(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func add(e *env, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	card, err := e.client.CreateCard(e.ctx, &cards.Card{Title: args[0], Text: args[1]})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "created card %d\n", card.ID)
+	return nil
+}
+
+func ls(e *env, args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	done := flags.Bool("done", false, "only the cards done")
+	pending := flags.Bool("pending", false, "only the cards not done")
+	asJSON := flags.Bool("json", false, "print json instead of a table")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || (*done && *pending) {
+		return errUsage
+	}
+	opts := cardsclient.ListOptions{Limit: 100}
+	if *done || *pending {
+		opts.Done = done
+	}
+	list := []*cards.Card{}
+	it := e.client.ListCards(e.ctx, opts)
+	for it.Next() {
+		list = append(list, it.Card())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(e.stdout, list)
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDONE\tTITLE\tTEXT\tDUE")
+	for _, card := range list {
+		done := ""
+		if card.Done {
+			done = "x"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", card.ID, done, card.Title, card.Text, formatDue(card.DueAt))
+	}
+	return w.Flush()
+}
+
+func show(e *env, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print json")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	id, err := parseID(flags.Args())
+	if err != nil {
+		return err
+	}
+	card, err := e.client.GetCard(e.ctx, id)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(e.stdout, card)
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "id:\t%d\n", card.ID)
+	fmt.Fprintf(w, "title:\t%s\n", card.Title)
+	fmt.Fprintf(w, "text:\t%s\n", card.Text)
+	fmt.Fprintf(w, "done:\t%t\n", card.Done)
+	fmt.Fprintf(w, "due:\t%s\n", formatDue(card.DueAt))
+	fmt.Fprintf(w, "remind:\t%s\n", formatDue(card.RemindAt))
+	fmt.Fprintf(w, "version:\t%d\n", card.Version)
+	return w.Flush()
+}
+
+// editable are the fields of a card changed by edit
+type editable struct {
+	Title    string     `json:"title"`
+	Text     string     `json:"text"`
+	Done     bool       `json:"done"`
+	DueAt    *time.Time `json:"due_at"`
+	RemindAt *time.Time `json:"remind_at"`
+}
+
+// editor is the command of $VISUAL or $EDITOR, vi by default
+func editor() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// edit opens the card in an editor and sends the fields changed. It
+// fails when the card was changed by someone else in the meantime
+func edit(e *env, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+	card, err := e.client.GetCard(e.ctx, id)
+	if err != nil {
+		return err
+	}
+	before := editable{Title: card.Title, Text: card.Text, Done: card.Done, DueAt: card.DueAt, RemindAt: card.RemindAt}
+	f, err := ioutil.TempFile("", fmt.Sprintf("card-%d-*.json", id))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = printJSON(f, before)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	command := editor()
+	cmd := exec.Command(command[0], append(command[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("editor: %v", err)
+	}
+	content, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	after := editable{}
+	if err = json.Unmarshal(content, &after); err != nil {
+		return fmt.Errorf("card %d not changed: %v", id, err)
+	}
+	changes := changedFields(before, after)
+	if len(changes) == 0 {
+		fmt.Fprintf(e.stdout, "card %d not changed\n", id)
+		return nil
+	}
+	updated, err := e.client.PatchCard(e.ctx, id, card.Version, changes)
+	if err == cardsclient.ErrVersionMismatch {
+		return fmt.Errorf("card %d was changed while it was edited, edit it again", id)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "updated card %d\n", updated.ID)
+	return nil
+}
+
+// changedFields is the merge patch from before to after
+func changedFields(before, after editable) map[string]interface{} {
+	changes := map[string]interface{}{}
+	if after.Title != before.Title {
+		changes["title"] = after.Title
+	}
+	if after.Text != before.Text {
+		changes["text"] = after.Text
+	}
+	if after.Done != before.Done {
+		changes["done"] = after.Done
+	}
+	if !sameTime(after.DueAt, before.DueAt) {
+		changes["due_at"] = after.DueAt
+	}
+	if !sameTime(after.RemindAt, before.RemindAt) {
+		changes["remind_at"] = after.RemindAt
+	}
+	return changes
+}
+
+// sameTime tells if a and b are the same instant, or both missing
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// markDone returns the command that marks a card as done, or not
+func markDone(done bool) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		id, err := parseID(args)
+		if err != nil {
+			return err
+		}
+		if _, err = e.client.PatchCard(e.ctx, id, 0, map[string]bool{"done": done}); err != nil {
+			return err
+		}
+		if done {
+			fmt.Fprintf(e.stdout, "card %d done\n", id)
+		} else {
+			fmt.Fprintf(e.stdout, "card %d not done\n", id)
+		}
+		return nil
+	}
+}
+
+func rm(e *env, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+	if err = e.client.DeleteCard(e.ctx, id, 0); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "card %d moved to the trash\n", id)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultServer is the address the day13 server listens on
+const defaultServer = "http://localhost:3000"
+
+// config is where the server is and who the user is, read from
+// a json file like {"server": "http://localhost:3000", "token": "..."}
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// configPath is the file of the config, $CARDS_CONFIG or cards/config.json
+// in the user config directory
+func configPath() string {
+	if path := os.Getenv("CARDS_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "cards", "config.json")
+}
+
+// loadConfig reads the config at path, a missing file is the default config
+func loadConfig(path string) (config, error) {
+	c := config{Server: defaultServer}
+	if path == "" {
+		return c, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	if err = json.NewDecoder(f).Decode(&c); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Server == "" {
+		c.Server = defaultServer
+	}
+	return c, nil
+}
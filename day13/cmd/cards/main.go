@@ -0,0 +1,148 @@
+// Command cards manages the cards of the day13 api from a terminal:
+//
+//	cards add milk buy             create a card
+//	cards ls [-done|-pending]      list the cards, as a table or -json
+//	cards show 1                   print a card
+//	cards edit 1                   change a card in $EDITOR
+//	cards done 1 / cards undone 1  mark a card as done or not
+//	cards rm 1                     move a card to the trash
+//
+// The server and the token are read from the config file, see configPath,
+// and can be overridden by the -server and -token flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cardsclient"
+)
+
+// exit codes, scripts can tell why a command failed
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	exitNotFound
+	exitInvalid
+	exitNetwork
+)
+
+// errUsage is returned by the commands called with wrong arguments
+var errUsage = errors.New("usage")
+
+// env is what the commands use
+type env struct {
+	ctx    context.Context
+	client *cardsclient.Client
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command runs a subcommand with its arguments
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"add":    {"add TITLE TEXT", add},
+	"ls":     {"ls [-done | -pending] [-json]", ls},
+	"show":   {"show [-json] ID", show},
+	"edit":   {"edit ID", edit},
+	"done":   {"done ID", markDone(true)},
+	"undone": {"undone ID", markDone(false)},
+	"rm":     {"rm ID", rm},
+}
+
+// usage prints how to call cards
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: cards [-config FILE] [-server URL] [-token TOKEN] COMMAND")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range []string{"add", "ls", "show", "edit", "done", "undone", "rm"} {
+		fmt.Fprintln(w, "  cards", commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// run runs cards with args, returning the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cards", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	path := flags.String("config", configPath(), "config file, $CARDS_CONFIG overrides the default")
+	server := flags.String("server", "", "url of the api, overrides the config")
+	token := flags.String("token", "", "api token, overrides the config")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		usage(stderr, flags)
+		return exitUsage
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "cards: unknown command %q\n", flags.Arg(0))
+		usage(stderr, flags)
+		return exitUsage
+	}
+	c, err := loadConfig(*path)
+	if err != nil {
+		fmt.Fprintln(stderr, "cards:", err)
+		return exitError
+	}
+	if *server != "" {
+		c.Server = *server
+	}
+	if *token != "" {
+		c.Token = *token
+	}
+	e := &env{ctx: context.Background(), client: cardsclient.New(c.Server, c.Token), stdout: stdout, stderr: stderr}
+	err = cmd.run(e, flags.Args()[1:])
+	if err == errUsage {
+		fmt.Fprintln(stderr, "usage: cards", cmd.usage)
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "cards:", message(err))
+	}
+	return exitCode(err)
+}
+
+// exitCode tells the kind of an error
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if err == cardsclient.ErrCardNotFound {
+		return exitNotFound
+	}
+	if e, ok := err.(*cardsclient.Error); ok && (e.Status == http.StatusBadRequest || e.Status == http.StatusUnprocessableEntity) {
+		return exitInvalid
+	}
+	if _, ok := err.(*url.Error); ok {
+		return exitNetwork
+	}
+	return exitError
+}
+
+// message describes an error, with the fields that did not validate
+func message(err error) string {
+	e, ok := err.(*cardsclient.Error)
+	if !ok || len(e.InvalidParams) == 0 {
+		return err.Error()
+	}
+	msg := e.Title
+	for _, param := range e.InvalidParams {
+		msg += fmt.Sprintf("\n  %s: %s", param.Name, param.Reason)
+	}
+	return msg
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
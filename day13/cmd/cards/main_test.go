@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// fakeAPI keeps the cards of a single user, like the day13 server does
+type fakeAPI struct {
+	mu    sync.Mutex
+	cards []*cards.Card
+}
+
+// problem answers an error like the day13 server
+func problem(w http.ResponseWriter, status int, params ...string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	p := map[string]interface{}{"status": status, "title": http.StatusText(status)}
+	if len(params) > 0 {
+		p["invalid_params"] = []map[string]string{{"name": params[0], "reason": params[1]}}
+	}
+	json.NewEncoder(w).Encode(p)
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		problem(w, http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/cards" {
+		switch r.Method {
+		case http.MethodPost:
+			card := &cards.Card{}
+			json.NewDecoder(r.Body).Decode(card)
+			if strings.Contains(card.Title, " ") {
+				problem(w, http.StatusBadRequest, "title", "must match ^[a-zA-Z0-9]+$")
+				return
+			}
+			card.ID, card.Version = int64(len(api.cards)+1), 1
+			api.cards = append(api.cards, card)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(card)
+		case http.MethodGet:
+			page := []*cards.Card{}
+			for _, card := range api.cards {
+				if card != nil && (r.URL.Query().Get("done") == "" || strconv.FormatBool(card.Done) == r.URL.Query().Get("done")) {
+					page = append(page, card)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"cards": page})
+		}
+		return
+	}
+	id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/cards/"))
+	if id < 1 || id > len(api.cards) || api.cards[id-1] == nil {
+		problem(w, http.StatusNotFound)
+		return
+	}
+	card := api.cards[id-1]
+	if match := r.Header.Get("If-Match"); match != "" && match != strconv.Quote(strconv.FormatInt(card.Version, 10)) {
+		problem(w, http.StatusPreconditionFailed)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(card)
+	case http.MethodPatch:
+		json.NewDecoder(r.Body).Decode(card)
+		card.Version++
+		json.NewEncoder(w).Encode(card)
+	case http.MethodDelete:
+		api.cards[id-1] = nil
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// cli runs cards against server with a config file, returning the exit code and the output
+func cli(t *testing.T, server *httptest.Server, args ...string) (int, string, string) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"server":"`+server.URL+`","token":"secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-config", path}, args...), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	server := httptest.NewServer(&fakeAPI{})
+	defer server.Close()
+	for _, title := range []string{"milk", "eggs", "bread"} {
+		if code, out, _ := cli(t, server, "add", title, "buy"); code != exitOK || !strings.HasPrefix(out, "created card") {
+			t.Fatalf("add: code = %d, out = %q", code, out)
+		}
+	}
+	if code, out, _ := cli(t, server, "done", "2"); code != exitOK || out != "card 2 done\n" {
+		t.Fatalf("done: code = %d, out = %q", code, out)
+	}
+	code, out, _ := cli(t, server, "ls")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != exitOK || len(lines) != 4 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[2], " x ") {
+		t.Fatalf("ls: code = %d, out = %q", code, out)
+	}
+	code, out, _ = cli(t, server, "ls", "-pending", "-json")
+	list := []cards.Card{}
+	if err := json.Unmarshal([]byte(out), &list); err != nil || code != exitOK || len(list) != 2 || list[1].Title != "bread" {
+		t.Fatalf("ls -pending -json: code = %d, out = %q", code, out)
+	}
+	if code, out, _ = cli(t, server, "ls", "-done"); code != exitOK || strings.Count(out, "\n") != 2 {
+		t.Fatalf("ls -done: code = %d, out = %q", code, out)
+	}
+
+	t.Setenv("VISUAL", "sed -i s/milk/cheese/")
+	if code, out, _ = cli(t, server, "edit", "1"); code != exitOK || out != "updated card 1\n" {
+		t.Fatalf("edit: code = %d, out = %q", code, out)
+	}
+	t.Setenv("VISUAL", "true")
+	if code, out, _ = cli(t, server, "edit", "1"); code != exitOK || out != "card 1 not changed\n" {
+		t.Fatalf("edit: code = %d, out = %q", code, out)
+	}
+	if code, out, _ = cli(t, server, "show", "1"); code != exitOK || !strings.Contains(out, "cheese") || !strings.Contains(out, "version:  2") {
+		t.Fatalf("show: code = %d, out = %q", code, out)
+	}
+
+	if code, out, _ = cli(t, server, "rm", "1"); code != exitOK || out != "card 1 moved to the trash\n" {
+		t.Fatalf("rm: code = %d, out = %q", code, out)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	server := httptest.NewServer(&fakeAPI{})
+	for _, test := range []struct {
+		args []string
+		code int
+		err  string
+	}{
+		{[]string{}, exitUsage, "usage"},
+		{[]string{"fly"}, exitUsage, "unknown command"},
+		{[]string{"show", "one"}, exitUsage, "usage: cards show"},
+		{[]string{"ls", "-done", "-pending"}, exitUsage, "usage: cards ls"},
+		{[]string{"show", "7"}, exitNotFound, "card not found"},
+		{[]string{"undone", "7"}, exitNotFound, "card not found"},
+		{[]string{"add", "two words", "text"}, exitInvalid, "title: must match"},
+		{[]string{"-token", "wrong", "ls"}, exitError, "401"},
+	} {
+		if code, _, stderr := cli(t, server, test.args...); code != test.code || !strings.Contains(stderr, test.err) {
+			t.Errorf("%v: code = %d, stderr = %q", test.args, code, stderr)
+		}
+	}
+	server.Close()
+	if code, _, stderr := cli(t, server, "ls"); code != exitNetwork {
+		t.Errorf("code = %d, stderr = %q", code, stderr)
+	}
+}
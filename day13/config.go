@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// envPrefix starts the environment variables that set the flags,
+// CARDS_TRASH_RETENTION sets -trash-retention
+const envPrefix = "CARDS_"
+
+// envName is the environment variable of a flag
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// setFromEnv sets the flags whose variable lookup finds. It runs before
+// the flags are parsed, so the command line has the last word
+func setFromEnv(flags *flag.FlagSet, lookup func(key string) (string, bool)) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := lookup(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %v", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+var (
+	// ErrBoardNotFound raised when a board is not found
+	ErrBoardNotFound = errors.New("board not found")
+	// ErrListNotFound raised when a list is not found
+	ErrListNotFound = errors.New("list not found")
+	// ErrBoardNotEmpty raised when removing a board that still has lists
+	ErrBoardNotEmpty = errors.New("board still has lists")
+	// ErrListNotEmpty raised when removing a list that still has cards, even trashed ones
+	ErrListNotEmpty = errors.New("list still has cards")
+)
+
+// Boards methods that all database have to implement to organize
+// cards in boards and lists.
+// UpdateBoard and UpdateList ignore empty names and zero positions.
+// A card created with a list goes to its end, MoveCard puts it at
+// index of another (or the same) list.
+type Boards interface {
+	CreateBoard(board *cards.Board) error
+	AllBoards() ([]*cards.Board, error)
+	GetBoard(id int64) (*cards.Board, error)
+	UpdateBoard(board *cards.Board) (*cards.Board, error)
+	RemoveBoard(id int64) error
+	CreateList(list *cards.List) error
+	BoardLists(boardID int64) ([]*cards.List, error)
+	GetList(id int64) (*cards.List, error)
+	UpdateList(list *cards.List) (*cards.List, error)
+	RemoveList(id int64) error
+	MoveCard(id, listID int64, index int, version int64) (*cards.Card, error)
+}
+
+// positionAt returns a position that puts a card at index of a list
+// whose cards have the given sorted positions. Positions are fractions,
+// so only the moved card changes. When two neighbours are too close to
+// fit a card between them, ok is false and the list must be renumbered.
+func positionAt(positions []float64, index int) (position float64, ok bool) {
+	switch {
+	case len(positions) == 0:
+		return 1, true
+	case index <= 0:
+		return positions[0] - 1, true
+	case index >= len(positions):
+		return positions[len(positions)-1] + 1, true
+	}
+	before, after := positions[index-1], positions[index]
+	position = before + (after-before)/2
+	return position, position != before && position != after
+}
+
+// renumbered are the positions 1, 2, 3... used when a list is renumbered
+func renumbered(n int) []float64 {
+	positions := make([]float64, n)
+	for i := range positions {
+		positions[i] = float64(i + 1)
+	}
+	return positions
+}
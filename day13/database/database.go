@@ -2,6 +2,7 @@ package database
 
 import (
 	"errors"
+	"time"
 
 	"github.com/cassiobotaro/60-days-of-go/day13/cards"
 )
@@ -9,13 +10,56 @@ import (
 var (
 	// ErrCardNotFound raised when a card is not found
 	ErrCardNotFound = errors.New("card not found")
+	// ErrVersionMismatch raised when the card was changed by someone else
+	ErrVersionMismatch = errors.New("card version mismatch")
+	// ErrClosed raised by Ping once a memory database is closed
+	ErrClosed = errors.New("database closed")
 )
 
-// Database methods that all database have to implement
+// CardCounts are how many cards are in each state
+type CardCounts struct {
+	Pending int64
+	Done    int64
+	Trashed int64
+}
+
+// Database methods that all database have to implement.
+// RemoveCard moves the card to the trash, from where it can be
+// restored or purged for good.
+// UpdateCard and RemoveCard only change the card if the version
+// matches, zero means any version. UpdateCard ignores empty title
+// and text but always replaces done and the due and reminder dates.
+// Every change is recorded in the card history, As returns a view
+// of the same database whose changes are recorded as made by author.
+// For returns a view that only sees and changes the cards, boards and
+// labels of owner, and whatever is created through it belongs to owner.
+// Owner zero, the view a database is opened with, sees everything.
+// Batch runs fn with a view whose changes are kept all together when
+// fn returns nil and are all discarded when it returns an error. fn
+// must only use that view, other writers wait until the batch is done.
+// CardCounts counts the cards of every owner, whatever the view, from
+// counters the writes keep up to date, so it does not read the cards.
+// Ping tells if the database can still serve requests.
 type Database interface {
 	CreateCard(card *cards.Card) error
 	AllCards() []*cards.Card
+	QueryCards(q Query) (*Page, error)
 	GetCard(id int64) (*cards.Card, error)
-	RemoveCard(id int64) error
+	RemoveCard(id, version int64) error
 	UpdateCard(card *cards.Card) (*cards.Card, error)
+	TrashedCards() ([]*cards.Card, error)
+	RestoreCard(id int64) (*cards.Card, error)
+	PurgeCard(id int64) error
+	PurgeTrash(before time.Time) (int, error)
+	CardHistory(id int64) ([]*Revision, error)
+	CardRevision(id, rev int64) (*Revision, error)
+	As(author string) Database
+	For(owner int64) Database
+	Batch(fn func(tx Database) error) error
+	CardCounts() (CardCounts, error)
+	Ping() error
+	Boards
+	Labels
+	Reminders
+	Users
 }
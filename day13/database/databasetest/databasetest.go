@@ -0,0 +1,1171 @@
+// Package databasetest has the checks that every database.Database
+// implementation must pass
+package databasetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+)
+
+// Factory returns a new and empty database for each test
+type Factory func(t *testing.T) database.Database
+
+// Run runs every conformance test against the databases built by newDB
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db database.Database)
+	}{
+		{"IDAssignment", testIDAssignment},
+		{"NotFound", testNotFound},
+		{"GetCard", testGetCard},
+		{"PartialUpdate", testPartialUpdate},
+		{"VersionMismatch", testVersionMismatch},
+		{"RemoveCard", testRemoveCard},
+		{"AllCardsOrder", testAllCardsOrder},
+		{"QueryCards", testQueryCards},
+		{"Trash", testTrash},
+		{"History", testHistory},
+		{"Boards", testBoards},
+		{"MoveCard", testMoveCard},
+		{"Labels", testLabels},
+		{"Reminders", testReminders},
+		{"Users", testUsers},
+		{"Ownership", testOwnership},
+		{"ClaimOrphans", testClaimOrphans},
+		{"Batch", testBatch},
+		{"CardCounts", testCardCounts},
+		{"Concurrency", testConcurrency},
+		{"Ping", testPing},
+	}
+	for _, tt := range tests {
+		test := tt.test
+		t.Run(tt.name, func(t *testing.T) {
+			test(t, newDB(t))
+		})
+	}
+}
+
+// mustCreate creates a card or stops the test
+func mustCreate(t *testing.T, db database.Database, title, text string) *cards.Card {
+	card := &cards.Card{Title: title, Text: text}
+	if err := db.CreateCard(card); err != nil {
+		t.Fatalf("create card: %v", err)
+	}
+	return card
+}
+
+func testIDAssignment(t *testing.T, db database.Database) {
+	var last int64
+	for i := 0; i < 3; i++ {
+		card := mustCreate(t, db, "title", "text")
+		if card.ID <= last {
+			t.Errorf("expected id greater than %d but %d was obtained", last, card.ID)
+		}
+		if card.Version != 1 {
+			t.Errorf("expected version 1 but %d was obtained", card.Version)
+		}
+		last = card.ID
+	}
+	// ids are never handed out twice
+	if err := db.RemoveCard(last, 0); err != nil {
+		t.Fatal(err)
+	}
+	card := mustCreate(t, db, "title", "text")
+	if card.ID <= last {
+		t.Errorf("expected id greater than %d after remove but %d was obtained", last, card.ID)
+	}
+}
+
+func testNotFound(t *testing.T, db database.Database) {
+	mustCreate(t, db, "title", "text")
+	if _, err := db.GetCard(42); err != database.ErrCardNotFound {
+		t.Errorf("GetCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if err := db.RemoveCard(42, 0); err != database.ErrCardNotFound {
+		t.Errorf("RemoveCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if _, err := db.UpdateCard(&cards.Card{ID: 42, Title: "title"}); err != database.ErrCardNotFound {
+		t.Errorf("UpdateCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	// the version is not checked for missing cards
+	if err := db.RemoveCard(42, 1); err != database.ErrCardNotFound {
+		t.Errorf("RemoveCard with version: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+}
+
+func testGetCard(t *testing.T, db database.Database) {
+	created := mustCreate(t, db, "title", "text")
+	card, err := db.GetCard(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(card, created) {
+		t.Errorf("expected %+v but %+v was obtained", *created, *card)
+	}
+	// the returned card is not the stored one
+	card.Title = "changed"
+	if card, _ = db.GetCard(created.ID); card.Title != "title" {
+		t.Errorf("changing a returned card changed the database")
+	}
+}
+
+func testPartialUpdate(t *testing.T, db database.Database) {
+	created := mustCreate(t, db, "title", "text")
+	table := []struct {
+		update   cards.Card
+		expected cards.Card
+	}{
+		// empty title and text are ignored
+		{cards.Card{Title: "new"}, cards.Card{Title: "new", Text: "text", Version: 2}},
+		{cards.Card{Text: "new"}, cards.Card{Title: "new", Text: "new", Version: 3}},
+		// done is always replaced
+		{cards.Card{Done: true}, cards.Card{Title: "new", Text: "new", Done: true, Version: 4}},
+		{cards.Card{Title: "last"}, cards.Card{Title: "last", Text: "new", Version: 5}},
+	}
+	for _, data := range table {
+		data.update.ID = created.ID
+		data.expected.ID = created.ID
+		updated, err := db.UpdateCard(&data.update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*updated, data.expected) {
+			t.Errorf("expected %+v but %+v was obtained", data.expected, *updated)
+		}
+		if stored, _ := db.GetCard(created.ID); !reflect.DeepEqual(*stored, data.expected) {
+			t.Errorf("expected %+v stored but %+v was obtained", data.expected, *stored)
+		}
+	}
+}
+
+func testVersionMismatch(t *testing.T, db database.Database) {
+	created := mustCreate(t, db, "title", "text")
+	_, err := db.UpdateCard(&cards.Card{ID: created.ID, Title: "new", Version: 2})
+	if err != database.ErrVersionMismatch {
+		t.Errorf("UpdateCard: expected %v but %v was obtained", database.ErrVersionMismatch, err)
+	}
+	if _, err = db.UpdateCard(&cards.Card{ID: created.ID, Title: "new", Version: 1}); err != nil {
+		t.Errorf("UpdateCard: expected no error but %v was obtained", err)
+	}
+	if err = db.RemoveCard(created.ID, 1); err != database.ErrVersionMismatch {
+		t.Errorf("RemoveCard: expected %v but %v was obtained", database.ErrVersionMismatch, err)
+	}
+	if err = db.RemoveCard(created.ID, 2); err != nil {
+		t.Errorf("RemoveCard: expected no error but %v was obtained", err)
+	}
+}
+
+func testRemoveCard(t *testing.T, db database.Database) {
+	first := mustCreate(t, db, "first", "text")
+	second := mustCreate(t, db, "second", "text")
+	if err := db.RemoveCard(first.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetCard(first.ID); err != database.ErrCardNotFound {
+		t.Errorf("expected %v after remove but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if err := db.RemoveCard(first.ID, 0); err != database.ErrCardNotFound {
+		t.Errorf("expected %v removing twice but %v was obtained", database.ErrCardNotFound, err)
+	}
+	all := db.AllCards()
+	if len(all) != 1 || all[0].ID != second.ID {
+		t.Errorf("expected only card %d left but %v was obtained", second.ID, all)
+	}
+}
+
+func testAllCardsOrder(t *testing.T, db database.Database) {
+	if all := db.AllCards(); len(all) != 0 {
+		t.Fatalf("expected an empty database but %d cards were obtained", len(all))
+	}
+	ids := []int64{}
+	for _, title := range []string{"c", "a", "b", "d"} {
+		ids = append(ids, mustCreate(t, db, title, "text").ID)
+	}
+	// updates and removes do not change the order
+	if _, err := db.UpdateCard(&cards.Card{ID: ids[0], Title: "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RemoveCard(ids[2], 0); err != nil {
+		t.Fatal(err)
+	}
+	ids = append(ids[:2], ids[3])
+	all := db.AllCards()
+	if len(all) != len(ids) {
+		t.Fatalf("expected %d cards but %d was obtained", len(ids), len(all))
+	}
+	for i, card := range all {
+		if card.ID != ids[i] {
+			t.Errorf("expected id %d at %d but %d was obtained", ids[i], i, card.ID)
+		}
+	}
+}
+
+func testQueryCards(t *testing.T, db database.Database) {
+	for _, title := range []string{"b", "a", "ab", "c", "a"} {
+		mustCreate(t, db, title, "text")
+	}
+	done := true
+	if _, err := db.UpdateCard(&cards.Card{ID: 2, Done: true}); err != nil {
+		t.Fatal(err)
+	}
+	table := []struct {
+		query    database.Query
+		expected []int64
+	}{
+		{database.Query{}, []int64{1, 2, 3, 4, 5}},
+		{database.Query{Sort: "-id"}, []int64{5, 4, 3, 2, 1}},
+		{database.Query{Sort: "title"}, []int64{2, 5, 3, 1, 4}},
+		{database.Query{TitlePrefix: "a"}, []int64{2, 3, 5}},
+		{database.Query{Done: &done}, []int64{2}},
+	}
+	for _, data := range table {
+		page, err := db.QueryCards(data.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obtained := []int64{}
+		for _, card := range page.Cards {
+			obtained = append(obtained, card.ID)
+		}
+		if len(obtained) != len(data.expected) {
+			t.Errorf("%+v: expected %v but %v was obtained", data.query, data.expected, obtained)
+			continue
+		}
+		for i := range obtained {
+			if obtained[i] != data.expected[i] {
+				t.Errorf("%+v: expected %v but %v was obtained", data.query, data.expected, obtained)
+				break
+			}
+		}
+	}
+
+	// walk forward and back two by two
+	q := database.Query{Sort: "title", Limit: 2}
+	page, err := db.QueryCards(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Prev != nil || page.Next == nil {
+		t.Fatalf("expected only a next cursor on the first page but %+v was obtained", page)
+	}
+	q.Cursor = page.Next
+	if page, err = db.QueryCards(q); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Cards) != 2 || page.Cards[0].ID != 3 || page.Prev == nil || page.Next == nil {
+		t.Fatalf("expected cards 3 and 1 with both cursors but %+v was obtained", page)
+	}
+	q.Cursor = page.Prev
+	if page, err = db.QueryCards(q); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Cards) != 2 || page.Cards[0].ID != 2 || page.Prev != nil {
+		t.Errorf("expected to be back on the first page but %+v was obtained", page)
+	}
+}
+
+func testTrash(t *testing.T, db database.Database) {
+	first := mustCreate(t, db, "first", "text")
+	second := mustCreate(t, db, "second", "text")
+	third := mustCreate(t, db, "third", "text")
+	for _, card := range []*cards.Card{second, first, third} {
+		if err := db.RemoveCard(card.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trash, err := db.TrashedCards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 3 || trash[0].ID != second.ID || trash[1].ID != first.ID {
+		t.Fatalf("expected cards %d, %d and %d in the trash but %v was obtained", second.ID, first.ID, third.ID, trash)
+	}
+	if trash[0].DeletedAt == nil || trash[0].Version != 2 {
+		t.Errorf("expected a deleted_at and version 2 but %+v was obtained", trash[0])
+	}
+	if _, err = db.UpdateCard(&cards.Card{ID: first.ID, Title: "new"}); err != database.ErrCardNotFound {
+		t.Errorf("expected %v updating a trashed card but %v was obtained", database.ErrCardNotFound, err)
+	}
+
+	restored, err := db.RestoreCard(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil || restored.Version != 3 || restored.Title != "first" {
+		t.Errorf("expected first card restored with version 3 but %+v was obtained", restored)
+	}
+	if _, err = db.RestoreCard(first.ID); err != database.ErrCardNotFound {
+		t.Errorf("expected %v restoring a live card but %v was obtained", database.ErrCardNotFound, err)
+	}
+	// restored cards keep their place
+	fourth := mustCreate(t, db, "fourth", "text")
+	if all := db.AllCards(); len(all) != 2 || all[0].ID != first.ID || all[1].ID != fourth.ID {
+		t.Errorf("expected cards %d and %d but %v was obtained", first.ID, fourth.ID, all)
+	}
+
+	if err = db.PurgeCard(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.PurgeCard(second.ID); err != database.ErrCardNotFound {
+		t.Errorf("expected %v purging twice but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if err = db.PurgeCard(first.ID); err != database.ErrCardNotFound {
+		t.Errorf("expected %v purging a live card but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if n, err := db.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("expected nothing purged but %d was obtained (%v)", n, err)
+	}
+	if n, err := db.PurgeTrash(time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("expected 1 card purged but %d was obtained (%v)", n, err)
+	}
+	if trash, _ = db.TrashedCards(); len(trash) != 0 {
+		t.Errorf("expected an empty trash but %v was obtained", trash)
+	}
+	revisions, _ := db.CardHistory(second.ID)
+	if last := revisions[len(revisions)-1]; last.Op != database.RevisionPurge {
+		t.Errorf("expected the purge in the history but %+v was obtained", last)
+	}
+}
+
+func testCardCounts(t *testing.T, db database.Database) {
+	expect := func(want database.CardCounts) {
+		t.Helper()
+		if counts, err := db.CardCounts(); err != nil || counts != want {
+			t.Errorf("expected %+v but %+v was obtained (%v)", want, counts, err)
+		}
+	}
+	expect(database.CardCounts{})
+	first := mustCreate(t, db, "first", "text")
+	second := mustCreate(t, db, "second", "text")
+	third := mustCreate(t, db, "third", "text")
+	if _, err := db.UpdateCard(&cards.Card{ID: second.ID, Done: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RemoveCard(third.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	expect(database.CardCounts{Pending: 1, Done: 1, Trashed: 1})
+
+	// a batch that fails counts nothing
+	err := db.Batch(func(tx database.Database) error {
+		if err := tx.CreateCard(&cards.Card{Title: "fourth", Text: "text"}); err != nil {
+			return err
+		}
+		if err := tx.RemoveCard(first.ID, 0); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	expect(database.CardCounts{Pending: 1, Done: 1, Trashed: 1})
+
+	if _, err = db.RestoreCard(third.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.RemoveCard(second.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.PurgeCard(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	expect(database.CardCounts{Pending: 2})
+
+	// the views of an owner count every card
+	owned := db.For(7)
+	if err = owned.CreateCard(&cards.Card{Title: "owned", Text: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if counts, err := owned.CardCounts(); err != nil || counts.Pending != 3 {
+		t.Errorf("expected 3 pending cards but %+v was obtained (%v)", counts, err)
+	}
+}
+
+func testHistory(t *testing.T, db database.Database) {
+	if _, err := db.CardHistory(1); err != database.ErrCardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	card := &cards.Card{Title: "title", Text: "text"}
+	if err := db.As("alice").CreateCard(card); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.As("bob").UpdateCard(&cards.Card{ID: card.ID, Title: "new", Done: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.As("carol").RemoveCard(card.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := db.CardHistory(card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		op      string
+		author  string
+		changes int
+		title   string
+	}{
+		{database.RevisionCreate, "alice", 3, "title"},
+		{database.RevisionUpdate, "bob", 2, "new"},
+		{database.RevisionDelete, "carol", 1, "new"},
+	}
+	if len(revisions) != len(expected) {
+		t.Fatalf("expected %d revisions but %d was obtained", len(expected), len(revisions))
+	}
+	for i, e := range expected {
+		r := revisions[i]
+		if r.Rev != int64(i+1) || r.CardID != card.ID || r.Op != e.op || r.Author != e.author ||
+			len(r.Changes) != e.changes || r.Card == nil || r.Card.Title != e.title || r.At.IsZero() {
+			t.Errorf("revision %d: expected %+v but %+v was obtained", i+1, e, r)
+		}
+	}
+	if c := revisions[1].Changes[0]; c.Field != "title" || c.Old != "title" || c.New != "new" {
+		t.Errorf("expected title changed from title to new but %+v was obtained", c)
+	}
+	r, err := db.CardRevision(card.ID, 2)
+	if err != nil || r.Rev != 2 || r.Card.Version != 2 {
+		t.Errorf("expected revision 2 but %+v was obtained (%v)", r, err)
+	}
+	// the stored history does not change with what is returned
+	r.Card.Title, r.Changes[0].New = "changed", "changed"
+	revisions[2].Op = "changed"
+	if r, err = db.CardRevision(card.ID, 2); err != nil || r.Card.Title != "new" || r.Changes[0].New != "new" {
+		t.Errorf("expected revision 2 unchanged but %+v was obtained (%v)", r, err)
+	}
+	if revisions, err = db.CardHistory(card.ID); err != nil || revisions[2].Op != database.RevisionDelete {
+		t.Errorf("expected the history unchanged but %+v was obtained (%v)", revisions, err)
+	}
+	if _, err = db.CardRevision(card.ID, 4); err != database.ErrRevisionNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrRevisionNotFound, err)
+	}
+	if _, err = db.CardRevision(42, 1); err != database.ErrCardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+}
+
+func testBoards(t *testing.T, db database.Database) {
+	board := &cards.Board{Name: "board"}
+	if err := db.CreateBoard(board); err != nil {
+		t.Fatal(err)
+	}
+	todo, done := &cards.List{Name: "todo", BoardID: board.ID}, &cards.List{Name: "done", BoardID: board.ID}
+	for _, list := range []*cards.List{todo, done} {
+		if err := db.CreateList(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if todo.Position >= done.Position {
+		t.Errorf("expected lists created at the end but positions %v and %v were obtained", todo.Position, done.Position)
+	}
+	if err := db.CreateList(&cards.List{Name: "lost", BoardID: board.ID + 1}); err != database.ErrBoardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrBoardNotFound, err)
+	}
+	// put done before todo
+	if _, err := db.UpdateList(&cards.List{ID: done.ID, Position: todo.Position / 2}); err != nil {
+		t.Fatal(err)
+	}
+	lists, err := db.BoardLists(board.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || lists[0].ID != done.ID || lists[0].Name != "done" || lists[1].ID != todo.ID {
+		t.Errorf("expected lists %d and %d but %v was obtained", done.ID, todo.ID, lists)
+	}
+	updated, err := db.UpdateBoard(&cards.Board{ID: board.ID, Name: "renamed"})
+	if err != nil || updated.Name != "renamed" {
+		t.Errorf("expected board renamed but %+v was obtained (%v)", updated, err)
+	}
+
+	card := &cards.Card{Title: "title", Text: "text", ListID: todo.ID}
+	if err = db.CreateCard(card); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateCard(&cards.Card{Title: "title", Text: "text", ListID: todo.ID + 100}); err != database.ErrListNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrListNotFound, err)
+	}
+	if err = db.RemoveBoard(board.ID); err != database.ErrBoardNotEmpty {
+		t.Errorf("expected %v but %v was obtained", database.ErrBoardNotEmpty, err)
+	}
+	// a trashed card still holds the list
+	if err = db.RemoveCard(card.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.RemoveList(todo.ID); err != database.ErrListNotEmpty {
+		t.Errorf("expected %v but %v was obtained", database.ErrListNotEmpty, err)
+	}
+	if err = db.PurgeCard(card.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, list := range []*cards.List{todo, done} {
+		if err = db.RemoveList(list.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = db.GetList(todo.ID); err != database.ErrListNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrListNotFound, err)
+	}
+	if err = db.RemoveBoard(board.ID); err != nil {
+		t.Fatal(err)
+	}
+	if boards, _ := db.AllBoards(); len(boards) != 0 {
+		t.Errorf("expected no boards but %v was obtained", boards)
+	}
+}
+
+// listOrder returns the ids of the cards of a list, by position
+func listOrder(t *testing.T, db database.Database, listID int64) []int64 {
+	page, err := db.QueryCards(database.Query{ListID: listID, Sort: "position", Limit: database.MaxLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int64{}
+	for _, card := range page.Cards {
+		ids = append(ids, card.ID)
+	}
+	return ids
+}
+
+func testMoveCard(t *testing.T, db database.Database) {
+	board := &cards.Board{Name: "board"}
+	if err := db.CreateBoard(board); err != nil {
+		t.Fatal(err)
+	}
+	todo, done := &cards.List{Name: "todo", BoardID: board.ID}, &cards.List{Name: "done", BoardID: board.ID}
+	for _, list := range []*cards.List{todo, done} {
+		if err := db.CreateList(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := []int64{}
+	for i := 0; i < 3; i++ {
+		card := &cards.Card{Title: "title", Text: "text", ListID: todo.ID}
+		if err := db.CreateCard(card); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, card.ID)
+	}
+	if order := listOrder(t, db, todo.ID); fmt.Sprint(order) != fmt.Sprint(ids) {
+		t.Errorf("expected cards %v in creation order but %v was obtained", ids, order)
+	}
+
+	moved, err := db.MoveCard(ids[2], todo.ID, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Version != 2 {
+		t.Errorf("expected version 2 but %d was obtained", moved.Version)
+	}
+	expected := []int64{ids[2], ids[0], ids[1]}
+	if order := listOrder(t, db, todo.ID); fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("expected cards %v but %v was obtained", expected, order)
+	}
+	if _, err = db.MoveCard(ids[2], done.ID, 0, 1); err != database.ErrVersionMismatch {
+		t.Errorf("expected %v but %v was obtained", database.ErrVersionMismatch, err)
+	}
+	if _, err = db.MoveCard(ids[2], done.ID+100, 0, 0); err != database.ErrListNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrListNotFound, err)
+	}
+	if _, err = db.MoveCard(ids[2]+100, done.ID, 0, 0); err != database.ErrCardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if moved, err = db.MoveCard(ids[0], done.ID, 5, 0); err != nil || moved.ListID != done.ID {
+		t.Fatalf("expected card moved to list %d but %+v was obtained (%v)", done.ID, moved, err)
+	}
+	expected = []int64{ids[2], ids[1]}
+	if order := listOrder(t, db, todo.ID); fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("expected cards %v but %v was obtained", expected, order)
+	}
+	revisions, _ := db.CardHistory(ids[0])
+	if last := revisions[len(revisions)-1]; last.Op != database.RevisionMove || last.Changes[0].Field != "list_id" {
+		t.Errorf("expected a move to another list in the history but %+v was obtained", last)
+	}
+
+	// inserting again and again before the last card halves the gap
+	// to it, until it runs out of room and renumbers the list
+	expected = []int64{ids[2]}
+	for i := 0; i < 60; i++ {
+		card := &cards.Card{Title: "title", Text: "text", ListID: todo.ID}
+		if err = db.CreateCard(card); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.MoveCard(card.ID, todo.ID, i+1, 0); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, card.ID)
+	}
+	expected = append(expected, ids[1])
+	if order := listOrder(t, db, todo.ID); fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("expected cards %v but %v was obtained", expected, order)
+	}
+	// the cards renumbered are a new version, with its revision
+	card, err := db.GetCard(ids[1])
+	if err != nil || card.Version == 1 {
+		t.Fatalf("expected renumbering to change the version but %+v was obtained (%v)", card, err)
+	}
+	revisions, _ = db.CardHistory(ids[1])
+	if last := revisions[len(revisions)-1]; last.Op != database.RevisionMove || last.Card.Version != card.Version || last.Changes[0].Field != "position" {
+		t.Errorf("expected the renumbering in the history but %+v was obtained", last)
+	}
+	if _, err = db.UpdateCard(&cards.Card{ID: ids[1], Title: "stale", Version: 1}); err != database.ErrVersionMismatch {
+		t.Errorf("expected %v but %v was obtained", database.ErrVersionMismatch, err)
+	}
+}
+
+func testLabels(t *testing.T, db database.Database) {
+	red, blue := &cards.Label{Name: "red", Color: "#ff0000"}, &cards.Label{Name: "blue", Color: "#0000ff"}
+	for _, label := range []*cards.Label{red, blue} {
+		if err := db.CreateLabel(label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateLabel(&cards.Label{Name: "red"}); err != database.ErrLabelExists {
+		t.Errorf("expected %v but %v was obtained", database.ErrLabelExists, err)
+	}
+	if _, err := db.UpdateLabel(&cards.Label{ID: blue.ID, Name: "red"}); err != database.ErrLabelExists {
+		t.Errorf("expected %v renaming but %v was obtained", database.ErrLabelExists, err)
+	}
+	for i := 0; i < 4; i++ {
+		mustCreate(t, db, "title", "text")
+	}
+	// 1: red, 2: red and blue, 3: blue, 4: none
+	for _, attach := range [][2]int64{{1, red.ID}, {2, blue.ID}, {2, red.ID}, {3, blue.ID}} {
+		if _, err := db.AttachLabel(attach[0], attach[1], 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	card, err := db.AttachLabel(2, red.ID, 0)
+	if err != nil || fmt.Sprint(card.Labels) != fmt.Sprint([]int64{red.ID, blue.ID}) || card.Version != 3 {
+		t.Errorf("expected card 2 with both labels on version 3 but %+v was obtained (%v)", card, err)
+	}
+	// the labels of the history do not change with what is returned
+	revisions, err := db.CardHistory(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions[len(revisions)-1].Card.Labels[0] = 99
+	if r, err := db.CardRevision(2, int64(len(revisions))); err != nil || fmt.Sprint(r.Card.Labels) != fmt.Sprint([]int64{red.ID, blue.ID}) {
+		t.Errorf("expected the labels of the revision unchanged but %+v was obtained (%v)", r, err)
+	}
+	if _, err = db.AttachLabel(1, blue.ID, 5); err != database.ErrVersionMismatch {
+		t.Errorf("expected %v but %v was obtained", database.ErrVersionMismatch, err)
+	}
+	if _, err = db.AttachLabel(1, blue.ID+100, 0); err != database.ErrLabelNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrLabelNotFound, err)
+	}
+	if _, err = db.AttachLabel(100, blue.ID, 0); err != database.ErrCardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if err = db.RemoveCard(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	table := []struct {
+		query    database.Query
+		expected []int64
+	}{
+		{database.Query{Labels: []string{"red"}}, []int64{1, 2}},
+		{database.Query{Labels: []string{"red", "blue"}}, []int64{2}},
+		{database.Query{Labels: []string{"red", "blue"}, LabelOp: "or"}, []int64{1, 2}},
+		{database.Query{Labels: []string{"red", "green"}}, []int64{}},
+		{database.Query{Labels: []string{"blue", "green"}, LabelOp: "or", Sort: "-id"}, []int64{2}},
+	}
+	for _, data := range table {
+		page, err := db.QueryCards(data.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obtained := []int64{}
+		for _, card := range page.Cards {
+			obtained = append(obtained, card.ID)
+		}
+		if fmt.Sprint(obtained) != fmt.Sprint(data.expected) {
+			t.Errorf("%+v: expected %v but %v was obtained", data.query, data.expected, obtained)
+		}
+	}
+	if _, err = db.QueryCards(database.Query{LabelOp: "xor"}); err != database.ErrInvalidLabelOp {
+		t.Errorf("expected %v but %v was obtained", database.ErrInvalidLabelOp, err)
+	}
+
+	if card, err = db.DetachLabel(2, red.ID, 0); err != nil || fmt.Sprint(card.Labels) != fmt.Sprint([]int64{blue.ID}) {
+		t.Errorf("expected card 2 only with blue but %+v was obtained (%v)", card, err)
+	}
+	if err = db.RemoveLabel(blue.ID); err != nil {
+		t.Fatal(err)
+	}
+	if card, _ = db.GetCard(2); len(card.Labels) != 0 || card.Version != 5 {
+		t.Errorf("expected card 2 without labels on version 5 but %+v was obtained", card)
+	}
+	if trash, _ := db.TrashedCards(); len(trash) != 1 || len(trash[0].Labels) != 0 {
+		t.Errorf("expected the trashed card without labels but %+v was obtained", trash)
+	}
+	revisions, _ = db.CardHistory(3)
+	if last := revisions[len(revisions)-1]; last.Op != database.RevisionUnlabel {
+		t.Errorf("expected the unlabel in the history but %+v was obtained", last)
+	}
+	if labels, _ := db.AllLabels(); len(labels) != 1 || labels[0].Name != "red" {
+		t.Errorf("expected only red but %v was obtained", labels)
+	}
+}
+
+func testReminders(t *testing.T, db database.Database) {
+	now := time.Now().Truncate(time.Second)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	// 1 is overdue, 2 is due later, 3 has no date
+	for _, card := range []*cards.Card{
+		{Title: "past", Text: "text", DueAt: at(-time.Hour), RemindAt: at(-2 * time.Hour)},
+		{Title: "future", Text: "text", DueAt: at(time.Hour), RemindAt: at(-time.Minute)},
+		{Title: "none", Text: "text"},
+	} {
+		if err := db.CreateCard(card); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, err := db.QueryCards(database.Query{DueBefore: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Cards) != 1 || page.Cards[0].ID != 1 || !page.Cards[0].DueAt.Equal(*at(-time.Hour)) {
+		t.Errorf("expected card 1 due an hour ago but %+v was obtained", page.Cards)
+	}
+
+	due, err := db.DueReminders(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].ID != 1 || due[1].ID != 2 {
+		t.Fatalf("expected reminders of cards 1 and 2 but %v was obtained", due)
+	}
+	for _, card := range due {
+		if err = db.MarkReminded(card.ID, *card.RemindAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if due, _ = db.DueReminders(now); len(due) != 0 {
+		t.Errorf("expected no pending reminders but %v was obtained", due)
+	}
+	card, _ := db.GetCard(2)
+	if !card.Reminded || card.Version != 1 {
+		t.Errorf("expected card 2 reminded on version 1 but %+v was obtained", card)
+	}
+
+	// a new remind_at is pending again, any other change is not
+	if _, err = db.UpdateCard(&cards.Card{ID: 1, DueAt: at(-time.Hour), RemindAt: at(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.UpdateCard(&cards.Card{ID: 2, DueAt: at(time.Hour), RemindAt: at(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ = db.DueReminders(now); len(due) != 1 || due[0].ID != 2 {
+		t.Errorf("expected the reminder of card 2 but %v was obtained", due)
+	}
+	// a late mark of the old remind_at is ignored
+	if err = db.MarkReminded(2, *at(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ = db.DueReminders(now); len(due) != 1 {
+		t.Errorf("expected the reminder of card 2 still pending but %v was obtained", due)
+	}
+	// trashed cards are not reminded
+	if err = db.RemoveCard(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ = db.DueReminders(now); len(due) != 0 {
+		t.Errorf("expected no pending reminders but %v was obtained", due)
+	}
+	if err = db.MarkReminded(2, *at(-time.Second)); err != database.ErrCardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+}
+
+func testUsers(t *testing.T, db database.Database) {
+	alice := &database.Account{User: cards.User{Name: "alice"}, PasswordHash: []byte("hash")}
+	if err := db.CreateUser(alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.ID == 0 {
+		t.Errorf("expected an id for the user")
+	}
+	if err := db.CreateUser(&database.Account{User: cards.User{Name: "alice"}}); err != database.ErrUserExists {
+		t.Errorf("expected %v but %v was obtained", database.ErrUserExists, err)
+	}
+	account, err := db.GetAccount("alice")
+	if err != nil || !reflect.DeepEqual(account, alice) {
+		t.Errorf("expected %+v but %+v was obtained (%v)", alice, account, err)
+	}
+	if _, err = db.GetAccount("bob"); err != database.ErrUserNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrUserNotFound, err)
+	}
+
+	if err = db.CreateToken(alice.ID, "old", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateToken(alice.ID, "valid", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.TokenUser("valid")
+	if err != nil || *user != alice.User {
+		t.Errorf("expected %+v but %+v was obtained (%v)", alice.User, user, err)
+	}
+	for _, hash := range []string{"old", "unknown"} {
+		if _, err = db.TokenUser(hash); err != database.ErrTokenNotFound {
+			t.Errorf("%s: expected %v but %v was obtained", hash, database.ErrTokenNotFound, err)
+		}
+	}
+	if err = db.RemoveToken("valid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.TokenUser("valid"); err != database.ErrTokenNotFound {
+		t.Errorf("expected %v after removing but %v was obtained", database.ErrTokenNotFound, err)
+	}
+	if err = db.RemoveToken("valid"); err != database.ErrTokenNotFound {
+		t.Errorf("expected %v removing twice but %v was obtained", database.ErrTokenNotFound, err)
+	}
+}
+
+func testClaimOrphans(t *testing.T, db database.Database) {
+	// made before the users, by the views of owner zero
+	live := mustCreate(t, db, "live", "text")
+	trashed := mustCreate(t, db, "trashed", "text")
+	if err := db.RemoveCard(trashed.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	board := &cards.Board{Name: "board"}
+	if err := db.CreateBoard(board); err != nil {
+		t.Fatal(err)
+	}
+	label := &cards.Label{Name: "red"}
+	if err := db.CreateLabel(label); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, db.For(2), "owned", "text")
+
+	// alice has a label of the same name, so nothing is claimed
+	if err := db.For(1).CreateLabel(&cards.Label{Name: "red"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.ClaimOrphans(1); err != database.ErrLabelExists || n != 0 {
+		t.Errorf("expected %v but %d and %v were obtained", database.ErrLabelExists, n, err)
+	}
+	if all := db.For(1).AllCards(); len(all) != 0 {
+		t.Errorf("expected no card of alice but %v was obtained", all)
+	}
+
+	n, err := db.ClaimOrphans(3)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 cards claimed but %d was obtained (%v)", n, err)
+	}
+	carol := db.For(3)
+	if all := carol.AllCards(); len(all) != 1 || all[0].ID != live.ID {
+		t.Errorf("expected the live card but %v was obtained", all)
+	}
+	if trash, err := carol.TrashedCards(); err != nil || len(trash) != 1 || trash[0].ID != trashed.ID {
+		t.Errorf("expected the trashed card but %v was obtained (%v)", trash, err)
+	}
+	if boards, err := carol.AllBoards(); err != nil || len(boards) != 1 || boards[0].ID != board.ID {
+		t.Errorf("expected the board but %v was obtained (%v)", boards, err)
+	}
+	if labels, err := carol.AllLabels(); err != nil || len(labels) != 1 || labels[0].ID != label.ID {
+		t.Errorf("expected the label but %v was obtained (%v)", labels, err)
+	}
+	if owned := db.For(2).AllCards(); len(owned) != 1 {
+		t.Errorf("expected the card of bob to stay with bob but %v was obtained", owned)
+	}
+	// the history of the claimed cards comes with them
+	for _, id := range []int64{live.ID, trashed.ID} {
+		revisions, err := carol.CardHistory(id)
+		if err != nil || len(revisions) == 0 || revisions[0].Card.OwnerID != 3 {
+			t.Errorf("expected the history of card %d but %v was obtained (%v)", id, revisions, err)
+		}
+		if r, err := carol.CardRevision(id, 1); err != nil || r.Card.OwnerID != 3 {
+			t.Errorf("expected revision 1 of card %d but %+v was obtained (%v)", id, r, err)
+		}
+	}
+	if _, err = db.For(1).CardHistory(live.ID); err != database.ErrCardNotFound {
+		t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if n, err = db.ClaimOrphans(3); err != nil || n != 0 {
+		t.Errorf("expected nothing left to claim but %d was obtained (%v)", n, err)
+	}
+}
+
+func testOwnership(t *testing.T, db database.Database) {
+	alice, bob := db.For(1).As("alice"), db.For(2).As("bob")
+	mine := mustCreate(t, alice, "mine", "text")
+	if mine.OwnerID != 1 {
+		t.Errorf("expected the card of owner 1 but %d was obtained", mine.OwnerID)
+	}
+	theirs := mustCreate(t, bob, "theirs", "text")
+
+	// bob does not see nor change the card of alice
+	if _, err := bob.GetCard(mine.ID); err != database.ErrCardNotFound {
+		t.Errorf("GetCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if _, err := bob.UpdateCard(&cards.Card{ID: mine.ID, Title: "stolen"}); err != database.ErrCardNotFound {
+		t.Errorf("UpdateCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if err := bob.RemoveCard(mine.ID, 0); err != database.ErrCardNotFound {
+		t.Errorf("RemoveCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if _, err := bob.CardHistory(mine.ID); err != database.ErrCardNotFound {
+		t.Errorf("CardHistory: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if _, err := bob.CardRevision(mine.ID, 1); err != database.ErrCardNotFound {
+		t.Errorf("CardRevision: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	for name, view := range map[string]database.Database{"alice": alice, "bob": bob} {
+		page, err := view.QueryCards(database.Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if all := view.AllCards(); len(page.Cards) != 1 || len(all) != 1 || page.Cards[0].ID != all[0].ID {
+			t.Errorf("%s: expected only its card but %v and %v were obtained", name, page.Cards, all)
+		}
+	}
+	// the database itself sees everything
+	if all := db.AllCards(); len(all) != 2 {
+		t.Errorf("expected both cards but %v was obtained", all)
+	}
+
+	// trash
+	if err := alice.RemoveCard(mine.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if trash, _ := bob.TrashedCards(); len(trash) != 0 {
+		t.Errorf("expected an empty trash for bob but %v was obtained", trash)
+	}
+	if _, err := bob.RestoreCard(mine.ID); err != database.ErrCardNotFound {
+		t.Errorf("RestoreCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if err := bob.PurgeCard(mine.ID); err != database.ErrCardNotFound {
+		t.Errorf("PurgeCard: expected %v but %v was obtained", database.ErrCardNotFound, err)
+	}
+	if purged, _ := bob.PurgeTrash(time.Now().Add(time.Hour)); purged != 0 {
+		t.Errorf("expected bob to purge nothing but %d were purged", purged)
+	}
+	if _, err := alice.RestoreCard(mine.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// boards and lists
+	board := &cards.Board{Name: "board"}
+	if err := alice.CreateBoard(board); err != nil {
+		t.Fatal(err)
+	}
+	list := &cards.List{Name: "todo", BoardID: board.ID}
+	if err := alice.CreateList(list); err != nil {
+		t.Fatal(err)
+	}
+	if boards, _ := bob.AllBoards(); len(boards) != 0 {
+		t.Errorf("expected no boards for bob but %v was obtained", boards)
+	}
+	if _, err := bob.GetBoard(board.ID); err != database.ErrBoardNotFound {
+		t.Errorf("GetBoard: expected %v but %v was obtained", database.ErrBoardNotFound, err)
+	}
+	if err := bob.CreateList(&cards.List{Name: "mine", BoardID: board.ID}); err != database.ErrBoardNotFound {
+		t.Errorf("CreateList: expected %v but %v was obtained", database.ErrBoardNotFound, err)
+	}
+	if _, err := bob.GetList(list.ID); err != database.ErrListNotFound {
+		t.Errorf("GetList: expected %v but %v was obtained", database.ErrListNotFound, err)
+	}
+	if err := bob.CreateCard(&cards.Card{Title: "title", Text: "text", ListID: list.ID}); err != database.ErrListNotFound {
+		t.Errorf("CreateCard: expected %v but %v was obtained", database.ErrListNotFound, err)
+	}
+	if _, err := bob.MoveCard(theirs.ID, list.ID, 0, 0); err != database.ErrListNotFound {
+		t.Errorf("MoveCard: expected %v but %v was obtained", database.ErrListNotFound, err)
+	}
+	if _, err := alice.MoveCard(mine.ID, list.ID, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// labels, whose names are unique only for each owner
+	red := &cards.Label{Name: "red"}
+	if err := alice.CreateLabel(red); err != nil {
+		t.Fatal(err)
+	}
+	bobRed := &cards.Label{Name: "red"}
+	if err := bob.CreateLabel(bobRed); err != nil {
+		t.Fatalf("expected a red label for bob too but %v was obtained", err)
+	}
+	if labels, _ := bob.AllLabels(); len(labels) != 1 || labels[0].ID != bobRed.ID {
+		t.Errorf("expected only the red of bob but %v was obtained", labels)
+	}
+	if _, err := bob.AttachLabel(theirs.ID, red.ID, 0); err != database.ErrLabelNotFound {
+		t.Errorf("AttachLabel: expected %v but %v was obtained", database.ErrLabelNotFound, err)
+	}
+	if _, err := alice.AttachLabel(mine.ID, red.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.AttachLabel(theirs.ID, bobRed.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	page, err := alice.QueryCards(database.Query{Labels: []string{"red"}})
+	if err != nil || len(page.Cards) != 1 || page.Cards[0].ID != mine.ID {
+		t.Errorf("expected only the red card of alice but %+v was obtained (%v)", page, err)
+	}
+
+	// reminders
+	past := time.Now().Add(-time.Minute)
+	if _, err = alice.UpdateCard(&cards.Card{ID: mine.ID, RemindAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := bob.DueReminders(time.Now()); len(due) != 0 {
+		t.Errorf("expected no reminders for bob but %v was obtained", due)
+	}
+	if due, _ := db.DueReminders(time.Now()); len(due) != 1 {
+		t.Errorf("expected the reminder of alice but %v was obtained", due)
+	}
+}
+
+func testBatch(t *testing.T, db database.Database) {
+	kept := mustCreate(t, db, "kept", "text")
+	failed := errors.New("failed")
+
+	// a failed batch leaves no trace
+	err := db.Batch(func(tx database.Database) error {
+		mustCreate(t, tx, "gone", "text")
+		if _, err := tx.UpdateCard(&cards.Card{ID: kept.ID, Title: "changed"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(tx.AllCards()) != 2 {
+			t.Errorf("expected the batch to see its own card")
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("expected the error of the batch but %v was obtained", err)
+	}
+	if all := db.AllCards(); len(all) != 1 || all[0].Title != "kept" || all[0].Version != 1 {
+		t.Fatalf("expected only the card as it was but %v was obtained", all)
+	}
+	if history, _ := db.CardHistory(kept.ID); len(history) != 1 {
+		t.Errorf("expected the changes of the batch out of the history but %d revisions were obtained", len(history))
+	}
+
+	// the changes of a successful batch are kept together, even when
+	// some of its operations fail
+	var created *cards.Card
+	err = db.For(1).As("batch").Batch(func(tx database.Database) error {
+		created = mustCreate(t, tx, "created", "text")
+		if _, err := tx.UpdateCard(&cards.Card{ID: created.ID, Done: true, Version: 1}); err != nil {
+			return err
+		}
+		if _, err := tx.UpdateCard(&cards.Card{ID: created.ID, Title: "stale", Version: 1}); err != database.ErrVersionMismatch {
+			t.Errorf("expected %v but %v was obtained", database.ErrVersionMismatch, err)
+		}
+		// the view is of owner 1, kept is not seen
+		if err := tx.RemoveCard(kept.ID, 0); err != database.ErrCardNotFound {
+			t.Errorf("expected %v but %v was obtained", database.ErrCardNotFound, err)
+		}
+		// a nested batch that fails only undoes its own changes
+		err := tx.Batch(func(tx database.Database) error {
+			mustCreate(t, tx, "nested", "text")
+			return failed
+		})
+		if err != failed {
+			t.Errorf("expected the error of the nested batch but %v was obtained", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.GetCard(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "created" || !stored.Done || stored.Version != 2 || stored.OwnerID != 1 {
+		t.Errorf("expected the card created and done by the batch but %+v was obtained", stored)
+	}
+	if all := db.AllCards(); len(all) != 2 {
+		t.Errorf("expected 2 cards but %v was obtained", all)
+	}
+	history, err := db.CardHistory(created.ID)
+	if err != nil || len(history) != 2 || history[1].Author != "batch" {
+		t.Errorf("expected 2 revisions by the batch but %v was obtained (%v)", history, err)
+	}
+}
+
+func testConcurrency(t *testing.T, db database.Database) {
+	const workers, perWorker = 8, 20
+	var wg sync.WaitGroup
+	ids := make(chan int64, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				card := &cards.Card{Title: "title", Text: "text"}
+				if err := db.CreateCard(card); err != nil {
+					t.Error(err)
+					return
+				}
+				ids <- card.ID
+				if _, err := db.UpdateCard(&cards.Card{ID: card.ID, Done: true}); err != nil {
+					t.Error(err)
+				}
+				db.AllCards()
+				db.GetCard(card.ID)
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := map[int64]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("id %d was handed out twice", id)
+		}
+		seen[id] = true
+	}
+	if all := db.AllCards(); len(all) != workers*perWorker {
+		t.Errorf("expected %d cards but %d was obtained", workers*perWorker, len(all))
+	}
+
+	// concurrent updates of the same card do not lose versions
+	card := mustCreate(t, db, "title", "text")
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := db.UpdateCard(&cards.Card{ID: card.ID, Title: "title"}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stored, err := db.GetCard(card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != workers*perWorker+1 {
+		t.Errorf("expected version %d but %d was obtained", workers*perWorker+1, stored.Version)
+	}
+}
+
+func testPing(t *testing.T, db database.Database) {
+	if err := db.Ping(); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if err := db.For(1).As("alice").Ping(); err != nil {
+		t.Errorf("ping of a view: %v", err)
+	}
+	err := db.Batch(func(tx database.Database) error {
+		return tx.Ping()
+	})
+	if err != nil {
+		t.Errorf("ping in a batch: %v", err)
+	}
+}
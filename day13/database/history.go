@@ -0,0 +1,117 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// ErrRevisionNotFound raised when a card does not have the revision
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// operations recorded in the history
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionPurge   = "purge"
+	RevisionMove    = "move"
+	RevisionLabel   = "label"
+	RevisionUnlabel = "unlabel"
+)
+
+// Revision is a change made on a card
+type Revision struct {
+	CardID int64     `json:"card_id"`
+	Rev    int64     `json:"rev"`
+	Op     string    `json:"op"`
+	Author string    `json:"author"`
+	At     time.Time `json:"at"`
+	// Changes are the fields that changed
+	Changes []Change `json:"changes"`
+	// Card is how the card was after the change, or before it was purged
+	Card *cards.Card `json:"card"`
+}
+
+// Change is the old and new value of a field, nil when the card did not exist
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// fields are the values of a card tracked by the history
+func fields(card *cards.Card) map[string]interface{} {
+	if card == nil {
+		return map[string]interface{}{}
+	}
+	values := map[string]interface{}{
+		"title":      card.Title,
+		"text":       card.Text,
+		"done":       card.Done,
+		"deleted_at": nil,
+	}
+	// cards out of lists have no position
+	if card.ListID != 0 {
+		values["list_id"] = card.ListID
+		values["position"] = card.Position
+	}
+	for field, at := range map[string]*time.Time{"due_at": card.DueAt, "remind_at": card.RemindAt} {
+		if at != nil {
+			values[field] = at.UTC().Format(time.RFC3339)
+		}
+	}
+	if len(card.Labels) > 0 {
+		values["labels"] = fmt.Sprint(card.Labels)
+	}
+	if card.DeletedAt != nil {
+		values["deleted_at"] = card.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	return values
+}
+
+// diff lists what changed from old to new, any of them can be nil
+func diff(old, new *cards.Card) []Change {
+	changes := []Change{}
+	before, after := fields(old), fields(new)
+	for _, field := range []string{"title", "text", "done", "list_id", "position", "labels", "due_at", "remind_at", "deleted_at"} {
+		if before[field] != after[field] {
+			changes = append(changes, Change{Field: field, Old: before[field], New: after[field]})
+		}
+	}
+	return changes
+}
+
+// newRevision describes the change op from old to new as revision rev,
+// old is nil on create and new is nil on purge
+func newRevision(rev int64, op, author string, old, new *cards.Card) *Revision {
+	card := new
+	if card == nil {
+		card = old
+	}
+	c := *card
+	return &Revision{
+		CardID:  c.ID,
+		Rev:     rev,
+		Op:      op,
+		Author:  author,
+		At:      time.Now().UTC(),
+		Changes: diff(old, new),
+		Card:    &c,
+	}
+}
+
+// copy returns a revision that can be changed without changing r
+func (r *Revision) copy() *Revision {
+	c := *r
+	c.Changes = append([]Change{}, r.Changes...)
+	if r.Card != nil {
+		card := *r.Card
+		card.Labels = append([]int64(nil), r.Card.Labels...)
+		c.Card = &card
+	}
+	return &c
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+var (
+	// ErrLabelNotFound raised when a label is not found
+	ErrLabelNotFound = errors.New("label not found")
+	// ErrLabelExists raised when another label has the same name
+	ErrLabelExists = errors.New("label name already in use")
+)
+
+// Labels methods that all database have to implement to tag cards.
+// Label names are unique for each owner. Attaching and detaching
+// labels are changes of the card, with a new version and a revision,
+// and only happen if the version matches, zero means any version.
+// Attaching twice or detaching a label that is not there leaves the
+// card as it is.
+// RemoveLabel detaches the label from every card, even trashed ones.
+type Labels interface {
+	CreateLabel(label *cards.Label) error
+	AllLabels() ([]*cards.Label, error)
+	GetLabel(id int64) (*cards.Label, error)
+	UpdateLabel(label *cards.Label) (*cards.Label, error)
+	RemoveLabel(id int64) error
+	AttachLabel(id, labelID, version int64) (*cards.Card, error)
+	DetachLabel(id, labelID, version int64) (*cards.Card, error)
+}
+
+// withLabel returns a new sorted list of label ids with labelID
+func withLabel(labels []int64, labelID int64) []int64 {
+	index := sort.Search(len(labels), func(i int) bool { return labels[i] >= labelID })
+	if index < len(labels) && labels[index] == labelID {
+		return labels
+	}
+	result := make([]int64, 0, len(labels)+1)
+	result = append(result, labels[:index]...)
+	result = append(result, labelID)
+	return append(result, labels[index:]...)
+}
+
+// withoutLabel returns a new list of label ids without labelID
+func withoutLabel(labels []int64, labelID int64) []int64 {
+	result := []int64{}
+	for _, id := range labels {
+		if id != labelID {
+			result = append(result, id)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// hasLabel tells if labelID is in the list
+func hasLabel(labels []int64, labelID int64) bool {
+	for _, id := range labels {
+		if id == labelID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// unlocked is the lock of the views of a batch, the batch already
+// holds the lock of the store
+type unlocked struct{}
+
+func (unlocked) Lock()    {}
+func (unlocked) Unlock()  {}
+func (unlocked) RLock()   {}
+func (unlocked) RUnlock() {}
+
+// Batch runs fn while holding the lock, with a view that does not take
+// it. The entries fn commits are applied right away, each one with how
+// to undo it. When fn succeeds they are logged as a single entry, when
+// it fails they are undone, the last one first. A batch run by the
+// view of another batch is part of it and only undoes its own entries
+func (m *MemoryDB) Batch(fn func(tx Database) error) error {
+	// only the views of a batch go without the lock, the store is
+	// not looked at before the lock is held
+	if _, nested := m.mu.(unlocked); nested {
+		mark := len(m.undo)
+		if err := fn(m); err != nil {
+			m.rollback(mark)
+			return err
+		}
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batching = true
+	defer func() {
+		m.batching, m.pending, m.undo = false, nil, nil
+	}()
+	tx := &MemoryDB{memoryStore: m.memoryStore, mu: unlocked{}, author: m.author, owner: m.owner}
+	if err := fn(tx); err != nil {
+		m.rollback(0)
+		return err
+	}
+	if len(m.pending) == 0 {
+		return nil
+	}
+	// the entries are applied already, applying them again changes nothing
+	if err := m.write(logEntry{Op: opBatch, Batch: m.pending}); err != nil {
+		m.rollback(0)
+		return err
+	}
+	return nil
+}
+
+// rollback undoes the entries of the batch from mark on.
+// Callers must hold the lock
+func (m *MemoryDB) rollback(mark int) {
+	for i := len(m.undo) - 1; i >= mark; i-- {
+		m.undo[i]()
+	}
+	m.undo, m.pending = m.undo[:mark], m.pending[:mark]
+}
+
+// undoOf returns how to bring back what entry is about to change. The
+// records are replaced and never changed in place, so keeping the ones
+// replaced is enough. Callers must hold the lock
+func (m *MemoryDB) undoOf(entry logEntry) func() {
+	index, boardIndex, listIndex, labelIndex, userIndex := m.index, m.boardIndex, m.listIndex, m.labelIndex, m.userIndex
+	counts := m.counts
+	restore := m.restoreOf(entry)
+	return func() {
+		restore()
+		m.index, m.boardIndex, m.listIndex, m.labelIndex, m.userIndex = index, boardIndex, listIndex, labelIndex, userIndex
+		m.counts = counts
+	}
+}
+
+// restoreOf returns how to put back the records entry touches as they
+// are now. Callers must hold the lock
+func (m *MemoryDB) restoreOf(entry logEntry) func() {
+	switch entry.Op {
+	case opCreate, opUpdate, opTrash, opRestore, opRemove, opPurge:
+		id := entry.ID
+		if entry.Card != nil {
+			id = entry.Card.ID
+		}
+		_, live := m.find(id)
+		at, trashed := findIn(m.trash, id)
+		revisions := len(m.history[id])
+		var labels []int64
+		if stored := m.stored(id); stored != nil {
+			labels = stored.Labels
+		}
+		return func() {
+			// the labels of the card as it is now are dropped from the index
+			m.relabel(id, labels)
+			m.cardList, m.trash = without(m.cardList, id), without(m.trash, id)
+			if live != nil {
+				m.insertLive(live)
+			}
+			if trashed != nil {
+				m.trash = append(m.trash, nil)
+				copy(m.trash[at+1:], m.trash[at:])
+				m.trash[at] = trashed
+			}
+			if revisions == 0 {
+				delete(m.history, id)
+			} else {
+				m.history[id] = m.history[id][:revisions]
+			}
+		}
+	case opClaim:
+		revisions, ok := m.history[entry.ID]
+		return func() {
+			if ok {
+				m.history[entry.ID] = revisions
+			}
+		}
+	case opBoard, opRemoveBoard:
+		id := entry.ID
+		if entry.Board != nil {
+			id = entry.Board.ID
+		}
+		at, board := m.findBoard(id)
+		return func() {
+			if i, _ := m.findBoard(id); i >= 0 {
+				m.boards = append(m.boards[:i], m.boards[i+1:]...)
+			}
+			if board != nil {
+				m.boards = append(m.boards, nil)
+				copy(m.boards[at+1:], m.boards[at:])
+				m.boards[at] = board
+			}
+		}
+	case opList, opRemoveList:
+		id := entry.ID
+		if entry.List != nil {
+			id = entry.List.ID
+		}
+		at, list := m.findList(id)
+		return func() {
+			if i, _ := m.findList(id); i >= 0 {
+				m.lists = append(m.lists[:i], m.lists[i+1:]...)
+			}
+			if list != nil {
+				m.lists = append(m.lists, nil)
+				copy(m.lists[at+1:], m.lists[at:])
+				m.lists[at] = list
+			}
+		}
+	case opLabel, opRemoveLabel:
+		id := entry.ID
+		if entry.Label != nil {
+			id = entry.Label.ID
+		}
+		at, label := m.findLabel(id)
+		labelled := m.labelled[id]
+		return func() {
+			if i, _ := m.findLabel(id); i >= 0 {
+				m.labels = append(m.labels[:i], m.labels[i+1:]...)
+			}
+			if label != nil {
+				m.labels = append(m.labels, nil)
+				copy(m.labels[at+1:], m.labels[at:])
+				m.labels[at] = label
+			}
+			if labelled != nil {
+				m.labelled[id] = labelled
+			}
+		}
+	case opUser:
+		id := entry.Account.ID
+		at := m.findAccount(id)
+		var account *Account
+		if at >= 0 {
+			account = m.accounts[at]
+		}
+		return func() {
+			if i := m.findAccount(id); i >= 0 {
+				m.accounts = append(m.accounts[:i], m.accounts[i+1:]...)
+			}
+			if account != nil {
+				m.accounts = append(m.accounts, nil)
+				copy(m.accounts[at+1:], m.accounts[at:])
+				m.accounts[at] = account
+			}
+		}
+	case opToken, opRemoveToken:
+		hash := entry.Token.Hash
+		token, ok := m.tokens[hash]
+		return func() {
+			if ok {
+				m.tokens[hash] = token
+			} else {
+				delete(m.tokens, hash)
+			}
+		}
+	case opBatch:
+		// the entries of a batch touch different records, so each one
+		// is put back as it is before any of them
+		restores := make([]func(), len(entry.Batch))
+		for i, e := range entry.Batch {
+			restores[i] = m.restoreOf(e)
+		}
+		return func() {
+			for i := len(restores) - 1; i >= 0; i-- {
+				restores[i]()
+			}
+		}
+	}
+	return func() {}
+}
+
+// insertLive puts a card among the live ones, which are kept in id order.
+// Callers must hold the lock
+func (m *MemoryDB) insertLive(card *cards.Card) {
+	index := sort.Search(len(m.cardList), func(i int) bool { return m.cardList[i].ID > card.ID })
+	m.cardList = append(m.cardList, nil)
+	copy(m.cardList[index+1:], m.cardList[index:])
+	m.cardList[index] = card
+}
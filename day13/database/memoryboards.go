@@ -0,0 +1,286 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// findBoard returns the position of a board, -1 when not found.
+// Callers must hold the lock
+func (m *MemoryDB) findBoard(id int64) (int, *cards.Board) {
+	for index, board := range m.boards {
+		if board.ID == id {
+			return index, board
+		}
+	}
+	return -1, nil
+}
+
+// findList returns the position of a list, -1 when not found.
+// Callers must hold the lock
+func (m *MemoryDB) findList(id int64) (int, *cards.List) {
+	for index, list := range m.lists {
+		if list.ID == id {
+			return index, list
+		}
+	}
+	return -1, nil
+}
+
+// ownedBoard returns a board the view sees, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) ownedBoard(id int64) *cards.Board {
+	if _, board := m.findBoard(id); board != nil && m.owns(board.OwnerID) {
+		return board
+	}
+	return nil
+}
+
+// ownedList returns a list of a board the view sees, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) ownedList(id int64) *cards.List {
+	if _, list := m.findList(id); list != nil && m.ownedBoard(list.BoardID) != nil {
+		return list
+	}
+	return nil
+}
+
+// listCards returns the live cards of a list sorted by position,
+// leaving out the card skip. Callers must hold the lock
+func (m *MemoryDB) listCards(listID, skip int64) []*cards.Card {
+	cardList := []*cards.Card{}
+	for _, card := range m.cardList {
+		if card.ListID == listID && card.ID != skip {
+			cardList = append(cardList, card)
+		}
+	}
+	sort.Slice(cardList, func(i, j int) bool {
+		if cardList[i].Position != cardList[j].Position {
+			return cardList[i].Position < cardList[j].Position
+		}
+		return cardList[i].ID < cardList[j].ID
+	})
+	return cardList
+}
+
+// CreateBoard appends a board
+func (m *MemoryDB) CreateBoard(board *cards.Board) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	created := *board
+	created.ID = m.boardIndex + 1
+	created.OwnerID = m.owner
+	if err := m.commit(logEntry{Op: opBoard, Board: &created}); err != nil {
+		return err
+	}
+	board.ID, board.OwnerID = created.ID, created.OwnerID
+	return nil
+}
+
+// AllBoards returns every board
+func (m *MemoryDB) AllBoards() ([]*cards.Board, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	boards := make([]*cards.Board, 0, len(m.boards))
+	for _, board := range m.boards {
+		if m.owns(board.OwnerID) {
+			b := *board
+			boards = append(boards, &b)
+		}
+	}
+	return boards, nil
+}
+
+// GetBoard retrieves a board
+func (m *MemoryDB) GetBoard(id int64) (*cards.Board, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	board := m.ownedBoard(id)
+	if board == nil {
+		return nil, ErrBoardNotFound
+	}
+	b := *board
+	return &b, nil
+}
+
+// UpdateBoard renames a board
+func (m *MemoryDB) UpdateBoard(new *cards.Board) (*cards.Board, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.ownedBoard(new.ID)
+	if stored == nil {
+		return nil, ErrBoardNotFound
+	}
+	board := *stored
+	if new.Name != "" {
+		board.Name = new.Name
+	}
+	if err := m.commit(logEntry{Op: opBoard, Board: &board}); err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// RemoveBoard removes an empty board
+func (m *MemoryDB) RemoveBoard(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ownedBoard(id) == nil {
+		return ErrBoardNotFound
+	}
+	for _, list := range m.lists {
+		if list.BoardID == id {
+			return ErrBoardNotEmpty
+		}
+	}
+	return m.commit(logEntry{Op: opRemoveBoard, ID: id})
+}
+
+// CreateList appends a list to a board
+func (m *MemoryDB) CreateList(list *cards.List) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ownedBoard(list.BoardID) == nil {
+		return ErrBoardNotFound
+	}
+	created := *list
+	created.ID = m.listIndex + 1
+	if created.Position == 0 {
+		// goes to the end of the board
+		created.Position = 1
+		for _, l := range m.lists {
+			if l.BoardID == list.BoardID && l.Position >= created.Position {
+				created.Position = l.Position + 1
+			}
+		}
+	}
+	if err := m.commit(logEntry{Op: opList, List: &created}); err != nil {
+		return err
+	}
+	list.ID, list.Position = created.ID, created.Position
+	return nil
+}
+
+// BoardLists returns the lists of a board sorted by position
+func (m *MemoryDB) BoardLists(boardID int64) ([]*cards.List, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.ownedBoard(boardID) == nil {
+		return nil, ErrBoardNotFound
+	}
+	lists := []*cards.List{}
+	for _, list := range m.lists {
+		if list.BoardID == boardID {
+			l := *list
+			lists = append(lists, &l)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Position != lists[j].Position {
+			return lists[i].Position < lists[j].Position
+		}
+		return lists[i].ID < lists[j].ID
+	})
+	return lists, nil
+}
+
+// GetList retrieves a list
+func (m *MemoryDB) GetList(id int64) (*cards.List, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := m.ownedList(id)
+	if list == nil {
+		return nil, ErrListNotFound
+	}
+	l := *list
+	return &l, nil
+}
+
+// UpdateList renames or reorders a list
+func (m *MemoryDB) UpdateList(new *cards.List) (*cards.List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.ownedList(new.ID)
+	if stored == nil {
+		return nil, ErrListNotFound
+	}
+	list := *stored
+	if new.Name != "" {
+		list.Name = new.Name
+	}
+	if new.Position != 0 {
+		list.Position = new.Position
+	}
+	if err := m.commit(logEntry{Op: opList, List: &list}); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// RemoveList removes a list without cards
+func (m *MemoryDB) RemoveList(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ownedList(id) == nil {
+		return ErrListNotFound
+	}
+	for _, cardList := range [][]*cards.Card{m.cardList, m.trash} {
+		for _, card := range cardList {
+			if card.ListID == id {
+				return ErrListNotEmpty
+			}
+		}
+	}
+	return m.commit(logEntry{Op: opRemoveList, ID: id})
+}
+
+// MoveCard puts a card at index of a list
+func (m *MemoryDB) MoveCard(id, listID int64, index int, version int64) (*cards.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.live(id)
+	if stored == nil {
+		return nil, ErrCardNotFound
+	}
+	if version != 0 && stored.Version != version {
+		return nil, ErrVersionMismatch
+	}
+	if m.ownedList(listID) == nil {
+		return nil, ErrListNotFound
+	}
+	siblings := m.listCards(listID, id)
+	positions := make([]float64, len(siblings))
+	for i, card := range siblings {
+		positions[i] = card.Position
+	}
+	position, ok := positionAt(positions, index)
+	if !ok {
+		// no room left between the neighbours, renumber the list.
+		// The cards that change position get a new version, so the
+		// clients holding them can't write over the new order
+		positions = renumbered(len(siblings))
+		for i, sibling := range siblings {
+			if sibling.Position == positions[i] {
+				continue
+			}
+			card := *sibling
+			card.Position = positions[i]
+			card.Version++
+			entry := logEntry{Op: opUpdate, Card: &card, Revision: m.revision(RevisionMove, sibling, &card)}
+			if err := m.commit(entry); err != nil {
+				return nil, err
+			}
+		}
+		position, _ = positionAt(positions, index)
+	}
+	card := *stored
+	card.ListID = listID
+	card.Position = position
+	card.Version++
+	entry := logEntry{Op: opUpdate, Card: &card, Revision: m.revision(RevisionMove, stored, &card)}
+	if err := m.commit(entry); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// findLabel returns the position of a label, -1 when not found.
+// Callers must hold the lock
+func (m *MemoryDB) findLabel(id int64) (int, *cards.Label) {
+	for index, label := range m.labels {
+		if label.ID == id {
+			return index, label
+		}
+	}
+	return -1, nil
+}
+
+// labelNamed returns the label of owner with a name, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) labelNamed(owner int64, name string) *cards.Label {
+	for _, label := range m.labels {
+		if label.Name == name && label.OwnerID == owner {
+			return label
+		}
+	}
+	return nil
+}
+
+// ownedLabel returns a label the view sees, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) ownedLabel(id int64) *cards.Label {
+	if _, label := m.findLabel(id); label != nil && m.owns(label.OwnerID) {
+		return label
+	}
+	return nil
+}
+
+// relabel moves a card from the index of its old labels to the index
+// of labels. Callers must hold the lock
+func (m *MemoryDB) relabel(id int64, labels []int64) {
+	if card := m.stored(id); card != nil {
+		for _, labelID := range card.Labels {
+			delete(m.labelled[labelID], id)
+		}
+	}
+	for _, labelID := range labels {
+		if m.labelled[labelID] == nil {
+			m.labelled[labelID] = map[int64]bool{}
+		}
+		m.labelled[labelID][id] = true
+	}
+}
+
+// withLabels returns, in id order, the live cards with every label of
+// names when op is and, or with any of them when op is or.
+// Only the cards of the index are visited. Callers must hold the lock
+func (m *MemoryDB) withLabels(names []string, op string) []*cards.Card {
+	sets := []map[int64]bool{}
+	for _, name := range names {
+		label := m.labelNamed(m.owner, name)
+		if label == nil {
+			if op == "and" {
+				return nil
+			}
+			continue
+		}
+		sets = append(sets, m.labelled[label.ID])
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	ids := []int64{}
+	if op == "and" {
+		// walk the smallest set checking the others
+		sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+		for id := range sets[0] {
+			all := true
+			for _, set := range sets[1:] {
+				all = all && set[id]
+			}
+			if all {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		seen := map[int64]bool{}
+		for _, set := range sets {
+			for id := range set {
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	cardList := []*cards.Card{}
+	for _, id := range ids {
+		// trashed cards are in the index too
+		if _, card := m.find(id); card != nil {
+			cardList = append(cardList, card)
+		}
+	}
+	return cardList
+}
+
+// CreateLabel appends a label
+func (m *MemoryDB) CreateLabel(label *cards.Label) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.labelNamed(m.owner, label.Name) != nil {
+		return ErrLabelExists
+	}
+	created := *label
+	created.ID = m.labelIndex + 1
+	created.OwnerID = m.owner
+	if err := m.commit(logEntry{Op: opLabel, Label: &created}); err != nil {
+		return err
+	}
+	label.ID, label.OwnerID = created.ID, created.OwnerID
+	return nil
+}
+
+// AllLabels returns every label
+func (m *MemoryDB) AllLabels() ([]*cards.Label, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	labels := make([]*cards.Label, 0, len(m.labels))
+	for _, label := range m.labels {
+		if m.owns(label.OwnerID) {
+			l := *label
+			labels = append(labels, &l)
+		}
+	}
+	return labels, nil
+}
+
+// GetLabel retrieves a label
+func (m *MemoryDB) GetLabel(id int64) (*cards.Label, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	label := m.ownedLabel(id)
+	if label == nil {
+		return nil, ErrLabelNotFound
+	}
+	l := *label
+	return &l, nil
+}
+
+// UpdateLabel renames or paints a label
+func (m *MemoryDB) UpdateLabel(new *cards.Label) (*cards.Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.ownedLabel(new.ID)
+	if stored == nil {
+		return nil, ErrLabelNotFound
+	}
+	label := *stored
+	if new.Name != "" {
+		if other := m.labelNamed(label.OwnerID, new.Name); other != nil && other.ID != label.ID {
+			return nil, ErrLabelExists
+		}
+		label.Name = new.Name
+	}
+	if new.Color != "" {
+		label.Color = new.Color
+	}
+	if err := m.commit(logEntry{Op: opLabel, Label: &label}); err != nil {
+		return nil, err
+	}
+	return &label, nil
+}
+
+// RemoveLabel detaches a label from every card and removes it
+func (m *MemoryDB) RemoveLabel(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ownedLabel(id) == nil {
+		return ErrLabelNotFound
+	}
+	ids := []int64{}
+	for cardID := range m.labelled[id] {
+		ids = append(ids, cardID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, cardID := range ids {
+		stored := m.stored(cardID)
+		card := *stored
+		card.Labels = withoutLabel(card.Labels, id)
+		card.Version++
+		entry := logEntry{Op: opUpdate, Card: &card, Revision: m.revision(RevisionUnlabel, stored, &card)}
+		if card.DeletedAt != nil {
+			entry.Op = opTrash
+		}
+		if err := m.commit(entry); err != nil {
+			return err
+		}
+	}
+	return m.commit(logEntry{Op: opRemoveLabel, ID: id})
+}
+
+// AttachLabel adds a label to a live card
+func (m *MemoryDB) AttachLabel(id, labelID, version int64) (*cards.Card, error) {
+	return m.label(id, labelID, version, RevisionLabel)
+}
+
+// DetachLabel takes a label out of a live card
+func (m *MemoryDB) DetachLabel(id, labelID, version int64) (*cards.Card, error) {
+	return m.label(id, labelID, version, RevisionUnlabel)
+}
+
+// label attaches or detaches, as op says, a label
+func (m *MemoryDB) label(id, labelID, version int64, op string) (*cards.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.live(id)
+	if stored == nil {
+		return nil, ErrCardNotFound
+	}
+	if version != 0 && stored.Version != version {
+		return nil, ErrVersionMismatch
+	}
+	if m.ownedLabel(labelID) == nil {
+		return nil, ErrLabelNotFound
+	}
+	card := *stored
+	if hasLabel(card.Labels, labelID) == (op == RevisionLabel) {
+		// nothing to change
+		return &card, nil
+	}
+	if op == RevisionLabel {
+		card.Labels = withLabel(card.Labels, labelID)
+	} else {
+		card.Labels = withoutLabel(card.Labels, labelID)
+	}
+	card.Version++
+	entry := logEntry{Op: opUpdate, Card: &card, Revision: m.revision(op, stored, &card)}
+	if err := m.commit(entry); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
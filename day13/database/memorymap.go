@@ -1,69 +1,556 @@
 package database
 
-import "github.com/cassiobotaro/60-days-of-go/day13/cards"
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
 
-//MemoryDB is a database mapped in memory
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// MemoryDB is a database mapped in memory.
+// It's safe for concurrent use and, when opened with OpenMemoryDB,
+// every change is appended to a write-ahead log.
 type MemoryDB struct {
-	carList []*cards.Card
-	index   int64
+	*memoryStore
+	// mu is the lock of the store, or none in the views of a batch
+	mu locker
+	// author of the changes made through this view
+	author string
+	// owner whose things the view sees, zero sees everything
+	owner int64
+}
+
+// locker is the lock of a view
+type locker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// memoryStore is the state shared by every view of a MemoryDB
+type memoryStore struct {
+	mu       sync.RWMutex
+	cardList []*cards.Card
+	// index is the last id handed out, it never goes back
+	index int64
+	// trash has the removed cards, in the order they were removed
+	trash []*cards.Card
+	// history has the revisions of each card, in order
+	history map[int64][]*Revision
+	// boards and lists, in id order, with the last ids handed out
+	boards     []*cards.Board
+	lists      []*cards.List
+	boardIndex int64
+	listIndex  int64
+	// labels in id order, with the last id handed out
+	labels     []*cards.Label
+	labelIndex int64
+	// labelled indexes the cards, live or trashed, of each label
+	labelled map[int64]map[int64]bool
+	// accounts in id order, with the last id handed out
+	accounts  []*Account
+	userIndex int64
+	// tokens by hash
+	tokens map[string]*apiToken
+	// counts follow the cards as the entries are applied
+	counts CardCounts
+	// batching is set while a batch runs, the entries committed are
+	// kept in pending instead of logged, with how to undo each one
+	batching bool
+	pending  []logEntry
+	undo     []func()
+
+	// persistence, nil when everything lives only in memory
+	dir           string
+	log           *os.File
+	logged        int
+	snapshotEvery int
+	// closed is set by Close
+	closed bool
 }
 
 // NewMemoryDB initializes an empty memory database
 func NewMemoryDB() *MemoryDB {
-	return &MemoryDB{cardList: []*cards.Card{}}
+	store := &memoryStore{
+		cardList: []*cards.Card{},
+		trash:    []*cards.Card{},
+		history:  map[int64][]*Revision{},
+		boards:   []*cards.Board{},
+		lists:    []*cards.List{},
+		labels:   []*cards.Label{},
+		labelled: map[int64]map[int64]bool{},
+		accounts: []*Account{},
+		tokens:   map[string]*apiToken{},
+	}
+	return &MemoryDB{memoryStore: store, mu: &store.mu}
+}
+
+// As returns a view of the database whose changes are made by author
+func (m *MemoryDB) As(author string) Database {
+	return &MemoryDB{memoryStore: m.memoryStore, mu: m.mu, author: author, owner: m.owner}
+}
+
+// For returns a view of the database that only sees what owner owns
+func (m *MemoryDB) For(owner int64) Database {
+	return &MemoryDB{memoryStore: m.memoryStore, mu: m.mu, author: m.author, owner: owner}
+}
+
+// owns tells if the view sees what belongs to owner
+func (m *MemoryDB) owns(owner int64) bool {
+	return m.owner == 0 || owner == m.owner
+}
+
+// revision describes the change op from old to new made by this view.
+// Callers must hold the lock
+func (m *MemoryDB) revision(op string, old, new *cards.Card) *Revision {
+	id := new
+	if id == nil {
+		id = old
+	}
+	return newRevision(int64(len(m.history[id.ID])+1), op, m.author, old, new)
+}
+
+// find returns the position of a live card, -1 when not found.
+// Live cards are kept in id order. Callers must hold the lock
+func (m *MemoryDB) find(id int64) (int, *cards.Card) {
+	index := sort.Search(len(m.cardList), func(i int) bool { return m.cardList[i].ID >= id })
+	if index < len(m.cardList) && m.cardList[index].ID == id {
+		return index, m.cardList[index]
+	}
+	return -1, nil
+}
+
+// live returns a live card the view sees, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) live(id int64) *cards.Card {
+	if _, card := m.find(id); card != nil && m.owns(card.OwnerID) {
+		return card
+	}
+	return nil
+}
+
+// trashed returns a card in the trash the view sees, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) trashed(id int64) *cards.Card {
+	if _, card := findIn(m.trash, id); card != nil && m.owns(card.OwnerID) {
+		return card
+	}
+	return nil
+}
+
+// stored returns a live or trashed card, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) stored(id int64) *cards.Card {
+	if _, card := m.find(id); card != nil {
+		return card
+	}
+	_, card := findIn(m.trash, id)
+	return card
+}
+
+// findIn returns the position of a card in a list, -1 when not found
+func findIn(list []*cards.Card, id int64) (int, *cards.Card) {
+	for index, card := range list {
+		if card.ID == id {
+			return index, card
+		}
+	}
+	return -1, nil
+}
+
+// without returns the list without the card
+func without(list []*cards.Card, id int64) []*cards.Card {
+	if index, _ := findIn(list, id); index >= 0 {
+		return append(list[:index], list[index+1:]...)
+	}
+	return list
+}
+
+// counter is the count of the state of a live or trashed card, nil
+// when the card is not stored. Callers must hold the lock
+func (m *MemoryDB) counter(id int64) *int64 {
+	if _, card := m.find(id); card != nil {
+		if card.Done {
+			return &m.counts.Done
+		}
+		return &m.counts.Pending
+	}
+	if index, _ := findIn(m.trash, id); index >= 0 {
+		return &m.counts.Trashed
+	}
+	return nil
+}
+
+// CardCounts counts the cards of every owner
+func (m *MemoryDB) CardCounts() (CardCounts, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.counts, nil
+}
+
+// apply changes the state, it's used by the methods and by the log replay.
+// Callers must hold the lock
+func (m *MemoryDB) apply(entry logEntry) {
+	// the card leaves the count of its state and joins the count of the
+	// new one, so an entry applied twice counts once
+	counted := int64(0)
+	switch entry.Op {
+	case opCreate, opUpdate, opTrash, opRestore:
+		m.relabel(entry.Card.ID, entry.Card.Labels)
+		counted = entry.Card.ID
+	case opRemove, opPurge:
+		m.relabel(entry.ID, nil)
+		counted = entry.ID
+	}
+	if before := m.counter(counted); before != nil {
+		*before--
+	}
+	switch entry.Op {
+	case opCreate, opUpdate:
+		card := *entry.Card
+		if index, _ := m.find(card.ID); index >= 0 {
+			m.cardList[index] = &card
+		} else {
+			m.cardList = append(m.cardList, &card)
+		}
+		if card.ID > m.index {
+			m.index = card.ID
+		}
+	case opRemove:
+		m.cardList = without(m.cardList, entry.ID)
+	case opTrash:
+		card := *entry.Card
+		m.cardList = without(m.cardList, card.ID)
+		// a trashed card that changes keeps its place
+		if index, _ := findIn(m.trash, card.ID); index >= 0 {
+			m.trash[index] = &card
+		} else {
+			m.trash = append(m.trash, &card)
+		}
+	case opRestore:
+		card := *entry.Card
+		m.trash = without(m.trash, card.ID)
+		m.cardList = without(m.cardList, card.ID)
+		m.insertLive(&card)
+	case opPurge:
+		m.trash = without(m.trash, entry.ID)
+	case opClaim:
+		// the revisions are replaced, the old ones may be in an undo
+		if old, ok := m.history[entry.ID]; ok {
+			revisions := make([]*Revision, len(old))
+			for i, r := range old {
+				revisions[i] = r.copy()
+				revisions[i].Card.OwnerID = entry.Owner
+			}
+			m.history[entry.ID] = revisions
+		}
+	case opBoard:
+		board := *entry.Board
+		if index, _ := m.findBoard(board.ID); index >= 0 {
+			m.boards[index] = &board
+		} else {
+			m.boards = append(m.boards, &board)
+		}
+		if board.ID > m.boardIndex {
+			m.boardIndex = board.ID
+		}
+	case opRemoveBoard:
+		if index, _ := m.findBoard(entry.ID); index >= 0 {
+			m.boards = append(m.boards[:index], m.boards[index+1:]...)
+		}
+	case opList:
+		list := *entry.List
+		if index, _ := m.findList(list.ID); index >= 0 {
+			m.lists[index] = &list
+		} else {
+			m.lists = append(m.lists, &list)
+		}
+		if list.ID > m.listIndex {
+			m.listIndex = list.ID
+		}
+	case opRemoveList:
+		if index, _ := m.findList(entry.ID); index >= 0 {
+			m.lists = append(m.lists[:index], m.lists[index+1:]...)
+		}
+	case opLabel:
+		label := *entry.Label
+		if index, _ := m.findLabel(label.ID); index >= 0 {
+			m.labels[index] = &label
+		} else {
+			m.labels = append(m.labels, &label)
+		}
+		if label.ID > m.labelIndex {
+			m.labelIndex = label.ID
+		}
+	case opRemoveLabel:
+		if index, _ := m.findLabel(entry.ID); index >= 0 {
+			m.labels = append(m.labels[:index], m.labels[index+1:]...)
+		}
+		delete(m.labelled, entry.ID)
+	case opUser:
+		account := *entry.Account
+		if index := m.findAccount(account.ID); index >= 0 {
+			m.accounts[index] = &account
+		} else {
+			m.accounts = append(m.accounts, &account)
+		}
+		if account.ID > m.userIndex {
+			m.userIndex = account.ID
+		}
+	case opToken:
+		token := *entry.Token
+		m.tokens[token.Hash] = &token
+	case opRemoveToken:
+		delete(m.tokens, entry.Token.Hash)
+	case opBatch:
+		for _, e := range entry.Batch {
+			m.apply(e)
+		}
+	}
+	if after := m.counter(counted); after != nil {
+		*after++
+	}
+	// a replayed revision is already there
+	if r := entry.Revision; r != nil && r.Rev == int64(len(m.history[r.CardID])+1) {
+		m.history[r.CardID] = append(m.history[r.CardID], r)
+	}
+}
+
+// commit writes the entry to the log and then applies it.
+// Callers must hold the lock
+func (m *MemoryDB) commit(entry logEntry) error {
+	if m.batching {
+		m.pending = append(m.pending, entry)
+		m.undo = append(m.undo, m.undoOf(entry))
+	} else if err := m.write(entry); err != nil {
+		return err
+	}
+	m.apply(entry)
+	return nil
 }
 
 // CreateCard appends a card into array
 func (m *MemoryDB) CreateCard(card *cards.Card) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	// new id
-	m.index++
-	card.ID = m.index
-	m.cardList = append(m.cardList, card)
+	created := *card
+	created.ID = m.index + 1
+	created.Version = 1
+	created.OwnerID = m.owner
+	// labels are attached later
+	created.Labels = nil
+	created.Reminded = false
+	created.DueAt, created.RemindAt = utc(created.DueAt), utc(created.RemindAt)
+	if created.ListID != 0 {
+		if m.ownedList(created.ListID) == nil {
+			return ErrListNotFound
+		}
+		// goes to the end of the list
+		created.Position = 1
+		if siblings := m.listCards(created.ListID, 0); len(siblings) > 0 {
+			created.Position = siblings[len(siblings)-1].Position + 1
+		}
+	}
+	entry := logEntry{Op: opCreate, Card: &created, Revision: m.revision(RevisionCreate, nil, &created)}
+	if err := m.commit(entry); err != nil {
+		return err
+	}
+	card.ID, card.Version, card.Position, card.Labels = created.ID, created.Version, created.Position, nil
+	card.OwnerID = created.OwnerID
+	card.DueAt, card.RemindAt = created.DueAt, created.RemindAt
 	return nil
 }
 
 // AllCards returns a list with all cards
 func (m *MemoryDB) AllCards() []*cards.Card {
-	return m.cardList
-}
-
-// GetCard retrieves a card
-func (m *MemoryDB) GETCard(id int64) (*cards.Card, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cardList := make([]*cards.Card, 0, len(m.cardList))
 	for _, card := range m.cardList {
-		if card.ID == id {
-			return card, nil
+		if m.owns(card.OwnerID) {
+			c := *card
+			cardList = append(cardList, &c)
 		}
 	}
-	return nil, ErrCardNotFound
+	return cardList
 }
 
-// RemoveCard removes a card by id
-func (m *MemoryDB) RemoveCard(id int64) error {
-	m.index--
-	for index, card := range m.cardList {
-		if card.ID == id {
-			m.cardList = append(m/cardList[:index], m.cardList[index+1:]...)
-			return nil
+// QueryCards returns a page of the cards that match the query
+func (m *MemoryDB) QueryCards(q Query) (*Page, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	candidates := m.cardList
+	if len(q.Labels) > 0 {
+		candidates = m.withLabels(q.Labels, q.LabelOp)
+	}
+	cardList := []*cards.Card{}
+	for _, card := range candidates {
+		if m.owns(card.OwnerID) && q.matches(card) {
+			c := *card
+			cardList = append(cardList, &c)
 		}
 	}
-	return ErrCardNotFound
+	return q.paginate(cardList), nil
+}
+
+// GetCard retrieves a card
+func (m *MemoryDB) GetCard(id int64) (*cards.Card, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	card := m.live(id)
+	if card == nil {
+		return nil, ErrCardNotFound
+	}
+	c := *card
+	return &c, nil
+}
+
+// RemoveCard moves a card to the trash
+func (m *MemoryDB) RemoveCard(id, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	card := m.live(id)
+	if card == nil {
+		return ErrCardNotFound
+	}
+	if version != 0 && card.Version != version {
+		return ErrVersionMismatch
+	}
+	trashed := *card
+	now := time.Now().UTC()
+	trashed.DeletedAt = &now
+	trashed.Version++
+	return m.commit(logEntry{Op: opTrash, Card: &trashed, Revision: m.revision(RevisionDelete, card, &trashed)})
 }
 
 // UpdateCard updates a card with new values
-func (m *MemoryDB) UpdateCard(new *cards.Card) (*cards.Card. error){
-	card, err := m.GetCard(new.Id)
-	if err != nil {
-		return nil, err
+func (m *MemoryDB) UpdateCard(new *cards.Card) (*cards.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.live(new.ID)
+	if stored == nil {
+		return nil, ErrCardNotFound
+	}
+	if new.Version != 0 && stored.Version != new.Version {
+		return nil, ErrVersionMismatch
 	}
+	card := *stored
 	if new.Text != card.Text && new.Text != "" {
 		card.Text = new.Text
 	}
 	if new.Title != card.Title && new.Title != "" {
 		card.Title = new.Title
 	}
-	// Go don't parse bool
-	// if new.Done != card.Done {
-	// card.Done = new.Done
-	// }
-	return card, nil
-}
\ No newline at end of file
+	// done and dates are always replaced, PATCH resolves omitted fields before
+	card.Done = new.Done
+	setDates(&card, new)
+	card.Version++
+	entry := logEntry{Op: opUpdate, Card: &card, Revision: m.revision(RevisionUpdate, stored, &card)}
+	if err := m.commit(entry); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// CardHistory returns every revision of a card, even a removed one
+func (m *MemoryDB) CardHistory(id int64) ([]*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	revisions, ok := m.history[id]
+	if !ok || !m.owns(revisions[0].Card.OwnerID) {
+		return nil, ErrCardNotFound
+	}
+	copies := make([]*Revision, len(revisions))
+	for i, r := range revisions {
+		copies[i] = r.copy()
+	}
+	return copies, nil
+}
+
+// CardRevision returns a revision of a card
+func (m *MemoryDB) CardRevision(id, rev int64) (*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	revisions, ok := m.history[id]
+	if !ok || !m.owns(revisions[0].Card.OwnerID) {
+		return nil, ErrCardNotFound
+	}
+	if rev < 1 || rev > int64(len(revisions)) {
+		return nil, ErrRevisionNotFound
+	}
+	return revisions[rev-1].copy(), nil
+}
+
+// TrashedCards returns the removed cards, in the order they were removed
+func (m *MemoryDB) TrashedCards() ([]*cards.Card, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cardList := make([]*cards.Card, 0, len(m.trash))
+	for _, card := range m.trash {
+		if m.owns(card.OwnerID) {
+			c := *card
+			cardList = append(cardList, &c)
+		}
+	}
+	return cardList, nil
+}
+
+// RestoreCard takes a card out of the trash
+func (m *MemoryDB) RestoreCard(id int64) (*cards.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trashed := m.trashed(id)
+	if trashed == nil {
+		return nil, ErrCardNotFound
+	}
+	card := *trashed
+	card.DeletedAt = nil
+	card.Version++
+	entry := logEntry{Op: opRestore, Card: &card, Revision: m.revision(RevisionRestore, trashed, &card)}
+	if err := m.commit(entry); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// PurgeCard removes a card from the trash for good
+func (m *MemoryDB) PurgeCard(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.purge(id)
+}
+
+// purge removes a trashed card for good. Callers must hold the lock
+func (m *MemoryDB) purge(id int64) error {
+	trashed := m.trashed(id)
+	if trashed == nil {
+		return ErrCardNotFound
+	}
+	return m.commit(logEntry{Op: opPurge, ID: id, Revision: m.revision(RevisionPurge, trashed, nil)})
+}
+
+// PurgeTrash removes for good the cards trashed before a time,
+// returning how many were purged
+func (m *MemoryDB) PurgeTrash(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expired := []int64{}
+	for _, card := range m.trash {
+		if m.owns(card.OwnerID) && card.DeletedAt.Before(before) {
+			expired = append(expired, card.ID)
+		}
+	}
+	for i, id := range expired {
+		if err := m.purge(id); err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,298 @@
+package database_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/database/databasetest"
+)
+
+func TestMemoryDB(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Database {
+		return database.NewMemoryDB()
+	})
+}
+
+func TestDurableMemoryDB(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Database {
+		db, err := database.OpenMemoryDB(t.TempDir(), 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestMemoryDBReplay(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.OpenMemoryDB(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"a", "b", "c", "d"} {
+		if err = db.CreateCard(&cards.Card{Title: title, Text: "text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.RemoveCard(4, 0)
+	db.UpdateCard(&cards.Card{ID: 2, Done: true})
+	db.CreateBoard(&cards.Board{Name: "board"})
+	db.CreateList(&cards.List{Name: "list", BoardID: 1})
+	db.MoveCard(3, 1, 0, 0)
+	db.CreateLabel(&cards.Label{Name: "red"})
+	db.AttachLabel(1, 1, 0)
+	db.CreateUser(&database.Account{User: cards.User{Name: "alice"}, PasswordHash: []byte("hash")})
+	db.CreateToken(1, "token", time.Now().Add(time.Hour))
+	db.For(1).CreateCard(&cards.Card{Title: "owned", Text: "text"})
+	// no Close, as if the process had crashed
+	reopened, err := database.OpenMemoryDB(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if user, err := reopened.TokenUser("token"); err != nil || user.Name != "alice" {
+		t.Errorf("expected the token of alice but %v was obtained (%v)", user, err)
+	}
+	if owned := reopened.For(1).AllCards(); len(owned) != 1 || owned[0].ID != 5 {
+		t.Errorf("expected card 5 of owner 1 but %+v was obtained", owned)
+	}
+	all := reopened.AllCards()[:3]
+	if len(all) != 3 || !all[1].Done || all[1].Version != 2 {
+		t.Errorf("expected cards 1, 2 (done) and 3 but %+v was obtained", all)
+	}
+	// the counts are rebuilt
+	if counts, err := reopened.CardCounts(); err != nil || counts != (database.CardCounts{Pending: 3, Done: 1, Trashed: 1}) {
+		t.Errorf("expected 3 pending, 1 done and 1 trashed card but %+v was obtained (%v)", counts, err)
+	}
+	card := &cards.Card{Title: "e", Text: "text"}
+	reopened.CreateCard(card)
+	if card.ID != 6 {
+		t.Errorf("expected id 6 but %d was obtained", card.ID)
+	}
+	if lists, err := reopened.BoardLists(1); err != nil || len(lists) != 1 || all[2].ListID != lists[0].ID {
+		t.Errorf("expected card 3 in the list of board 1 but %v was obtained (%v)", lists, err)
+	}
+	// the label index is rebuilt
+	if page, err := reopened.QueryCards(database.Query{Labels: []string{"red"}}); err != nil || len(page.Cards) != 1 || page.Cards[0].ID != 1 {
+		t.Errorf("expected card 1 labelled red but %+v was obtained (%v)", page, err)
+	}
+	list := &cards.List{Name: "other", BoardID: 1}
+	reopened.CreateList(list)
+	if list.ID != 2 {
+		t.Errorf("expected list id 2 but %d was obtained", list.ID)
+	}
+}
+
+func TestMemoryDBBatchReplay(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.OpenMemoryDB(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := func(titles ...string) error {
+		return db.Batch(func(tx database.Database) error {
+			for _, title := range titles {
+				if err := tx.CreateCard(&cards.Card{Title: title, Text: "text"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err = batch("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = batch("c", "d", "e"); err != nil {
+		t.Fatal(err)
+	}
+	// the last batch is cut by a crash while it was written
+	path := filepath.Join(dir, "cards.log")
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, log[:len(log)-20], 0644); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := database.OpenMemoryDB(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if all := reopened.AllCards(); len(all) != 2 || all[0].Title != "a" || all[1].Title != "b" {
+		t.Errorf("expected only the cards of the first batch but %+v was obtained", all)
+	}
+	if history, err := reopened.CardHistory(2); err != nil || len(history) != 1 {
+		t.Errorf("expected the history of card 2 but %v was obtained (%v)", history, err)
+	}
+}
+
+func TestMemoryDBBatchUndo(t *testing.T) {
+	db := database.NewMemoryDB()
+	for _, title := range []string{"a", "b", "c", "d"} {
+		db.CreateCard(&cards.Card{Title: title, Text: "text"})
+	}
+	db.RemoveCard(3, 0)
+	db.RemoveCard(2, 0)
+	db.CreateBoard(&cards.Board{Name: "board"})
+	db.CreateList(&cards.List{Name: "list", BoardID: 1})
+	db.CreateLabel(&cards.Label{Name: "red"})
+	db.AttachLabel(1, 1, 0)
+	// state is what a failed batch must leave as it was
+	state := func() string {
+		trash, _ := db.TrashedCards()
+		boards, _ := db.AllBoards()
+		lists, _ := db.BoardLists(1)
+		labels, _ := db.AllLabels()
+		red, _ := db.QueryCards(database.Query{Labels: []string{"red"}})
+		history, _ := db.CardHistory(1)
+		counts, _ := db.CardCounts()
+		state, err := json.Marshal([]interface{}{db.AllCards(), trash, boards, lists, labels, red, len(history), counts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(state)
+	}
+	before := state()
+	failed := errors.New("failed")
+	err := db.Batch(func(tx database.Database) error {
+		tx.CreateCard(&cards.Card{Title: "e", Text: "text"})
+		tx.UpdateCard(&cards.Card{ID: 1, Done: true})
+		tx.RestoreCard(3)
+		tx.PurgeCard(2)
+		tx.RemoveCard(4, 0)
+		tx.MoveCard(1, 1, 0, 0)
+		tx.CreateLabel(&cards.Label{Name: "blue"})
+		tx.AttachLabel(1, 2, 0)
+		tx.RemoveLabel(1)
+		tx.RemoveBoard(1)
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("expected the error of the batch but %v was obtained", err)
+	}
+	if after := state(); after != before {
+		t.Errorf("expected the store as it was\n%s\nbut it is\n%s", before, after)
+	}
+	// the ids taken by the batch are free again
+	card := &cards.Card{Title: "e", Text: "text"}
+	db.CreateCard(card)
+	label := &cards.Label{Name: "blue"}
+	db.CreateLabel(label)
+	if card.ID != 5 || label.ID != 2 {
+		t.Errorf("expected card 5 and label 2 but %d and %d were obtained", card.ID, label.ID)
+	}
+}
+
+func TestMemoryDBConcurrentBatches(t *testing.T) {
+	const workers, perWorker = 8, 20
+	db := database.NewMemoryDB()
+	failed := errors.New("failed")
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				// the inner batch fails and leaves the card of the outer one
+				err := db.Batch(func(tx database.Database) error {
+					if err := tx.CreateCard(&cards.Card{Title: "kept", Text: "text"}); err != nil {
+						return err
+					}
+					err := tx.Batch(func(tx database.Database) error {
+						tx.CreateCard(&cards.Card{Title: "undone", Text: "text"})
+						return failed
+					})
+					if err != failed {
+						t.Errorf("expected the error of the inner batch but %v was obtained", err)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	all := db.AllCards()
+	if len(all) != workers*perWorker {
+		t.Fatalf("expected %d cards but %d were obtained", workers*perWorker, len(all))
+	}
+	for _, card := range all {
+		if card.Title != "kept" {
+			t.Fatalf("expected only the cards of the outer batches but %+v was obtained", card)
+		}
+	}
+}
+
+func TestMemoryDBSnapshotEveryEntry(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.OpenMemoryDB(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every entry is applied before the snapshot and again after it
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if err = db.CreateUser(&database.Account{User: cards.User{Name: name}, PasswordHash: []byte("hash")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.For(2).CreateCard(&cards.Card{Title: "a", Text: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "cards.snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := struct {
+		Accounts []database.Account `json:"accounts"`
+		Cards    []cards.Card       `json:"cards"`
+	}{}
+	if err = json.Unmarshal(content, &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Accounts) != 3 || len(s.Cards) != 1 {
+		t.Errorf("expected 3 accounts and 1 card in the snapshot but %d and %d were obtained", len(s.Accounts), len(s.Cards))
+	}
+	db.Close()
+
+	reopened, err := database.OpenMemoryDB(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	dave := &database.Account{User: cards.User{Name: "dave"}, PasswordHash: []byte("hash")}
+	if err = reopened.CreateUser(dave); err != nil || dave.ID != 4 {
+		t.Errorf("expected user 4 but %d was obtained (%v)", dave.ID, err)
+	}
+	if owned := reopened.For(2).AllCards(); len(owned) != 1 {
+		t.Errorf("expected the card of bob but %+v was obtained", owned)
+	}
+	if counts, err := reopened.CardCounts(); err != nil || counts != (database.CardCounts{Pending: 1}) {
+		t.Errorf("expected 1 pending card but %+v was obtained (%v)", counts, err)
+	}
+}
+
+func TestMemoryDBPingAfterClose(t *testing.T) {
+	db, err := database.OpenMemoryDB(t.TempDir(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := db.For(1)
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = view.Ping(); err != database.ErrClosed {
+		t.Errorf("expected %v but %v was obtained", database.ErrClosed, err)
+	}
+}
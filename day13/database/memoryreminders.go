@@ -0,0 +1,40 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// DueReminders returns the pending reminders up to a time, by remind_at
+func (m *MemoryDB) DueReminders(until time.Time) ([]*cards.Card, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cardList := []*cards.Card{}
+	for _, card := range m.cardList {
+		if m.owns(card.OwnerID) && card.RemindAt != nil && !card.Reminded && !card.RemindAt.After(until) {
+			c := *card
+			cardList = append(cardList, &c)
+		}
+	}
+	sort.SliceStable(cardList, func(i, j int) bool { return cardList[i].RemindAt.Before(*cardList[j].RemindAt) })
+	return cardList, nil
+}
+
+// MarkReminded marks the reminder as fired, unless remind_at changed since.
+// It's not a change of the card, so no version or history
+func (m *MemoryDB) MarkReminded(id int64, remindAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.live(id)
+	if stored == nil {
+		return ErrCardNotFound
+	}
+	if stored.Reminded || !sameTime(stored.RemindAt, &remindAt) {
+		return nil
+	}
+	card := *stored
+	card.Reminded = true
+	return m.commit(logEntry{Op: opUpdate, Card: &card})
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// accountNamed returns the account with a name, nil when not found.
+// Callers must hold the lock
+func (m *MemoryDB) accountNamed(name string) *Account {
+	for _, account := range m.accounts {
+		if account.Name == name {
+			return account
+		}
+	}
+	return nil
+}
+
+// findAccount returns the position of an account, -1 when not found.
+// Callers must hold the lock
+func (m *MemoryDB) findAccount(id int64) int {
+	for index, account := range m.accounts {
+		if account.ID == id {
+			return index
+		}
+	}
+	return -1
+}
+
+// CreateUser appends an account
+func (m *MemoryDB) CreateUser(account *Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accountNamed(account.Name) != nil {
+		return ErrUserExists
+	}
+	created := *account
+	created.ID = m.userIndex + 1
+	if err := m.commit(logEntry{Op: opUser, Account: &created}); err != nil {
+		return err
+	}
+	account.ID = created.ID
+	return nil
+}
+
+// GetAccount retrieves the account of a user by name
+func (m *MemoryDB) GetAccount(name string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	account := m.accountNamed(name)
+	if account == nil {
+		return nil, ErrUserNotFound
+	}
+	a := *account
+	return &a, nil
+}
+
+// CreateToken keeps a token of a user until it expires
+func (m *MemoryDB) CreateToken(userID int64, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for hash, token := range m.tokens {
+		if token.UserID == userID && !token.ExpiresAt.After(now) {
+			if err := m.commit(logEntry{Op: opRemoveToken, Token: &apiToken{Hash: hash}}); err != nil {
+				return err
+			}
+		}
+	}
+	token := apiToken{Hash: tokenHash, UserID: userID, ExpiresAt: expiresAt.UTC()}
+	return m.commit(logEntry{Op: opToken, Token: &token})
+}
+
+// TokenUser returns the user of a token that did not expire
+func (m *MemoryDB) TokenUser(tokenHash string) (*cards.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	token, ok := m.tokens[tokenHash]
+	if !ok || !token.ExpiresAt.After(time.Now()) {
+		return nil, ErrTokenNotFound
+	}
+	for _, account := range m.accounts {
+		if account.ID == token.UserID {
+			user := account.User
+			return &user, nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+// RemoveToken forgets a token
+func (m *MemoryDB) RemoveToken(tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tokens[tokenHash]; !ok {
+		return ErrTokenNotFound
+	}
+	return m.commit(logEntry{Op: opRemoveToken, Token: &apiToken{Hash: tokenHash}})
+}
+
+// ClaimOrphans gives user the things of no owner, in a single log entry
+func (m *MemoryDB) ClaimOrphans(userID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []logEntry{}
+	claimed := 0
+	for _, label := range m.labels {
+		if label.OwnerID != 0 {
+			continue
+		}
+		if m.labelNamed(userID, label.Name) != nil {
+			return 0, ErrLabelExists
+		}
+		l := *label
+		l.OwnerID = userID
+		entries = append(entries, logEntry{Op: opLabel, Label: &l})
+	}
+	for _, board := range m.boards {
+		if board.OwnerID == 0 {
+			b := *board
+			b.OwnerID = userID
+			entries = append(entries, logEntry{Op: opBoard, Board: &b})
+		}
+	}
+	// the trashed cards stay in the trash
+	for _, stored := range []struct {
+		op    string
+		cards []*cards.Card
+	}{{opUpdate, m.cardList}, {opTrash, m.trash}} {
+		for _, card := range stored.cards {
+			if card.OwnerID == 0 {
+				c := *card
+				c.OwnerID = userID
+				// the history says who owns the card, so it's claimed too
+				entries = append(entries,
+					logEntry{Op: stored.op, Card: &c},
+					logEntry{Op: opClaim, ID: c.ID, Owner: userID},
+				)
+				claimed++
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	return claimed, m.commit(logEntry{Op: opBatch, Batch: entries})
+}
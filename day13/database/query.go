@@ -0,0 +1,209 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+const (
+	// DefaultLimit is the page size when none is given
+	DefaultLimit = 20
+	// MaxLimit is the biggest page size allowed
+	MaxLimit = 100
+)
+
+var (
+	// ErrInvalidSort raised when sort is not id, title, -id or position
+	ErrInvalidSort = errors.New("sort must be one of id, title, -id, position")
+	// ErrInvalidLimit raised when limit is out of range
+	ErrInvalidLimit = errors.New("limit must be between 1 and 100")
+	// ErrInvalidLabelOp raised when label_op is not and or or
+	ErrInvalidLabelOp = errors.New("label_op must be and or or")
+	// ErrInvalidCursor raised when a cursor can not be decoded or belongs to another sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Query filters, sorts and paginates a list of cards
+type Query struct {
+	// Done filters by done, nil means any
+	Done *bool
+	// TitlePrefix filters cards whose title starts with it
+	TitlePrefix string
+	// ListID filters the cards of a list, zero means any
+	ListID int64
+	// Labels filters cards by label names
+	Labels []string
+	// DueBefore filters cards due before it, nil means any
+	DueBefore *time.Time
+	// LabelOp is and, for cards with every label, or or, for cards
+	// with any of them
+	LabelOp string
+	// Sort is id, title, -id (descending id) or position (in the list)
+	Sort string
+	// Limit is the page size
+	Limit int
+	// Cursor points to where the page starts, nil for the first page
+	Cursor *Cursor
+}
+
+// Cursor marks a position in a sorted list of cards
+type Cursor struct {
+	Sort  string `json:"s"`
+	ID    int64  `json:"i"`
+	Title string `json:"t,omitempty"`
+	// Position is set when sorting by position
+	Position float64 `json:"o,omitempty"`
+	// Prev walks backwards, returning the cards before the position
+	Prev bool `json:"p,omitempty"`
+}
+
+// Page is a slice of the result with cursors for the pages around it
+type Page struct {
+	Cards []*cards.Card
+	Next  *Cursor
+	Prev  *Cursor
+}
+
+// Encode returns the cursor as an opaque string
+func (c *Cursor) Encode() string {
+	content, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// DecodeCursor parses a cursor returned by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := Cursor{}
+	if err = json.Unmarshal(content, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Validate checks the query and fills the defaults
+func (q *Query) Validate() error {
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	switch q.Sort {
+	case "id", "title", "-id", "position":
+	default:
+		return ErrInvalidSort
+	}
+	if q.LabelOp == "" {
+		q.LabelOp = "and"
+	}
+	if q.LabelOp != "and" && q.LabelOp != "or" {
+		return ErrInvalidLabelOp
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return ErrInvalidLimit
+	}
+	if q.Cursor != nil && q.Cursor.Sort != q.Sort {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// matches tells if a card passes the filters,
+// labels are left to the indexes of each database
+func (q *Query) matches(card *cards.Card) bool {
+	if q.Done != nil && card.Done != *q.Done {
+		return false
+	}
+	if q.ListID != 0 && card.ListID != q.ListID {
+		return false
+	}
+	if q.DueBefore != nil && (card.DueAt == nil || !card.DueAt.Before(*q.DueBefore)) {
+		return false
+	}
+	return strings.HasPrefix(card.Title, q.TitlePrefix)
+}
+
+// less tells if a comes before b in the query sort
+func (q *Query) less(a, b *cards.Card) bool {
+	switch q.Sort {
+	case "-id":
+		return a.ID > b.ID
+	case "title":
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.ID < b.ID
+	case "position":
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	default:
+		return a.ID < b.ID
+	}
+}
+
+// cursor marks the position of a card
+func (q *Query) cursor(card *cards.Card, prev bool) *Cursor {
+	c := &Cursor{Sort: q.Sort, ID: card.ID, Prev: prev}
+	switch q.Sort {
+	case "title":
+		c.Title = card.Title
+	case "position":
+		c.Position = card.Position
+	}
+	return c
+}
+
+// page builds the page and its cursors
+func (q *Query) page(list []*cards.Card, hasPrev, hasNext bool) *Page {
+	page := &Page{Cards: list}
+	if len(list) == 0 {
+		return page
+	}
+	if hasNext {
+		page.Next = q.cursor(list[len(list)-1], false)
+	}
+	if hasPrev {
+		page.Prev = q.cursor(list[0], true)
+	}
+	return page
+}
+
+// paginate sorts the filtered cards and cuts the page pointed by the cursor
+func (q *Query) paginate(list []*cards.Card) *Page {
+	sort.Slice(list, func(i, j int) bool { return q.less(list[i], list[j]) })
+	if q.Cursor == nil {
+		end := q.Limit
+		if end > len(list) {
+			end = len(list)
+		}
+		return q.page(list[:end], false, end < len(list))
+	}
+	at := &cards.Card{ID: q.Cursor.ID, Title: q.Cursor.Title, Position: q.Cursor.Position}
+	if q.Cursor.Prev {
+		// first card that is not before the cursor
+		end := sort.Search(len(list), func(i int) bool { return !q.less(list[i], at) })
+		start := end - q.Limit
+		if start < 0 {
+			start = 0
+		}
+		return q.page(list[start:end], start > 0, true)
+	}
+	// first card after the cursor
+	start := sort.Search(len(list), func(i int) bool { return q.less(at, list[i]) })
+	end := start + q.Limit
+	if end > len(list) {
+		end = len(list)
+	}
+	return q.page(list[start:end], true, end < len(list))
+}
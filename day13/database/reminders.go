@@ -0,0 +1,43 @@
+package database
+
+import (
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// Reminders methods that all database have to implement to fire the
+// reminders of cards. A reminder is pending while the card is live,
+// has a remind_at and was not reminded since remind_at was set.
+type Reminders interface {
+	// DueReminders returns the pending reminders up to a time, by remind_at
+	DueReminders(until time.Time) ([]*cards.Card, error)
+	// MarkReminded marks the reminder as fired, unless remind_at changed since
+	MarkReminded(id int64, remindAt time.Time) error
+}
+
+// utc returns the time in UTC, so every backend stores the same
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// sameTime tells if both times are nil or the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// setDates copies the due and reminder dates of new into card,
+// a new reminder is pending again
+func setDates(card, new *cards.Card) {
+	if !sameTime(card.RemindAt, new.RemindAt) {
+		card.Reminded = false
+	}
+	card.DueAt, card.RemindAt = utc(new.DueAt), utc(new.RemindAt)
+}
@@ -0,0 +1,776 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/jmoiron/sqlx"
+	//register sqlite 3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrations are applied in order on startup, pragma user_version
+// keeps how many were applied. Only append to this list.
+// The numbered migrations of day15 are not used: day13 is a program of
+// its own, with its own vendored sqlx, whose pool day15's Migrator does
+// not take, and it only ever migrates up, on startup, so the schema
+// ships inside the binary with nothing to keep in sync on disk.
+var migrations = []string{
+	`create table if not exists cards (
+		id integer not null primary key autoincrement,
+		title text not null,
+		text text not null,
+		done boolean not null default 0
+	)`,
+	`alter table cards add column version integer not null default 1`,
+	`create table card_revisions (
+		card_id integer not null,
+		rev integer not null,
+		op text not null,
+		author text not null,
+		at timestamp not null,
+		changes text not null,
+		card text not null,
+		primary key (card_id, rev)
+	)`,
+	`alter table cards add column deleted_at timestamp`,
+	`create table boards (
+		id integer not null primary key autoincrement,
+		name text not null
+	)`,
+	`create table lists (
+		id integer not null primary key autoincrement,
+		board_id integer not null references boards (id),
+		name text not null,
+		position real not null
+	)`,
+	`alter table cards add column list_id integer not null default 0`,
+	`alter table cards add column position real not null default 0`,
+	`create index cards_list_position on cards (list_id, position)`,
+	`create table labels (
+		id integer not null primary key autoincrement,
+		name text not null unique,
+		color text not null default ''
+	)`,
+	`create table card_labels (
+		card_id integer not null references cards (id),
+		label_id integer not null references labels (id),
+		primary key (card_id, label_id)
+	)`,
+	`create index card_labels_label on card_labels (label_id, card_id)`,
+	`alter table cards add column due_at timestamp`,
+	`alter table cards add column remind_at timestamp`,
+	`alter table cards add column reminded boolean not null default 0`,
+	`create index cards_due on cards (due_at)`,
+	`create index cards_pending_reminders on cards (remind_at) where reminded = 0 and deleted_at is null`,
+	`create table users (
+		id integer not null primary key autoincrement,
+		name text not null unique,
+		password_hash blob not null
+	)`,
+	`create table tokens (
+		hash text not null primary key,
+		user_id integer not null references users (id),
+		expires_at timestamp not null
+	)`,
+	`alter table cards add column owner_id integer not null default 0`,
+	`create index cards_owner on cards (owner_id, id)`,
+	`alter table boards add column owner_id integer not null default 0`,
+	// label names become unique for each owner, sqlite can't drop
+	// a constraint so the table is copied
+	`create table owned_labels (
+		id integer not null primary key autoincrement,
+		owner_id integer not null default 0,
+		name text not null,
+		color text not null default '',
+		unique (owner_id, name)
+	)`,
+	`insert into owned_labels (id, name, color) select id, name, color from labels`,
+	`drop table labels`,
+	`alter table owned_labels rename to labels`,
+	// the cards of each state are counted as they're written, so the
+	// counts don't read the cards
+	`create table card_counts (
+		state text not null primary key,
+		cards integer not null
+	)`,
+	`insert into card_counts (state, cards)
+		select 'pending', count(*) from cards where deleted_at is null and not done
+		union all select 'done', count(*) from cards where deleted_at is null and done
+		union all select 'trashed', count(*) from cards where deleted_at is not null`,
+	`create trigger cards_counted_insert after insert on cards begin
+		update card_counts set cards = cards + 1
+			where state = case when new.deleted_at is not null then 'trashed' when new.done then 'done' else 'pending' end;
+	end`,
+	`create trigger cards_counted_delete after delete on cards begin
+		update card_counts set cards = cards - 1
+			where state = case when old.deleted_at is not null then 'trashed' when old.done then 'done' else 'pending' end;
+	end`,
+	`create trigger cards_counted_update after update of done, deleted_at on cards begin
+		update card_counts set cards = cards - 1
+			where state = case when old.deleted_at is not null then 'trashed' when old.done then 'done' else 'pending' end;
+		update card_counts set cards = cards + 1
+			where state = case when new.deleted_at is not null then 'trashed' when new.done then 'done' else 'pending' end;
+	end`,
+}
+
+// cardColumns are selected when reading cards
+const cardColumns = "id, title, text, done, owner_id, version, list_id, position, due_at, remind_at, reminded, deleted_at"
+
+// ownedBy keeps the rows the view sees, it takes the owner twice
+const ownedBy = "(? = 0 or owner_id = ?)"
+
+// conn runs the queries, the pool or the transaction of a batch
+type conn interface {
+	sqlx.Ext
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
+// SQLiteDB is a database persisted in a sqlite file
+type SQLiteDB struct {
+	db *sqlx.DB
+	// tx is the transaction of the batch the view belongs to, if any
+	tx *sqlx.Tx
+	// author of the changes made through this view
+	author string
+	// owner whose things the view sees, zero sees everything
+	owner int64
+}
+
+// NewSQLiteDB connects to a sqlite database and creates or upgrades the schema.
+// dsn can be a file path or ":memory:"
+func NewSQLiteDB(dsn string) (*SQLiteDB, error) {
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// every connection to ":memory:" opens a brand new database,
+	// so keep only one connection in the pool
+	if dsn == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+	if err = migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteDB{db: db}, nil
+}
+
+// DB is the connection pool, to keep other tables in the same database
+func (s *SQLiteDB) DB() *sqlx.DB {
+	return s.db
+}
+
+// migrate applies the migrations that are missing
+func migrate(db *sqlx.DB) error {
+	var applied int
+	if err := db.Get(&applied, "pragma user_version"); err != nil {
+		return err
+	}
+	for ; applied < len(migrations); applied++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(migrations[applied]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		// pragma does not accept placeholders
+		if _, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", applied+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// As returns a view of the database whose changes are made by author
+func (s *SQLiteDB) As(author string) Database {
+	return &SQLiteDB{db: s.db, tx: s.tx, author: author, owner: s.owner}
+}
+
+// For returns a view of the database that only sees what owner owns
+func (s *SQLiteDB) For(owner int64) Database {
+	return &SQLiteDB{db: s.db, tx: s.tx, author: s.author, owner: owner}
+}
+
+// owns tells if the view sees what belongs to owner
+func (s *SQLiteDB) owns(owner int64) bool {
+	return s.owner == 0 || owner == s.owner
+}
+
+// conn is where the queries of the view run
+func (s *SQLiteDB) conn() conn {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// Batch runs fn with a view whose queries run in one transaction
+func (s *SQLiteDB) Batch(fn func(tx Database) error) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		return fn(&SQLiteDB{db: s.db, tx: tx, author: s.author, owner: s.owner})
+	})
+}
+
+// transaction runs fn inside a transaction, committing when it returns nil.
+// Inside a batch it runs in a savepoint of the batch transaction, so a
+// failure only undoes what fn did
+func (s *SQLiteDB) transaction(fn func(tx *sqlx.Tx) error) error {
+	if s.tx != nil {
+		return s.savepoint(fn)
+	}
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// savepoint runs fn in a savepoint of the batch transaction
+func (s *SQLiteDB) savepoint(fn func(tx *sqlx.Tx) error) error {
+	if _, err := s.tx.Exec("savepoint batch"); err != nil {
+		return err
+	}
+	if err := fn(s.tx); err != nil {
+		s.tx.Exec("rollback to batch")
+		s.tx.Exec("release batch")
+		return err
+	}
+	_, err := s.tx.Exec("release batch")
+	return err
+}
+
+// record adds the revision op from old to new to the history
+func (s *SQLiteDB) record(tx *sqlx.Tx, op string, old, new *cards.Card) error {
+	id := new
+	if id == nil {
+		id = old
+	}
+	var last int64
+	err := tx.Get(&last, "select coalesce(max(rev), 0) from card_revisions where card_id = ?", id.ID)
+	if err != nil {
+		return err
+	}
+	r := newRevision(last+1, op, s.author, old, new)
+	changes, err := json.Marshal(r.Changes)
+	if err != nil {
+		return err
+	}
+	card, err := json.Marshal(r.Card)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"insert into card_revisions (card_id, rev, op, author, at, changes, card) values (?, ?, ?, ?, ?, ?, ?)",
+		r.CardID, r.Rev, r.Op, r.Author, r.At, string(changes), string(card),
+	)
+	return err
+}
+
+// Close closes the underlying connection pool
+func (s *SQLiteDB) Close() error {
+	return s.db.Close()
+}
+
+// Ping runs a query, it fails once the pool is closed
+func (s *SQLiteDB) Ping() error {
+	var one int
+	return s.conn().Get(&one, "select 1")
+}
+
+// CardCounts reads the counts the triggers keep
+func (s *SQLiteDB) CardCounts() (CardCounts, error) {
+	rows := []struct {
+		State string `db:"state"`
+		Cards int64  `db:"cards"`
+	}{}
+	counts := CardCounts{}
+	if err := s.conn().Select(&rows, "select state, cards from card_counts"); err != nil {
+		return counts, err
+	}
+	for _, row := range rows {
+		switch row.State {
+		case "pending":
+			counts.Pending = row.Cards
+		case "done":
+			counts.Done = row.Cards
+		case "trashed":
+			counts.Trashed = row.Cards
+		}
+	}
+	return counts, nil
+}
+
+// CreateCard inserts a card into table
+func (s *SQLiteDB) CreateCard(card *cards.Card) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		created := *card
+		// labels are attached later
+		created.Labels = nil
+		created.Reminded = false
+		created.OwnerID = s.owner
+		created.DueAt, created.RemindAt = utc(created.DueAt), utc(created.RemindAt)
+		if created.ListID != 0 {
+			if _, err := s.getList(tx, created.ListID); err != nil {
+				return err
+			}
+			// goes to the end of the list
+			err := tx.Get(
+				&created.Position,
+				"select coalesce(max(position), 0) + 1 from cards where list_id = ? and deleted_at is null",
+				created.ListID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec(
+			"insert into cards (title, text, done, owner_id, list_id, position, due_at, remind_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+			created.Title, created.Text, created.Done, created.OwnerID, created.ListID, created.Position, created.DueAt, created.RemindAt,
+		)
+		if err != nil {
+			return err
+		}
+		// new id
+		created.Version = 1
+		if created.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		if err = s.record(tx, RevisionCreate, nil, &created); err != nil {
+			return err
+		}
+		card.ID, card.Version, card.Position, card.Labels = created.ID, created.Version, created.Position, nil
+		card.OwnerID = created.OwnerID
+		card.DueAt, card.RemindAt = created.DueAt, created.RemindAt
+		return nil
+	})
+}
+
+// AllCards returns a list with all cards
+func (s *SQLiteDB) AllCards() []*cards.Card {
+	cardList := []*cards.Card{}
+	err := s.conn().Select(
+		&cardList,
+		"select "+cardColumns+" from cards where deleted_at is null and "+ownedBy+" order by id",
+		s.owner, s.owner,
+	)
+	if err == nil {
+		err = loadLabels(s.conn(), cardList)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	return cardList
+}
+
+// orderBy maps the query sort to sql, forward and backward
+var orderBy = map[string][2]string{
+	"id":       {"id asc", "id desc"},
+	"title":    {"title asc, id asc", "title desc, id desc"},
+	"-id":      {"id desc", "id asc"},
+	"position": {"position asc, id asc", "position desc, id desc"},
+}
+
+// QueryCards returns a page of the cards that match the query
+func (s *SQLiteDB) QueryCards(q Query) (*Page, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	where := []string{"deleted_at is null", ownedBy}
+	args := []interface{}{s.owner, s.owner}
+	if q.Done != nil {
+		where = append(where, "done = ?")
+		args = append(args, *q.Done)
+	}
+	if q.TitlePrefix != "" {
+		// like is case insensitive, substr is not
+		where = append(where, "substr(title, 1, length(?)) = ?")
+		args = append(args, q.TitlePrefix, q.TitlePrefix)
+	}
+	if q.ListID != 0 {
+		where = append(where, "list_id = ?")
+		args = append(args, q.ListID)
+	}
+	if q.DueBefore != nil {
+		where = append(where, "due_at < ?")
+		args = append(args, q.DueBefore.UTC())
+	}
+	if len(q.Labels) > 0 {
+		// the card_labels index is walked from the labels
+		names := map[string]bool{}
+		marks := []string{}
+		// the names are those of the labels of the view owner
+		args = append(args, s.owner)
+		for _, name := range q.Labels {
+			if !names[name] {
+				names[name] = true
+				marks = append(marks, "?")
+				args = append(args, name)
+			}
+		}
+		labelled := "id in (select card_id from card_labels join labels on labels.id = card_labels.label_id" +
+			" where labels.owner_id = ? and labels.name in (" + strings.Join(marks, ", ") + ") group by card_id"
+		if q.LabelOp == "and" {
+			labelled += " having count(*) = ?"
+			args = append(args, len(names))
+		}
+		where = append(where, labelled+")")
+	}
+	prev := q.Cursor != nil && q.Cursor.Prev
+	if q.Cursor != nil {
+		// walking backwards flips the comparison
+		after, before := ">", "<"
+		if prev {
+			after, before = before, after
+		}
+		switch q.Sort {
+		case "id":
+			where = append(where, "id "+after+" ?")
+			args = append(args, q.Cursor.ID)
+		case "-id":
+			where = append(where, "id "+before+" ?")
+			args = append(args, q.Cursor.ID)
+		case "title":
+			where = append(where, "(title "+after+" ? or (title = ? and id "+after+" ?))")
+			args = append(args, q.Cursor.Title, q.Cursor.Title, q.Cursor.ID)
+		case "position":
+			where = append(where, "(position "+after+" ? or (position = ? and id "+after+" ?))")
+			args = append(args, q.Cursor.Position, q.Cursor.Position, q.Cursor.ID)
+		}
+	}
+	order := orderBy[q.Sort][0]
+	if prev {
+		order = orderBy[q.Sort][1]
+	}
+	// one more card tells if there is another page
+	args = append(args, q.Limit+1)
+	cardList := []*cards.Card{}
+	err := s.conn().Select(
+		&cardList,
+		"select "+cardColumns+" from cards where "+strings.Join(where, " and ")+" order by "+order+" limit ?",
+		args...,
+	)
+	if err == nil {
+		err = loadLabels(s.conn(), cardList)
+	}
+	if err != nil {
+		return nil, err
+	}
+	more := len(cardList) > q.Limit
+	if more {
+		cardList = cardList[:q.Limit]
+	}
+	if prev {
+		for i, j := 0, len(cardList)-1; i < j; i, j = i+1, j-1 {
+			cardList[i], cardList[j] = cardList[j], cardList[i]
+		}
+		return q.page(cardList, more, true), nil
+	}
+	return q.page(cardList, q.Cursor != nil, more), nil
+}
+
+// GetCard retrieves a card
+func (s *SQLiteDB) GetCard(id int64) (*cards.Card, error) {
+	return s.getCard(s.conn(), id)
+}
+
+// getCard reads a live card from the database or from a transaction
+func (s *SQLiteDB) getCard(q sqlx.Queryer, id int64) (*cards.Card, error) {
+	return selectCard(
+		q,
+		"select "+cardColumns+" from cards where id = ? and deleted_at is null and "+ownedBy,
+		id, s.owner, s.owner,
+	)
+}
+
+// getTrashed reads a card in the trash
+func (s *SQLiteDB) getTrashed(q sqlx.Queryer, id int64) (*cards.Card, error) {
+	return selectCard(
+		q,
+		"select "+cardColumns+" from cards where id = ? and deleted_at is not null and "+ownedBy,
+		id, s.owner, s.owner,
+	)
+}
+
+// selectCard reads a single card, ErrCardNotFound when there is none
+func selectCard(q sqlx.Queryer, query string, args ...interface{}) (*cards.Card, error) {
+	card := cards.Card{}
+	err := sqlx.Get(q, &card, query, args...)
+	if err == nil {
+		err = loadLabels(q, []*cards.Card{&card})
+	}
+	switch err {
+	case sql.ErrNoRows:
+		return nil, ErrCardNotFound
+	case nil:
+		return &card, nil
+	default:
+		return nil, err
+	}
+}
+
+// RemoveCard moves a card to the trash
+func (s *SQLiteDB) RemoveCard(id, version int64) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		card, err := s.getCard(tx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && card.Version != version {
+			return ErrVersionMismatch
+		}
+		trashed := *card
+		now := time.Now().UTC()
+		trashed.DeletedAt = &now
+		trashed.Version++
+		result, err := tx.Exec(
+			"update cards set deleted_at = ?, version = version + 1 where id = ? and version = ?",
+			now, id, card.Version,
+		)
+		if err != nil {
+			return err
+		}
+		if err = s.checkAffected(tx, result, id); err != nil {
+			return err
+		}
+		return s.record(tx, RevisionDelete, card, &trashed)
+	})
+}
+
+// UpdateCard updates a card with new values.
+// Follows the same rules of MemoryDB, empty texts are ignored
+func (s *SQLiteDB) UpdateCard(new *cards.Card) (*cards.Card, error) {
+	for {
+		var updated *cards.Card
+		err := s.transaction(func(tx *sqlx.Tx) error {
+			stored, err := s.getCard(tx, new.ID)
+			if err != nil {
+				return err
+			}
+			if new.Version != 0 && stored.Version != new.Version {
+				return ErrVersionMismatch
+			}
+			card := *stored
+			if new.Text != "" {
+				card.Text = new.Text
+			}
+			if new.Title != "" {
+				card.Title = new.Title
+			}
+			card.Done = new.Done
+			setDates(&card, new)
+			// only write over the version that was read
+			result, err := tx.Exec(
+				"update cards set title = ?, text = ?, done = ?, due_at = ?, remind_at = ?, reminded = ?,"+
+					" version = version + 1 where id = ? and version = ?",
+				card.Title, card.Text, card.Done, card.DueAt, card.RemindAt, card.Reminded, card.ID, card.Version,
+			)
+			if err != nil {
+				return err
+			}
+			if err = s.checkAffected(tx, result, card.ID); err != nil {
+				return err
+			}
+			card.Version++
+			updated = &card
+			return s.record(tx, RevisionUpdate, stored, &card)
+		})
+		// someone else changed the card after the read,
+		// try again when any version is accepted
+		if err == ErrVersionMismatch && new.Version == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+}
+
+// checkAffected tells why a conditional write did not change a card
+func (s *SQLiteDB) checkAffected(q sqlx.Queryer, result sql.Result, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	if _, err = s.getCard(q, id); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// TrashedCards returns the removed cards, in the order they were removed
+func (s *SQLiteDB) TrashedCards() ([]*cards.Card, error) {
+	cardList := []*cards.Card{}
+	err := s.conn().Select(
+		&cardList,
+		"select "+cardColumns+" from cards where deleted_at is not null and "+ownedBy+" order by deleted_at, id",
+		s.owner, s.owner,
+	)
+	if err == nil {
+		err = loadLabels(s.conn(), cardList)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cardList, nil
+}
+
+// RestoreCard takes a card out of the trash
+func (s *SQLiteDB) RestoreCard(id int64) (*cards.Card, error) {
+	var restored *cards.Card
+	err := s.transaction(func(tx *sqlx.Tx) error {
+		trashed, err := s.getTrashed(tx, id)
+		if err != nil {
+			return err
+		}
+		card := *trashed
+		card.DeletedAt = nil
+		card.Version++
+		_, err = tx.Exec("update cards set deleted_at = null, version = version + 1 where id = ?", id)
+		if err != nil {
+			return err
+		}
+		restored = &card
+		return s.record(tx, RevisionRestore, trashed, &card)
+	})
+	return restored, err
+}
+
+// PurgeCard removes a card from the trash for good
+func (s *SQLiteDB) PurgeCard(id int64) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		return s.purge(tx, id)
+	})
+}
+
+// purge removes a trashed card for good
+func (s *SQLiteDB) purge(tx *sqlx.Tx, id int64) error {
+	trashed, err := s.getTrashed(tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("delete from card_labels where card_id = ?", id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("delete from cards where id = ?", id); err != nil {
+		return err
+	}
+	return s.record(tx, RevisionPurge, trashed, nil)
+}
+
+// PurgeTrash removes for good the cards trashed before a time,
+// returning how many were purged
+func (s *SQLiteDB) PurgeTrash(before time.Time) (int, error) {
+	purged := 0
+	err := s.transaction(func(tx *sqlx.Tx) error {
+		expired := []int64{}
+		err := tx.Select(
+			&expired,
+			"select id from cards where deleted_at < ? and "+ownedBy,
+			before.UTC(), s.owner, s.owner,
+		)
+		if err != nil {
+			return err
+		}
+		for _, id := range expired {
+			if err = s.purge(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(expired)
+		return nil
+	})
+	return purged, err
+}
+
+// revisionRow is how a revision is kept in card_revisions
+type revisionRow struct {
+	CardID  int64     `db:"card_id"`
+	Rev     int64     `db:"rev"`
+	Op      string    `db:"op"`
+	Author  string    `db:"author"`
+	At      time.Time `db:"at"`
+	Changes string    `db:"changes"`
+	Card    string    `db:"card"`
+}
+
+// revision decodes the json columns
+func (row revisionRow) revision() (*Revision, error) {
+	r := &Revision{CardID: row.CardID, Rev: row.Rev, Op: row.Op, Author: row.Author, At: row.At}
+	if err := json.Unmarshal([]byte(row.Changes), &r.Changes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(row.Card), &r.Card); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CardHistory returns every revision of a card, even a removed one
+func (s *SQLiteDB) CardHistory(id int64) ([]*Revision, error) {
+	rows := []revisionRow{}
+	err := s.conn().Select(&rows, "select * from card_revisions where card_id = ? order by rev", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrCardNotFound
+	}
+	revisions := make([]*Revision, 0, len(rows))
+	for _, row := range rows {
+		r, err := row.revision()
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	// every revision has the owner of the card
+	if !s.owns(revisions[0].Card.OwnerID) {
+		return nil, ErrCardNotFound
+	}
+	return revisions, nil
+}
+
+// CardRevision returns a revision of a card
+func (s *SQLiteDB) CardRevision(id, rev int64) (*Revision, error) {
+	row := revisionRow{}
+	err := s.conn().Get(&row, "select * from card_revisions where card_id = ? and rev = ?", id, rev)
+	if err == sql.ErrNoRows {
+		// tell a missing card from a missing revision
+		if _, err = s.CardHistory(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := row.revision()
+	if err != nil {
+		return nil, err
+	}
+	if !s.owns(r.Card.OwnerID) {
+		return nil, ErrCardNotFound
+	}
+	return r, nil
+}
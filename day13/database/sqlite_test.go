@@ -0,0 +1,91 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/database/databasetest"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestSQLiteDB(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Database {
+		db, err := database.NewSQLiteDB(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestSQLiteDBPingAfterClose(t *testing.T) {
+	db, err := database.NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err = db.Ping(); err == nil {
+		t.Error("a closed database answered the ping")
+	}
+}
+
+func TestSQLiteDBReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cards.db")
+	db, err := database.NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := &cards.Card{Title: "title", Text: "text"}
+	if err = db.CreateCard(card); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the schema is up to date, so reopening migrates nothing
+	reopened, err := database.NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got, err := reopened.GetCard(card.ID); err != nil || got.Title != "title" {
+		t.Errorf("expected the card but %+v was obtained (%v)", got, err)
+	}
+}
+
+func TestSQLiteDBMigratesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cards.db")
+	// the first schema, with a card from then
+	old, err := sqlx.Connect("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		`create table cards (id integer not null primary key autoincrement, title text not null, text text not null, done boolean not null default 0)`,
+		`insert into cards (title, text, done) values ('old', 'text', 1)`,
+		`pragma user_version = 1`,
+	} {
+		if _, err = old.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db, err := database.NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	card, err := db.GetCard(1)
+	if err != nil || card.Title != "old" || !card.Done || card.Version != 1 || card.OwnerID != 0 {
+		t.Errorf("expected the old card, done, at version 1 but %+v was obtained (%v)", card, err)
+	}
+	if counts, err := db.CardCounts(); err != nil || counts.Done != 1 {
+		t.Errorf("expected the old card counted but %+v was obtained (%v)", counts, err)
+	}
+	if n, err := db.ClaimOrphans(1); err != nil || n != 1 {
+		t.Errorf("expected the old card claimed but %d was obtained (%v)", n, err)
+	}
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateBoard inserts a board into table
+func (s *SQLiteDB) CreateBoard(board *cards.Board) error {
+	result, err := s.conn().Exec("insert into boards (name, owner_id) values (?, ?)", board.Name, s.owner)
+	if err != nil {
+		return err
+	}
+	board.OwnerID = s.owner
+	board.ID, err = result.LastInsertId()
+	return err
+}
+
+// AllBoards returns every board
+func (s *SQLiteDB) AllBoards() ([]*cards.Board, error) {
+	boards := []*cards.Board{}
+	err := s.conn().Select(&boards, "select id, name, owner_id from boards where "+ownedBy+" order by id", s.owner, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	return boards, nil
+}
+
+// GetBoard retrieves a board
+func (s *SQLiteDB) GetBoard(id int64) (*cards.Board, error) {
+	return s.getBoard(s.conn(), id)
+}
+
+// getBoard reads a board from the database or from a transaction
+func (s *SQLiteDB) getBoard(q sqlx.Queryer, id int64) (*cards.Board, error) {
+	board := cards.Board{}
+	err := sqlx.Get(q, &board, "select id, name, owner_id from boards where id = ? and "+ownedBy, id, s.owner, s.owner)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, ErrBoardNotFound
+	case nil:
+		return &board, nil
+	default:
+		return nil, err
+	}
+}
+
+// UpdateBoard renames a board
+func (s *SQLiteDB) UpdateBoard(new *cards.Board) (*cards.Board, error) {
+	var updated *cards.Board
+	err := s.transaction(func(tx *sqlx.Tx) error {
+		board, err := s.getBoard(tx, new.ID)
+		if err != nil {
+			return err
+		}
+		if new.Name != "" {
+			board.Name = new.Name
+		}
+		if _, err = tx.Exec("update boards set name = ? where id = ?", board.Name, board.ID); err != nil {
+			return err
+		}
+		updated = board
+		return nil
+	})
+	return updated, err
+}
+
+// RemoveBoard removes an empty board
+func (s *SQLiteDB) RemoveBoard(id int64) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if _, err := s.getBoard(tx, id); err != nil {
+			return err
+		}
+		var lists int
+		if err := tx.Get(&lists, "select count(*) from lists where board_id = ?", id); err != nil {
+			return err
+		}
+		if lists > 0 {
+			return ErrBoardNotEmpty
+		}
+		_, err := tx.Exec("delete from boards where id = ?", id)
+		return err
+	})
+}
+
+// CreateList inserts a list at the end of its board
+func (s *SQLiteDB) CreateList(list *cards.List) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if _, err := s.getBoard(tx, list.BoardID); err != nil {
+			return err
+		}
+		created := *list
+		if created.Position == 0 {
+			err := tx.Get(
+				&created.Position,
+				"select coalesce(max(position), 0) + 1 from lists where board_id = ?",
+				created.BoardID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec(
+			"insert into lists (board_id, name, position) values (?, ?, ?)",
+			created.BoardID, created.Name, created.Position,
+		)
+		if err != nil {
+			return err
+		}
+		if created.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		list.ID, list.Position = created.ID, created.Position
+		return nil
+	})
+}
+
+// BoardLists returns the lists of a board sorted by position
+func (s *SQLiteDB) BoardLists(boardID int64) ([]*cards.List, error) {
+	if _, err := s.getBoard(s.conn(), boardID); err != nil {
+		return nil, err
+	}
+	lists := []*cards.List{}
+	err := s.conn().Select(
+		&lists,
+		"select id, board_id, name, position from lists where board_id = ? order by position, id",
+		boardID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// GetList retrieves a list
+func (s *SQLiteDB) GetList(id int64) (*cards.List, error) {
+	return s.getList(s.conn(), id)
+}
+
+// getList reads a list of a board the view sees,
+// from the database or from a transaction
+func (s *SQLiteDB) getList(q sqlx.Queryer, id int64) (*cards.List, error) {
+	list := cards.List{}
+	err := sqlx.Get(
+		q,
+		&list,
+		"select id, board_id, name, position from lists where id = ?"+
+			" and board_id in (select id from boards where "+ownedBy+")",
+		id, s.owner, s.owner,
+	)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, ErrListNotFound
+	case nil:
+		return &list, nil
+	default:
+		return nil, err
+	}
+}
+
+// UpdateList renames or reorders a list
+func (s *SQLiteDB) UpdateList(new *cards.List) (*cards.List, error) {
+	var updated *cards.List
+	err := s.transaction(func(tx *sqlx.Tx) error {
+		list, err := s.getList(tx, new.ID)
+		if err != nil {
+			return err
+		}
+		if new.Name != "" {
+			list.Name = new.Name
+		}
+		if new.Position != 0 {
+			list.Position = new.Position
+		}
+		_, err = tx.Exec("update lists set name = ?, position = ? where id = ?", list.Name, list.Position, list.ID)
+		if err != nil {
+			return err
+		}
+		updated = list
+		return nil
+	})
+	return updated, err
+}
+
+// RemoveList removes a list without cards
+func (s *SQLiteDB) RemoveList(id int64) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if _, err := s.getList(tx, id); err != nil {
+			return err
+		}
+		// trashed cards count too, they can be restored
+		var cardCount int
+		if err := tx.Get(&cardCount, "select count(*) from cards where list_id = ?", id); err != nil {
+			return err
+		}
+		if cardCount > 0 {
+			return ErrListNotEmpty
+		}
+		_, err := tx.Exec("delete from lists where id = ?", id)
+		return err
+	})
+}
+
+// MoveCard puts a card at index of a list
+func (s *SQLiteDB) MoveCard(id, listID int64, index int, version int64) (*cards.Card, error) {
+	for {
+		var moved *cards.Card
+		err := s.transaction(func(tx *sqlx.Tx) error {
+			stored, err := s.getCard(tx, id)
+			if err != nil {
+				return err
+			}
+			if version != 0 && stored.Version != version {
+				return ErrVersionMismatch
+			}
+			if _, err = s.getList(tx, listID); err != nil {
+				return err
+			}
+			siblings := []int64{}
+			positions := []float64{}
+			rows, err := tx.Query(
+				"select id, position from cards where list_id = ? and id != ? and deleted_at is null order by position, id",
+				listID, id,
+			)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var sibling int64
+				var position float64
+				if err = rows.Scan(&sibling, &position); err != nil {
+					rows.Close()
+					return err
+				}
+				siblings = append(siblings, sibling)
+				positions = append(positions, position)
+			}
+			if err = rows.Err(); err != nil {
+				return err
+			}
+			position, ok := positionAt(positions, index)
+			if !ok {
+				// no room left between the neighbours, renumber the list.
+				// The cards that change position get a new version, so the
+				// clients holding them can't write over the new order
+				renumber := renumbered(len(siblings))
+				for i, sibling := range siblings {
+					if positions[i] == renumber[i] {
+						continue
+					}
+					old, err := s.getCard(tx, sibling)
+					if err != nil {
+						return err
+					}
+					if _, err = tx.Exec("update cards set position = ?, version = version + 1 where id = ?", renumber[i], sibling); err != nil {
+						return err
+					}
+					new := *old
+					new.Position = renumber[i]
+					new.Version++
+					if err = s.record(tx, RevisionMove, old, &new); err != nil {
+						return err
+					}
+				}
+				positions = renumber
+				position, _ = positionAt(positions, index)
+			}
+			card := *stored
+			card.ListID = listID
+			card.Position = position
+			result, err := tx.Exec(
+				"update cards set list_id = ?, position = ?, version = version + 1 where id = ? and version = ?",
+				card.ListID, card.Position, card.ID, card.Version,
+			)
+			if err != nil {
+				return err
+			}
+			if err = s.checkAffected(tx, result, card.ID); err != nil {
+				return err
+			}
+			card.Version++
+			moved = &card
+			return s.record(tx, RevisionMove, stored, &card)
+		})
+		// same as UpdateCard, retry when any version is accepted
+		if err == ErrVersionMismatch && version == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return moved, nil
+	}
+}
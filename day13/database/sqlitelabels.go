@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/jmoiron/sqlx"
+)
+
+// loadLabels fills the labels of the cards
+func loadLabels(q sqlx.Queryer, cardList []*cards.Card) error {
+	if len(cardList) == 0 {
+		return nil
+	}
+	byID := map[int64]*cards.Card{}
+	ids := make([]int64, 0, len(cardList))
+	for _, card := range cardList {
+		byID[card.ID] = card
+		ids = append(ids, card.ID)
+	}
+	query, args, err := sqlx.In(
+		"select card_id, label_id from card_labels where card_id in (?) order by card_id, label_id",
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, labelID int64
+		if err = rows.Scan(&id, &labelID); err != nil {
+			return err
+		}
+		byID[id].Labels = append(byID[id].Labels, labelID)
+	}
+	return rows.Err()
+}
+
+// getLabel reads a label from the database or from a transaction
+func (s *SQLiteDB) getLabel(q sqlx.Queryer, id int64) (*cards.Label, error) {
+	label := cards.Label{}
+	err := sqlx.Get(q, &label, "select id, name, color, owner_id from labels where id = ? and "+ownedBy, id, s.owner, s.owner)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, ErrLabelNotFound
+	case nil:
+		return &label, nil
+	default:
+		return nil, err
+	}
+}
+
+// nameTaken tells if a label of owner other than id has the name
+func nameTaken(tx *sqlx.Tx, owner int64, name string, id int64) (bool, error) {
+	var count int
+	err := tx.Get(&count, "select count(*) from labels where owner_id = ? and name = ? and id != ?", owner, name, id)
+	return count > 0, err
+}
+
+// CreateLabel inserts a label into table
+func (s *SQLiteDB) CreateLabel(label *cards.Label) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		taken, err := nameTaken(tx, s.owner, label.Name, 0)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrLabelExists
+		}
+		result, err := tx.Exec(
+			"insert into labels (name, color, owner_id) values (?, ?, ?)",
+			label.Name, label.Color, s.owner,
+		)
+		if err != nil {
+			return err
+		}
+		label.OwnerID = s.owner
+		label.ID, err = result.LastInsertId()
+		return err
+	})
+}
+
+// AllLabels returns every label
+func (s *SQLiteDB) AllLabels() ([]*cards.Label, error) {
+	labels := []*cards.Label{}
+	err := s.conn().Select(&labels, "select id, name, color, owner_id from labels where "+ownedBy+" order by id", s.owner, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// GetLabel retrieves a label
+func (s *SQLiteDB) GetLabel(id int64) (*cards.Label, error) {
+	return s.getLabel(s.conn(), id)
+}
+
+// UpdateLabel renames or paints a label
+func (s *SQLiteDB) UpdateLabel(new *cards.Label) (*cards.Label, error) {
+	var updated *cards.Label
+	err := s.transaction(func(tx *sqlx.Tx) error {
+		label, err := s.getLabel(tx, new.ID)
+		if err != nil {
+			return err
+		}
+		if new.Name != "" {
+			taken, err := nameTaken(tx, label.OwnerID, new.Name, label.ID)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrLabelExists
+			}
+			label.Name = new.Name
+		}
+		if new.Color != "" {
+			label.Color = new.Color
+		}
+		_, err = tx.Exec("update labels set name = ?, color = ? where id = ?", label.Name, label.Color, label.ID)
+		if err != nil {
+			return err
+		}
+		updated = label
+		return nil
+	})
+	return updated, err
+}
+
+// RemoveLabel detaches a label from every card and removes it
+func (s *SQLiteDB) RemoveLabel(id int64) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if _, err := s.getLabel(tx, id); err != nil {
+			return err
+		}
+		ids := []int64{}
+		if err := tx.Select(&ids, "select card_id from card_labels where label_id = ? order by card_id", id); err != nil {
+			return err
+		}
+		for _, cardID := range ids {
+			// live or trashed
+			stored, err := selectCard(tx, "select "+cardColumns+" from cards where id = ?", cardID)
+			if err != nil {
+				return err
+			}
+			if _, err = s.relabel(tx, stored, id, RevisionUnlabel); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec("delete from labels where id = ?", id)
+		return err
+	})
+}
+
+// AttachLabel adds a label to a live card
+func (s *SQLiteDB) AttachLabel(id, labelID, version int64) (*cards.Card, error) {
+	return s.label(id, labelID, version, RevisionLabel)
+}
+
+// DetachLabel takes a label out of a live card
+func (s *SQLiteDB) DetachLabel(id, labelID, version int64) (*cards.Card, error) {
+	return s.label(id, labelID, version, RevisionUnlabel)
+}
+
+// label attaches or detaches, as op says, a label
+func (s *SQLiteDB) label(id, labelID, version int64, op string) (*cards.Card, error) {
+	for {
+		var labelled *cards.Card
+		err := s.transaction(func(tx *sqlx.Tx) error {
+			stored, err := s.getCard(tx, id)
+			if err != nil {
+				return err
+			}
+			if version != 0 && stored.Version != version {
+				return ErrVersionMismatch
+			}
+			if _, err = s.getLabel(tx, labelID); err != nil {
+				return err
+			}
+			if hasLabel(stored.Labels, labelID) == (op == RevisionLabel) {
+				// nothing to change
+				labelled = stored
+				return nil
+			}
+			labelled, err = s.relabel(tx, stored, labelID, op)
+			return err
+		})
+		// same as UpdateCard, retry when any version is accepted
+		if err == ErrVersionMismatch && version == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return labelled, nil
+	}
+}
+
+// relabel attaches or detaches a label of a stored card,
+// bumping its version and recording the change
+func (s *SQLiteDB) relabel(tx *sqlx.Tx, stored *cards.Card, labelID int64, op string) (*cards.Card, error) {
+	card := *stored
+	var err error
+	if op == RevisionLabel {
+		card.Labels = withLabel(card.Labels, labelID)
+		_, err = tx.Exec("insert into card_labels (card_id, label_id) values (?, ?)", card.ID, labelID)
+	} else {
+		card.Labels = withoutLabel(card.Labels, labelID)
+		_, err = tx.Exec("delete from card_labels where card_id = ? and label_id = ?", card.ID, labelID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec("update cards set version = version + 1 where id = ? and version = ?", card.ID, card.Version)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrVersionMismatch
+	}
+	card.Version++
+	if err = s.record(tx, op, stored, &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// DueReminders returns the pending reminders up to a time, by remind_at
+func (s *SQLiteDB) DueReminders(until time.Time) ([]*cards.Card, error) {
+	cardList := []*cards.Card{}
+	err := s.conn().Select(
+		&cardList,
+		"select "+cardColumns+" from cards where reminded = 0 and deleted_at is null and remind_at <= ? and "+ownedBy+
+			" order by remind_at, id",
+		until.UTC(), s.owner, s.owner,
+	)
+	if err == nil {
+		err = loadLabels(s.conn(), cardList)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cardList, nil
+}
+
+// MarkReminded marks the reminder as fired, unless remind_at changed since.
+// It's not a change of the card, so no version or history
+func (s *SQLiteDB) MarkReminded(id int64, remindAt time.Time) error {
+	result, err := s.conn().Exec(
+		"update cards set reminded = 1 where id = ? and remind_at = ? and deleted_at is null and "+ownedBy,
+		id, remindAt.UTC(), s.owner, s.owner,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	if _, err = s.getCard(s.conn(), id); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateUser inserts an account into table
+func (s *SQLiteDB) CreateUser(account *Account) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		var count int
+		if err := tx.Get(&count, "select count(*) from users where name = ?", account.Name); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUserExists
+		}
+		result, err := tx.Exec(
+			"insert into users (name, password_hash) values (?, ?)",
+			account.Name, account.PasswordHash,
+		)
+		if err != nil {
+			return err
+		}
+		account.ID, err = result.LastInsertId()
+		return err
+	})
+}
+
+// GetAccount retrieves the account of a user by name
+func (s *SQLiteDB) GetAccount(name string) (*Account, error) {
+	account := Account{}
+	err := s.conn().Get(&account, "select id, name, password_hash from users where name = ?", name)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, ErrUserNotFound
+	case nil:
+		return &account, nil
+	default:
+		return nil, err
+	}
+}
+
+// CreateToken keeps a token of a user until it expires
+func (s *SQLiteDB) CreateToken(userID int64, tokenHash string, expiresAt time.Time) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec("delete from tokens where user_id = ? and expires_at <= ?", userID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"insert into tokens (hash, user_id, expires_at) values (?, ?, ?)",
+			tokenHash, userID, expiresAt.UTC(),
+		)
+		return err
+	})
+}
+
+// TokenUser returns the user of a token that did not expire
+func (s *SQLiteDB) TokenUser(tokenHash string) (*cards.User, error) {
+	user := cards.User{}
+	err := s.conn().Get(
+		&user,
+		"select users.id, users.name from tokens join users on users.id = tokens.user_id"+
+			" where tokens.hash = ? and tokens.expires_at > ?",
+		tokenHash, time.Now().UTC(),
+	)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, ErrTokenNotFound
+	case nil:
+		return &user, nil
+	default:
+		return nil, err
+	}
+}
+
+// RemoveToken forgets a token
+func (s *SQLiteDB) RemoveToken(tokenHash string) error {
+	result, err := s.conn().Exec("delete from tokens where hash = ?", tokenHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// ClaimOrphans gives user the things of no owner
+func (s *SQLiteDB) ClaimOrphans(userID int64) (int, error) {
+	claimed := 0
+	err := s.transaction(func(tx *sqlx.Tx) error {
+		var clashes int
+		err := tx.Get(&clashes,
+			"select count(*) from labels as orphan where owner_id = 0 and exists (select 1 from labels where owner_id = ? and name = orphan.name)",
+			userID,
+		)
+		if err != nil {
+			return err
+		}
+		if clashes > 0 {
+			return ErrLabelExists
+		}
+		for _, table := range []string{"labels", "boards"} {
+			if _, err = tx.Exec("update "+table+" set owner_id = ? where owner_id = 0", userID); err != nil {
+				return err
+			}
+		}
+		// the history says who owns the card, so it's claimed too
+		rows := []revisionRow{}
+		err = tx.Select(&rows, "select * from card_revisions where card_id in (select id from cards where owner_id = 0)")
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			r, err := row.revision()
+			if err != nil {
+				return err
+			}
+			r.Card.OwnerID = userID
+			card, err := json.Marshal(r.Card)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("update card_revisions set card = ? where card_id = ? and rev = ?", string(card), row.CardID, row.Rev)
+			if err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec("update cards set owner_id = ? where owner_id = 0", userID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		claimed = int(n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return claimed, nil
+}
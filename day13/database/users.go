@@ -0,0 +1,47 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+var (
+	// ErrUserNotFound raised when a user is not found
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists raised when another user has the same name
+	ErrUserExists = errors.New("user name already in use")
+	// ErrTokenNotFound raised when a token is unknown or expired
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// Account is a user with the hash of its password
+type Account struct {
+	cards.User
+	PasswordHash []byte `json:"password_hash" db:"password_hash"`
+}
+
+// Users methods that all database have to implement to keep the
+// accounts and their API tokens. Passwords and tokens are only seen
+// hashed. User names are unique and every view shares the users.
+// CreateToken also drops the expired tokens of the user.
+// ClaimOrphans gives a user the cards, boards and labels of no owner,
+// made before there were users, which only the views of owner zero
+// see. It returns how many cards the user got and claims nothing with
+// ErrLabelExists when the user already has a label of the same name.
+type Users interface {
+	CreateUser(account *Account) error
+	GetAccount(name string) (*Account, error)
+	CreateToken(userID int64, tokenHash string, expiresAt time.Time) error
+	TokenUser(tokenHash string) (*cards.User, error)
+	RemoveToken(tokenHash string) error
+	ClaimOrphans(userID int64) (int, error)
+}
+
+// apiToken is a token handed out to a user
+type apiToken struct {
+	Hash      string    `json:"hash" db:"hash"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
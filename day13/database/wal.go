@@ -0,0 +1,303 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+const (
+	logFile      = "cards.log"
+	snapshotFile = "cards.snapshot"
+
+	opCreate  = "create"
+	opUpdate  = "update"
+	opRemove  = "remove"
+	opTrash   = "trash"
+	opRestore = "restore"
+	opPurge   = "purge"
+	opClaim   = "claim"
+
+	opBoard       = "board"
+	opRemoveBoard = "remove_board"
+	opList        = "list"
+	opRemoveList  = "remove_list"
+	opLabel       = "label"
+	opRemoveLabel = "remove_label"
+	opUser        = "user"
+	opToken       = "token"
+	opRemoveToken = "remove_token"
+	opBatch       = "batch"
+)
+
+// DefaultSnapshotEvery is how many log entries are written before compacting
+const DefaultSnapshotEvery = 1000
+
+// logEntry is a line in the write-ahead log.
+// Entries carry the whole state, so replaying one twice is harmless
+type logEntry struct {
+	Op       string       `json:"op"`
+	Card     *cards.Card  `json:"card,omitempty"`
+	Board    *cards.Board `json:"board,omitempty"`
+	List     *cards.List  `json:"list,omitempty"`
+	Label    *cards.Label `json:"label,omitempty"`
+	Account  *Account     `json:"account,omitempty"`
+	Token    *apiToken    `json:"token,omitempty"`
+	ID       int64        `json:"id,omitempty"`
+	Revision *Revision    `json:"revision,omitempty"`
+	// Owner is who claims the history of card ID
+	Owner int64 `json:"owner,omitempty"`
+	// Batch are the entries of a batch, logged in one line so a
+	// crash keeps all of them or none
+	Batch []logEntry `json:"batch,omitempty"`
+}
+
+// snapshot is the whole database at some point of the log
+type snapshot struct {
+	Index   int64                 `json:"index"`
+	Cards   []*cards.Card         `json:"cards"`
+	Trash   []*cards.Card         `json:"trash"`
+	History map[int64][]*Revision `json:"history"`
+
+	BoardIndex int64          `json:"board_index"`
+	Boards     []*cards.Board `json:"boards"`
+	ListIndex  int64          `json:"list_index"`
+	Lists      []*cards.List  `json:"lists"`
+	LabelIndex int64          `json:"label_index"`
+	Labels     []*cards.Label `json:"labels"`
+	UserIndex  int64          `json:"user_index"`
+	Accounts   []*Account     `json:"accounts"`
+	Tokens     []*apiToken    `json:"tokens"`
+}
+
+// OpenMemoryDB loads a memory database from dir, replaying the
+// snapshot and the log, and keeps logging every change there.
+// The log is compacted into a new snapshot every snapshotEvery
+// entries, zero uses DefaultSnapshotEvery.
+func OpenMemoryDB(dir string, snapshotEvery int) (*MemoryDB, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m := NewMemoryDB()
+	m.dir = dir
+	m.snapshotEvery = snapshotEvery
+	if err := m.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := m.replay(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	m.log = f
+	return m, nil
+}
+
+// loadSnapshot reads the last snapshot, if there's one
+func (m *MemoryDB) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(m.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := snapshot{}
+	if err = json.NewDecoder(f).Decode(&s); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+	m.index = s.Index
+	m.cardList = s.Cards
+	if s.Trash != nil {
+		m.trash = s.Trash
+	}
+	if s.History != nil {
+		m.history = s.History
+	}
+	m.boardIndex, m.listIndex = s.BoardIndex, s.ListIndex
+	if s.Boards != nil {
+		m.boards = s.Boards
+	}
+	if s.Lists != nil {
+		m.lists = s.Lists
+	}
+	m.labelIndex = s.LabelIndex
+	if s.Labels != nil {
+		m.labels = s.Labels
+	}
+	m.userIndex = s.UserIndex
+	if s.Accounts != nil {
+		m.accounts = s.Accounts
+	}
+	for _, token := range s.Tokens {
+		m.tokens[token.Hash] = token
+	}
+	// the label index and the counts are not saved, they're built from the cards
+	for _, cardList := range [][]*cards.Card{m.cardList, m.trash} {
+		for _, card := range cardList {
+			m.relabel(card.ID, card.Labels)
+			*m.counter(card.ID)++
+		}
+	}
+	return nil
+}
+
+// replay applies every entry of the log on top of the snapshot.
+// A broken last line is a write interrupted by a crash and is dropped
+func (m *MemoryDB) replay() error {
+	path := filepath.Join(m.dir, logFile)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		entry := logEntry{}
+		if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil || err == io.EOF {
+			// only the last line can be broken
+			if _, peek := r.Peek(1); peek != io.EOF {
+				return fmt.Errorf("log: broken entry at byte %d", offset)
+			}
+			return os.Truncate(path, offset)
+		}
+		if err != nil {
+			return err
+		}
+		m.apply(entry)
+		m.logged++
+		offset += int64(len(line))
+	}
+}
+
+// write appends the entry to the log, compacting it when it's too long.
+// Callers must hold the lock
+func (m *MemoryDB) write(entry logEntry) error {
+	if m.log == nil {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = m.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = m.log.Sync(); err != nil {
+		return err
+	}
+	m.logged++
+	if m.logged < m.snapshotEvery {
+		return nil
+	}
+	// the snapshot must include the entry, applying it again when it is
+	// already applied changes nothing
+	m.apply(entry)
+	// the entry is safe in the log, a failed compaction is tried again
+	// on the next write
+	if err = m.snapshot(); err != nil {
+		log.Println("snapshot:", err)
+	}
+	return nil
+}
+
+// Snapshot compacts the log into a new snapshot
+func (m *MemoryDB) Snapshot() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.log == nil {
+		return nil
+	}
+	return m.snapshot()
+}
+
+// snapshot writes the state to a temporary file, renames it over the
+// old snapshot and only then empties the log. Callers must hold the lock
+func (m *MemoryDB) snapshot() error {
+	tmp, err := os.CreateTemp(m.dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// expired tokens are left behind
+	tokens := []*apiToken{}
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.ExpiresAt.After(now) {
+			tokens = append(tokens, token)
+		}
+	}
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = json.NewEncoder(tmp).Encode(snapshot{
+			Index: m.index, Cards: m.cardList, Trash: m.trash, History: m.history,
+			BoardIndex: m.boardIndex, Boards: m.boards, ListIndex: m.listIndex, Lists: m.lists,
+			LabelIndex: m.labelIndex, Labels: m.labels,
+			UserIndex: m.userIndex, Accounts: m.accounts, Tokens: tokens,
+		})
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(m.dir, snapshotFile)); err != nil {
+		return err
+	}
+	if err = m.log.Truncate(0); err != nil {
+		return err
+	}
+	m.logged = 0
+	return nil
+}
+
+// Close flushes a snapshot and closes the log
+func (m *MemoryDB) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	if m.log == nil {
+		return nil
+	}
+	err := m.snapshot()
+	if closeErr := m.log.Close(); err == nil {
+		err = closeErr
+	}
+	m.log = nil
+	return err
+}
+
+// Ping fails once the database is closed
+func (m *MemoryDB) Ping() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
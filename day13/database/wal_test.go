@@ -0,0 +1,206 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+)
+
+// openLogged opens a memory database in dir that never compacts by itself
+func openLogged(t *testing.T, dir string) *database.MemoryDB {
+	t.Helper()
+	db, err := database.OpenMemoryDB(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWALDamagedLog(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// damage changes the log of cards a, b and c
+		damage func(log []byte) []byte
+		// titles are the cards replayed, nil when the log can't be opened
+		titles []string
+	}{
+		{"intact", func(log []byte) []byte { return log }, []string{"a", "b", "c"}},
+		{"last line cut", func(log []byte) []byte { return log[:len(log)-10] }, []string{"a", "b"}},
+		{"last line without newline", func(log []byte) []byte { return log[:len(log)-1] }, []string{"a", "b"}},
+		{"broken line in the middle", func(log []byte) []byte {
+			lines := strings.SplitAfter(string(log), "\n")
+			lines[1] = "{broken\n"
+			return []byte(strings.Join(lines, ""))
+		}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := openLogged(t, dir)
+			for _, title := range []string{"a", "b", "c"} {
+				if err := db.CreateCard(&cards.Card{Title: title, Text: "text"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := filepath.Join(dir, "cards.log")
+			log, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(path, test.damage(log), 0644); err != nil {
+				t.Fatal(err)
+			}
+			reopened, err := database.OpenMemoryDB(dir, 1000)
+			if test.titles == nil {
+				if err == nil {
+					reopened.Close()
+					t.Fatal("expected the broken log to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			var titles []string
+			for _, card := range reopened.AllCards() {
+				titles = append(titles, card.Title)
+			}
+			if strings.Join(titles, "") != strings.Join(test.titles, "") {
+				t.Fatalf("expected cards %v but %v was obtained", test.titles, titles)
+			}
+			// what is written after a cut line is replayed too
+			if err = reopened.CreateCard(&cards.Card{Title: "d", Text: "text"}); err != nil {
+				t.Fatal(err)
+			}
+			again := openLogged(t, dir)
+			defer again.Close()
+			if all := again.AllCards(); len(all) != len(test.titles)+1 || all[len(all)-1].Title != "d" {
+				t.Errorf("expected the card written after the replay but %+v was obtained", all)
+			}
+		})
+	}
+}
+
+func TestWALSnapshotAndLog(t *testing.T) {
+	dir := t.TempDir()
+	db := openLogged(t, dir)
+	for _, title := range []string{"a", "b"} {
+		db.CreateCard(&cards.Card{Title: title, Text: "text"})
+	}
+	if err := db.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "cards.log")); err != nil || info.Size() != 0 {
+		t.Fatalf("expected an empty log after the snapshot but %v was obtained (%v)", info, err)
+	}
+	// after the snapshot the changes are only in the log
+	db.UpdateCard(&cards.Card{ID: 1, Done: true})
+	db.RemoveCard(2, 0)
+	db.CreateCard(&cards.Card{Title: "c", Text: "text"})
+
+	reopened := openLogged(t, dir)
+	defer reopened.Close()
+	all := reopened.AllCards()
+	if len(all) != 2 || !all[0].Done || all[1].ID != 3 {
+		t.Errorf("expected cards 1 (done) and 3 but %+v was obtained", all)
+	}
+	if trash, err := reopened.TrashedCards(); err != nil || len(trash) != 1 || trash[0].ID != 2 {
+		t.Errorf("expected card 2 in the trash but %v was obtained (%v)", trash, err)
+	}
+	// the ids of removed cards are not handed out again
+	card := &cards.Card{Title: "d", Text: "text"}
+	reopened.CreateCard(card)
+	if card.ID != 4 {
+		t.Errorf("expected id 4 but %d was obtained", card.ID)
+	}
+}
+
+func TestWALConcurrentWrites(t *testing.T) {
+	const workers, perWorker = 8, 25
+	dir := t.TempDir()
+	db := openLogged(t, dir)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				card := &cards.Card{Title: "card", Text: "text"}
+				if err := db.CreateCard(card); err != nil {
+					t.Error(err)
+					return
+				}
+				db.UpdateCard(&cards.Card{ID: card.ID, Done: true, Version: 1})
+			}
+		}()
+	}
+	wg.Wait()
+	// no Close, every line must be in the log already
+	reopened := openLogged(t, dir)
+	defer reopened.Close()
+	all := reopened.AllCards()
+	if len(all) != workers*perWorker {
+		t.Fatalf("expected %d cards but %d were obtained", workers*perWorker, len(all))
+	}
+	for i, card := range all {
+		if card.ID != int64(i+1) || !card.Done || card.Version != 2 {
+			t.Fatalf("expected card %d done at version 2 but %+v was obtained", i+1, card)
+		}
+	}
+}
+
+func TestWALFailedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.OpenMemoryDB(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a directory where the snapshot goes makes every compaction fail
+	blocker := filepath.Join(dir, "cards.snapshot", "blocker")
+	if err = os.MkdirAll(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the changes are in the log, so they succeed all the same
+	if err = db.CreateCard(&cards.Card{Title: "a", Text: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Batch(func(tx database.Database) error {
+		return tx.CreateCard(&cards.Card{Title: "b", Text: "text"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all := db.AllCards(); len(all) != 2 {
+		t.Fatalf("expected 2 cards but %+v was obtained", all)
+	}
+	if err = os.RemoveAll(filepath.Join(dir, "cards.snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openLogged(t, dir)
+	defer reopened.Close()
+	if all := reopened.AllCards(); len(all) != 2 || all[1].Title != "b" {
+		t.Errorf("expected cards a and b from the log but %+v was obtained", all)
+	}
+}
+
+func TestWALClaimedHistory(t *testing.T) {
+	dir := t.TempDir()
+	db := openLogged(t, dir)
+	if err := db.CreateCard(&cards.Card{Title: "a", Text: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.ClaimOrphans(1); err != nil || n != 1 {
+		t.Fatalf("expected 1 card claimed but %d was obtained (%v)", n, err)
+	}
+	// the history is claimed again by the replay
+	reopened := openLogged(t, dir)
+	defer reopened.Close()
+	if revisions, err := reopened.For(1).CardHistory(1); err != nil || revisions[0].Card.OwnerID != 1 {
+		t.Errorf("expected the history of the claimed card but %v was obtained (%v)", revisions, err)
+	}
+}
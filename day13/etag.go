@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// requireIfMatch makes PUT, PATCH and DELETE fail without If-Match
+var requireIfMatch bool
+
+// setETag exposes the card version as a strong entity tag
+func setETag(w http.ResponseWriter, card *cards.Card) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(card.Version, 10)))
+}
+
+// ifMatch reads the expected version from If-Match.
+// Zero means any version ("*") and -1 a tag that never matches.
+func ifMatch(r *http.Request) (version int64, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		return -1, true
+	}
+	version, err = strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 1 {
+		return -1, true
+	}
+	return version, true
+}
+
+// checkIfMatch returns the expected version, rendering 428 when
+// the header is required but missing
+func checkIfMatch(w http.ResponseWriter, r *http.Request) (version int64, ok bool) {
+	version, present := ifMatch(r)
+	if !present && requireIfMatch {
+		// STATUS 428 - PRECONDITION REQUIRED
+		renderProblem(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	put := `{"title":"milk","text":"sell"}`
+	merge := `{"done":true}`
+	for _, test := range []struct {
+		name    string
+		require bool
+		method  string
+		body    string
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{name: "put without the header", method: http.MethodPut, body: put, status: http.StatusOK, etag: `"2"`},
+		{name: "put of the stored version", method: http.MethodPut, body: put, ifMatch: `"1"`, status: http.StatusOK, etag: `"2"`},
+		{name: "put of any version", method: http.MethodPut, body: put, ifMatch: "*", status: http.StatusOK, etag: `"2"`},
+		{name: "put of a stale version", method: http.MethodPut, body: put, ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "put of a weak tag", method: http.MethodPut, body: put, ifMatch: `W/"1"`, status: http.StatusPreconditionFailed},
+		{name: "put of an unquoted tag", method: http.MethodPut, body: put, ifMatch: "1", status: http.StatusPreconditionFailed},
+		{name: "patch of a stale version", method: http.MethodPatch, body: merge, ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "delete of a stale version", method: http.MethodDelete, ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "delete of the stored version", method: http.MethodDelete, ifMatch: `"1"`, status: http.StatusNoContent},
+		{name: "required put", require: true, method: http.MethodPut, body: put, status: http.StatusPreconditionRequired},
+		{name: "required patch", require: true, method: http.MethodPatch, body: merge, status: http.StatusPreconditionRequired},
+		{name: "required delete", require: true, method: http.MethodDelete, status: http.StatusPreconditionRequired},
+		{name: "required and given", require: true, method: http.MethodPatch, body: merge, ifMatch: `"1"`, status: http.StatusOK, etag: `"2"`},
+		{name: "required and stale", require: true, method: http.MethodPatch, body: merge, ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := testServer(t)
+			token := testToken(t, server, "alice")
+			createCards(t, server, token, "milk")
+			requireIfMatch = test.require
+			defer func() { requireIfMatch = false }()
+
+			var headers []string
+			if test.ifMatch != "" {
+				headers = []string{"If-Match", test.ifMatch}
+			}
+			resp, body := call(t, server, token, test.method, "/cards/1", test.body, headers...)
+			if resp.StatusCode != test.status || resp.Header.Get("ETag") != test.etag {
+				t.Fatalf("status = %d, ETag = %q, body = %s", resp.StatusCode, resp.Header.Get("ETag"), body)
+			}
+			if test.status >= http.StatusBadRequest && resp.Header.Get("Content-Type") != problemType {
+				t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+			}
+			// a failed precondition leaves the card as it was
+			if test.status >= http.StatusBadRequest {
+				if resp, body = call(t, server, token, http.MethodGet, "/cards/1", ""); resp.Header.Get("ETag") != `"1"` {
+					t.Errorf("status = %d, ETag = %q, body = %s", resp.StatusCode, resp.Header.Get("ETag"), body)
+				}
+			}
+		})
+	}
+}
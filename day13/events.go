@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/stream"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+)
+
+// hooks delivers the card events to the webhooks
+var hooks *webhook.Dispatcher
+
+// events streams the card changes to GET /cards/events
+var events *streams
+
+// streams keeps a stream for each user, so users only see their cards
+type streams struct {
+	mu        sync.Mutex
+	size      int
+	heartbeat time.Duration
+	brokers   map[int64]*stream.Broker
+	closed    bool
+}
+
+// newStreams returns the streams whose brokers buffer size events
+func newStreams(size int, heartbeat time.Duration) *streams {
+	return &streams{size: size, heartbeat: heartbeat, brokers: map[int64]*stream.Broker{}}
+}
+
+// of returns the stream of owner, creating it the first time
+func (s *streams) of(owner int64) *stream.Broker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.brokers[owner]
+	if !ok {
+		b = stream.NewBroker(s.size)
+		b.Heartbeat = s.heartbeat
+		if s.closed {
+			b.Close()
+		}
+		s.brokers[owner] = b
+	}
+	return b
+}
+
+// close disconnects the clients of every stream, so the server can shut
+// down without waiting for them. The streams created later start closed
+func (s *streams) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, b := range s.brokers {
+		b.Close()
+	}
+}
+
+// cardEvents streams the changes of the cards of the user
+func cardEvents(w http.ResponseWriter, r *http.Request) {
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if _, err := strconv.ParseUint(lastID, 10, 64); err != nil {
+			renderProblem(w, "Last-Event-ID must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	events.of(currentUser(r).ID).ServeHTTP(w, r)
+}
+
+// publish sends an event of a card to the webhooks and,
+// when it's a change of the card, to the stream
+func publish(event string, card *cards.Card) {
+	e := webhook.Event{Type: event, At: time.Now().UTC(), Card: card}
+	hooks.Publish(e)
+	switch event {
+	case webhook.EventCreated, webhook.EventUpdated, webhook.EventDeleted, webhook.EventRestored, webhook.EventPurged:
+		data, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("stream %s of card %d: %v", event, card.ID, err)
+			return
+		}
+		events.of(card.OwnerID).Publish(event, data)
+	}
+}
+
+// publishUpdate sends the update of a card, and its completion when
+// it was not done before
+func publishUpdate(before, after *cards.Card) {
+	publish(webhook.EventUpdated, after)
+	if after.Done && before != nil && !before.Done {
+		publish(webhook.EventCompleted, after)
+	}
+}
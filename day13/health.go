@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+)
+
+// health is the answer of the health checks
+type health struct {
+	Status string `json:"status"`
+}
+
+// healthz tells the server is running, it does not check the database
+// so a slow database does not get the server restarted
+func healthz(w http.ResponseWriter, r *http.Request) {
+	RenderJSON(w, health{Status: "ok"}, http.StatusOK)
+}
+
+// readyz tells if the server can serve requests, which needs the database
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if err := db.Ping(); err != nil {
+		// STATUS 503 - SERVICE UNAVAILABLE
+		renderProblem(w, "database: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	RenderJSON(w, health{Status: "ok"}, http.StatusOK)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/gorilla/mux"
+)
+
+func cardHistory(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	revisions, err := store(r).CardHistory(id)
+	switch err {
+	case database.ErrCardNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case nil:
+		RenderJSON(w, revisions, http.StatusOK)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func cardRevision(w http.ResponseWriter, r *http.Request) {
+	// Get the id and the revision from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	rev, err := strconv.ParseInt(vars["rev"], 10, 64)
+	if err != nil {
+		renderProblem(w, "invalid rev", http.StatusBadRequest)
+		return
+	}
+	revision, err := store(r).CardRevision(id, rev)
+	switch err {
+	case database.ErrCardNotFound, database.ErrRevisionNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case nil:
+		RenderJSON(w, revision, http.StatusOK)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func revertCard(w http.ResponseWriter, r *http.Request) {
+	// Get the id and the revision from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	rev, err := strconv.ParseInt(vars["rev"], 10, 64)
+	if err != nil {
+		renderProblem(w, "invalid rev", http.StatusBadRequest)
+		return
+	}
+	version, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	revision, err := store(r).CardRevision(id, rev)
+	switch err {
+	case database.ErrCardNotFound, database.ErrRevisionNotFound:
+		renderError(w, err, http.StatusNotFound)
+		return
+	case nil:
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if revision.Op == database.RevisionDelete {
+		// STATUS 409 - CONFLICT
+		renderProblem(w, "can not revert to a deleted card", http.StatusConflict)
+		return
+	}
+	before, _ := store(r).GetCard(id)
+	// the revert is a new revision with the old values
+	card := cards.Card{
+		ID:       id,
+		Title:    revision.Card.Title,
+		Text:     revision.Card.Text,
+		Done:     revision.Card.Done,
+		DueAt:    revision.Card.DueAt,
+		RemindAt: revision.Card.RemindAt,
+		Version:  version,
+	}
+	updated, err := store(r).UpdateCard(&card)
+	switch err {
+	case database.ErrCardNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case database.ErrVersionMismatch:
+		renderError(w, err, http.StatusPreconditionFailed)
+	case nil:
+		setETag(w, updated)
+		RenderJSON(w, updated, http.StatusOK)
+		publishUpdate(before, updated)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
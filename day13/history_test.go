@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+)
+
+func TestCardHistory(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	createCards(t, server, token, "milk")
+	call(t, server, token, http.MethodPut, "/cards/1", `{"title":"milk","text":"sell"}`)
+	call(t, server, token, http.MethodPatch, "/cards/1", `{"done":true}`)
+
+	resp, body := call(t, server, token, http.MethodGet, "/cards/1/history", "")
+	history := []database.Revision{}
+	if err := json.Unmarshal(body, &history); err != nil || resp.StatusCode != http.StatusOK || len(history) != 3 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+	for i, op := range []string{database.RevisionCreate, database.RevisionUpdate, database.RevisionUpdate} {
+		if r := history[i]; r.Rev != int64(i+1) || r.Op != op || r.Author != "alice" || r.CardID != 1 {
+			t.Errorf("revision %d: expected %s by alice but %+v was obtained", i+1, op, r)
+		}
+	}
+	if changes := history[1].Changes; len(changes) != 1 || changes[0] != (database.Change{Field: "text", Old: "text", New: "sell"}) {
+		t.Errorf("expected the text to change but %+v was obtained", changes)
+	}
+
+	resp, body = call(t, server, token, http.MethodGet, "/cards/1/history/2", "")
+	revision := database.Revision{}
+	if err := json.Unmarshal(body, &revision); err != nil || resp.StatusCode != http.StatusOK || revision.Card.Text != "sell" || revision.Card.Done {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	// reverting is one more revision with the old values
+	resp, body = call(t, server, token, http.MethodPost, "/cards/1/revert/1", "", "If-Match", `"3"`)
+	card := cards.Card{}
+	if err := json.Unmarshal(body, &card); err != nil || resp.StatusCode != http.StatusOK || card.Text != "text" || card.Done || card.Version != 4 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") != `"4"` {
+		t.Errorf("ETag = %q", resp.Header.Get("ETag"))
+	}
+	if _, body = call(t, server, token, http.MethodGet, "/cards/1/history", ""); json.Unmarshal(body, &history) != nil || len(history) != 4 || history[3].Op != database.RevisionUpdate {
+		t.Errorf("expected the revert in the history but %s was obtained", body)
+	}
+}
+
+func TestCardHistoryErrors(t *testing.T) {
+	server := testServer(t)
+	alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+	createCards(t, server, alice, "milk", "bread")
+	// bread is deleted and restored, its revision 2 is the delete
+	call(t, server, alice, http.MethodDelete, "/cards/2", "")
+	call(t, server, alice, http.MethodPost, "/trash/2/restore", "")
+
+	for _, test := range []struct {
+		name    string
+		token   string
+		method  string
+		path    string
+		ifMatch string
+		status  int
+	}{
+		{"history of an unknown card", alice, http.MethodGet, "/cards/9/history", "", http.StatusNotFound},
+		{"history of a card of another user", bob, http.MethodGet, "/cards/1/history", "", http.StatusNotFound},
+		{"unknown revision", alice, http.MethodGet, "/cards/1/history/9", "", http.StatusNotFound},
+		{"revision of a card of another user", bob, http.MethodGet, "/cards/1/history/1", "", http.StatusNotFound},
+		{"revert to an unknown revision", alice, http.MethodPost, "/cards/1/revert/9", "", http.StatusNotFound},
+		{"revert of a card of another user", bob, http.MethodPost, "/cards/1/revert/1", "", http.StatusNotFound},
+		{"revert of a stale version", alice, http.MethodPost, "/cards/1/revert/1", `"2"`, http.StatusPreconditionFailed},
+		{"revert to a delete", alice, http.MethodPost, "/cards/2/revert/2", "", http.StatusConflict},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var headers []string
+			if test.ifMatch != "" {
+				headers = []string{"If-Match", test.ifMatch}
+			}
+			resp, body := call(t, server, test.token, test.method, test.path, "", headers...)
+			if resp.StatusCode != test.status || resp.Header.Get("Content-Type") != problemType {
+				t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+			}
+		})
+	}
+	// no revert was made
+	history := []database.Revision{}
+	_, body := call(t, server, alice, http.MethodGet, "/cards/1/history", "")
+	if err := json.Unmarshal(body, &history); err != nil || len(history) != 1 {
+		t.Errorf("expected only the creation of the card but %s was obtained", body)
+	}
+}
@@ -0,0 +1,220 @@
+// Package idempotency is a negroni middleware that makes retrying a POST
+// safe. The first response to a request with an Idempotency-Key header is
+// kept with a fingerprint of the request, the retries with the same key
+// get it back instead of running again.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// headers of an idempotent request and of a replayed response
+const (
+	KeyHeader      = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// MaxKeyLength is how long a key can be
+const MaxKeyLength = 255
+
+// DefaultMaxBodyBytes is how long the body of a request with a key can be
+const DefaultMaxBodyBytes = 10 << 20
+
+// DefaultRunning is how long a key is reserved while its first request runs
+const DefaultRunning = 5 * time.Minute
+
+// keptHeaders are the headers of a response kept to be replayed
+var keptHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Response is a response kept to be replayed
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is what a store knows about a key. Response is nil while the
+// first request is still running
+type Record struct {
+	Fingerprint string
+	Response    *Response
+}
+
+// Store keeps the keys until they expire, a store shared by many
+// servers makes a retry sent to another server a replay as well
+type Store interface {
+	// Reserve records key as running a request with fingerprint until
+	// expires. When key is recorded and did not expire at now, nothing
+	// changes and its record is returned
+	Reserve(key, fingerprint string, now, expires time.Time) (*Record, error)
+	// Save keeps the response of a reserved key until expires
+	Save(key string, response Response, expires time.Time) error
+	// Release forgets a reserved key, so the request can be sent again
+	Release(key string) error
+}
+
+// Handler is the middleware, it only looks at POST requests
+type Handler struct {
+	// TTL is how long a key is kept
+	TTL time.Duration
+	// Running is how long a key is reserved while its first request
+	// runs, so the key of a server that crashed before answering is
+	// free again once it passes. By default it's DefaultRunning
+	Running time.Duration
+	// MaxBodyBytes is how long the body of a request with a key can be,
+	// a longer one answers 413 Request Entity Too Large. By default it's
+	// DefaultMaxBodyBytes
+	MaxBodyBytes int64
+	// Scope tells the clients apart, so they can use the same keys.
+	// By default every client shares the keys
+	Scope func(r *http.Request) string
+	// Reject answers the requests that can not run, with the status
+	// and why. By default it answers with a json error
+	Reject func(w http.ResponseWriter, r *http.Request, status int, detail string)
+
+	store Store
+}
+
+// New returns a middleware keeping the keys in store for ttl
+func New(store Store, ttl time.Duration) *Handler {
+	return &Handler{TTL: ttl, store: store}
+}
+
+// Fingerprint is the hash of the method, the url and the body of a request
+func Fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ServeHTTP runs the first request of a key and replays its response to
+// the next ones. A key used with another request answers 422 Unprocessable
+// Entity and a key whose first request is running answers 409 Conflict.
+// Server errors are not kept, so the request can be retried
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	key := r.Header.Get(KeyHeader)
+	if r.Method != http.MethodPost || key == "" {
+		next(w, r)
+		return
+	}
+	if len(key) > MaxKeyLength {
+		h.reject(w, r, http.StatusBadRequest, KeyHeader+" is too long")
+		return
+	}
+	limit := h.MaxBodyBytes
+	if limit == 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	r.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.reject(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("a request with %s can have at most %d bytes", KeyHeader, limit))
+		return
+	}
+	if err != nil {
+		h.reject(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if h.Scope != nil {
+		key = h.Scope(r) + "|" + key
+	}
+	fingerprint := Fingerprint(r, body)
+	running := h.Running
+	if running == 0 {
+		running = DefaultRunning
+	}
+	if running > h.TTL {
+		running = h.TTL
+	}
+	now := time.Now()
+	record, err := h.store.Reserve(key, fingerprint, now, now.Add(running))
+	switch {
+	case err != nil:
+		h.reject(w, r, http.StatusInternalServerError, err.Error())
+	case record == nil:
+		h.run(w, r, next, key)
+	case record.Fingerprint != fingerprint:
+		h.reject(w, r, http.StatusUnprocessableEntity, KeyHeader+" was used by another request")
+	case record.Response == nil:
+		h.reject(w, r, http.StatusConflict, "the request of this "+KeyHeader+" is still running")
+	default:
+		replay(w, record.Response)
+	}
+}
+
+// run runs the first request of key and keeps its response. The key is
+// released when the response is not kept, even when next panics
+func (h *Handler) run(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, key string) {
+	rec := &recorder{ResponseWriter: w}
+	saved := false
+	defer func() {
+		if !saved {
+			h.store.Release(key)
+		}
+	}()
+	next(rec, r)
+	if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+		return
+	}
+	response := Response{Status: rec.status, Header: http.Header{}, Body: rec.body.Bytes()}
+	for _, name := range keptHeaders {
+		if value := w.Header().Get(name); value != "" {
+			response.Header.Set(name, value)
+		}
+	}
+	saved = h.store.Save(key, response, time.Now().Add(h.TTL)) == nil
+}
+
+// reject answers a request that can not run
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if h.Reject != nil {
+		h.Reject(w, r, status, detail)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"errors": detail})
+}
+
+// replay writes a kept response again
+func replay(w http.ResponseWriter, response *Response) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
+
+// recorder copies the response it writes
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
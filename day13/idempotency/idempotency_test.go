@@ -0,0 +1,234 @@
+package idempotency_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/idempotency"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// stores runs test against every store
+func stores(t *testing.T, test func(t *testing.T, s idempotency.Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, idempotency.NewMemoryStore(time.Hour))
+	})
+	t.Run("sql", func(t *testing.T) {
+		db, err := sqlx.Connect("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		s, err := idempotency.NewSQLStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, s)
+	})
+}
+
+func TestStore(t *testing.T) {
+	stores(t, func(t *testing.T, s idempotency.Store) {
+		now := time.Now()
+		if record, err := s.Reserve("a", "f1", now, now.Add(time.Minute)); record != nil || err != nil {
+			t.Fatalf("record = %+v, err = %v", record, err)
+		}
+		// running
+		record, err := s.Reserve("a", "f2", now, now.Add(time.Minute))
+		if err != nil || record == nil || record.Fingerprint != "f1" || record.Response != nil {
+			t.Fatalf("record = %+v, err = %v", record, err)
+		}
+		response := idempotency.Response{Status: http.StatusCreated, Header: http.Header{"Etag": {`"1"`}}, Body: []byte("{}")}
+		// the response is kept longer than the request was reserved
+		if err = s.Save("a", response, now.Add(2*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		record, err = s.Reserve("a", "f1", now.Add(time.Minute), now.Add(time.Minute))
+		if err != nil || record == nil || record.Response == nil {
+			t.Fatalf("record = %+v, err = %v", record, err)
+		}
+		if got := record.Response; got.Status != http.StatusCreated || got.Header.Get("ETag") != `"1"` || string(got.Body) != "{}" {
+			t.Fatalf("response = %+v", got)
+		}
+		// expired keys can be used again
+		if record, err = s.Reserve("a", "f2", now.Add(2*time.Minute), now.Add(3*time.Minute)); record != nil || err != nil {
+			t.Fatalf("record = %+v, err = %v", record, err)
+		}
+		if err = s.Release("a"); err != nil {
+			t.Fatal(err)
+		}
+		if record, err = s.Reserve("a", "f3", now, now.Add(time.Minute)); record != nil || err != nil {
+			t.Fatalf("record = %+v, err = %v", record, err)
+		}
+	})
+}
+
+func TestExpiredKeysAreEvicted(t *testing.T) {
+	s := idempotency.NewMemoryStore(time.Minute)
+	now := time.Now()
+	s.Reserve("old", "f", now, now.Add(time.Second))
+	s.Reserve("kept", "f", now, now.Add(time.Hour))
+	s.Reserve("new", "f", now.Add(time.Minute), now.Add(time.Hour))
+	if got := s.Len(); got != 2 {
+		t.Fatalf("keys = %d, want kept and new", got)
+	}
+}
+
+// counter is a handler creating a card for each request it runs
+type counter struct {
+	runs   int
+	status int
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.runs++
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, c.runs))
+	w.Header().Set("X-Other", "not kept")
+	w.WriteHeader(c.status)
+	fmt.Fprintf(w, `{"id":%d,"body":%s}`, c.runs, body)
+}
+
+// post sends a request through the middleware
+func post(h *idempotency.Handler, next http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotency.KeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req, next.ServeHTTP)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	stores(t, func(t *testing.T, s idempotency.Store) {
+		h := idempotency.New(s, time.Hour)
+		next := &counter{status: http.StatusCreated}
+		first := post(h, next, "/cards", "k1", `{"title":"a"}`)
+		if first.Code != http.StatusCreated || first.Header().Get(idempotency.ReplayedHeader) != "" {
+			t.Fatalf("status = %d, headers = %v", first.Code, first.Header())
+		}
+		replayed := post(h, next, "/cards", "k1", `{"title":"a"}`)
+		if next.runs != 1 {
+			t.Fatalf("runs = %d", next.runs)
+		}
+		if replayed.Code != http.StatusCreated || replayed.Body.String() != first.Body.String() {
+			t.Fatalf("status = %d, body = %s", replayed.Code, replayed.Body)
+		}
+		if replayed.Header().Get("ETag") != `"1"` || replayed.Header().Get(idempotency.ReplayedHeader) != "true" || replayed.Header().Get("X-Other") != "" {
+			t.Fatalf("headers = %v", replayed.Header())
+		}
+		// the key was used by another request
+		for _, w := range []*httptest.ResponseRecorder{
+			post(h, next, "/cards", "k1", `{"title":"b"}`),
+			post(h, next, "/cards/batch", "k1", `{"title":"a"}`),
+		} {
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d", w.Code)
+			}
+		}
+		// without a key every request runs
+		post(h, next, "/cards", "", `{"title":"a"}`)
+		post(h, next, "/cards", "", `{"title":"a"}`)
+		if next.runs != 3 {
+			t.Fatalf("runs = %d", next.runs)
+		}
+		if w := post(h, next, "/cards", strings.Repeat("k", idempotency.MaxKeyLength+1), "{}"); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d", w.Code)
+		}
+
+		// server errors are not kept
+		failing := &counter{status: http.StatusInternalServerError}
+		post(h, failing, "/cards", "k2", "{}")
+		post(h, failing, "/cards", "k2", "{}")
+		if failing.runs != 2 {
+			t.Fatalf("runs = %d", failing.runs)
+		}
+		// nor a panic
+		func() {
+			defer func() { recover() }()
+			post(h, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("boom") }), "/cards", "k3", "{}")
+		}()
+		if w := post(h, next, "/cards", "k3", "{}"); w.Code != http.StatusCreated || w.Header().Get(idempotency.ReplayedHeader) != "" {
+			t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+		}
+	})
+}
+
+func TestRunningKey(t *testing.T) {
+	h := idempotency.New(idempotency.NewMemoryStore(time.Hour), time.Hour)
+	var inner *httptest.ResponseRecorder
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the retry arrives while the first request runs
+		inner = post(h, &counter{status: http.StatusCreated}, "/cards", "k", "{}")
+		w.WriteHeader(http.StatusCreated)
+	})
+	post(h, next, "/cards", "k", "{}")
+	if inner.Code != http.StatusConflict {
+		t.Fatalf("status = %d", inner.Code)
+	}
+}
+
+func TestCrashedKey(t *testing.T) {
+	h := idempotency.New(idempotency.NewMemoryStore(time.Hour), time.Hour)
+	h.Running = 50 * time.Millisecond
+	// the first request never answers, like on a server that crashed
+	stuck := make(chan bool)
+	defer close(stuck)
+	running := make(chan bool)
+	go post(h, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		running <- true
+		<-stuck
+	}), "/cards", "k", "{}")
+	<-running
+	next := &counter{status: http.StatusCreated}
+	if w := post(h, next, "/cards", "k", "{}"); w.Code != http.StatusConflict {
+		t.Fatalf("status = %d", w.Code)
+	}
+	time.Sleep(h.Running)
+	if w := post(h, next, "/cards", "k", "{}"); w.Code != http.StatusCreated || next.runs != 1 {
+		t.Fatalf("status = %d, runs = %d", w.Code, next.runs)
+	}
+	// the response is kept for the ttl, not for the time it ran
+	time.Sleep(h.Running)
+	if w := post(h, next, "/cards", "k", "{}"); w.Header().Get(idempotency.ReplayedHeader) != "true" || next.runs != 1 {
+		t.Fatalf("status = %d, runs = %d", w.Code, next.runs)
+	}
+}
+
+func TestLargeBody(t *testing.T) {
+	h := idempotency.New(idempotency.NewMemoryStore(time.Hour), time.Hour)
+	h.MaxBodyBytes = 10
+	next := &counter{status: http.StatusCreated}
+	if w := post(h, next, "/cards", "k", strings.Repeat(" ", 11)); w.Code != http.StatusRequestEntityTooLarge || next.runs != 0 {
+		t.Fatalf("status = %d, runs = %d", w.Code, next.runs)
+	}
+	if w := post(h, next, "/cards", "k", strings.Repeat(" ", 10)); w.Code != http.StatusCreated || next.runs != 1 {
+		t.Fatalf("status = %d, runs = %d", w.Code, next.runs)
+	}
+}
+
+func TestScopeAndReject(t *testing.T) {
+	h := idempotency.New(idempotency.NewMemoryStore(time.Hour), time.Hour)
+	h.Scope = func(r *http.Request) string { return r.URL.Query().Get("user") }
+	h.Reject = func(w http.ResponseWriter, r *http.Request, status int, detail string) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	next := &counter{status: http.StatusCreated}
+	post(h, next, "/cards?user=a", "k", "{}")
+	// clients with the same key do not see each other
+	if w := post(h, next, "/cards?user=b", "k", "{}"); w.Code != http.StatusCreated || next.runs != 2 {
+		t.Fatalf("status = %d, runs = %d", w.Code, next.runs)
+	}
+	if w := post(h, next, "/cards?user=a", "k", `{"other":1}`); w.Code != http.StatusTeapot {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// entry is a key kept in memory
+type entry struct {
+	record  Record
+	expires time.Time
+}
+
+// MemoryStore keeps the keys in a map. Every sweep interval the keys
+// that expired are evicted
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	sweep     time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a store that evicts the expired keys every sweep
+func NewMemoryStore(sweep time.Duration) *MemoryStore {
+	return &MemoryStore{entries: map[string]*entry{}, sweep: sweep}
+}
+
+// Len is how many keys are kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Reserve records key, unless it is kept and did not expire
+func (s *MemoryStore) Reserve(key, fingerprint string, now, expires time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= s.sweep {
+		s.evict(now)
+		s.lastSweep = now
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		record := e.record
+		return &record, nil
+	}
+	s.entries[key] = &entry{record: Record{Fingerprint: fingerprint}, expires: expires}
+	return nil, nil
+}
+
+// Save keeps the response of key until expires
+func (s *MemoryStore) Save(key string, response Response, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.record.Response = &response
+		e.expires = expires
+	}
+	return nil
+}
+
+// Release forgets key
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// evict removes the keys that expired by now
+func (s *MemoryStore) evict(now time.Time) {
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// schema of the keys, a status of zero is a request still running and
+// expires_at is in unix nanoseconds
+var schema = []string{
+	`create table if not exists idempotency_keys (
+		idempotency_key text not null primary key,
+		fingerprint text not null,
+		status integer not null default 0,
+		header text not null default '',
+		body blob,
+		expires_at integer not null
+	)`,
+	`create index if not exists idempotency_keys_expires on idempotency_keys (expires_at)`,
+}
+
+// SQLStore keeps the keys in the idempotency_keys table, the expired
+// ones are deleted when a key is reserved
+type SQLStore struct {
+	db *sqlx.DB
+}
+
+// NewSQLStore returns a store in db, creating its table when missing
+func NewSQLStore(db *sqlx.DB) (*SQLStore, error) {
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// Reserve inserts key, unless it is kept and did not expire. The insert
+// only happens when the key is missing, so two requests racing for
+// the same key can not both run
+func (s *SQLStore) Reserve(key, fingerprint string, now, expires time.Time) (*Record, error) {
+	if _, err := s.db.Exec("delete from idempotency_keys where expires_at <= ?", now.UnixNano()); err != nil {
+		return nil, err
+	}
+	result, err := s.db.Exec(`insert into idempotency_keys (idempotency_key, fingerprint, expires_at)
+		select ?, ?, ? where not exists (select 1 from idempotency_keys where idempotency_key = ?)`,
+		key, fingerprint, expires.UnixNano(), key)
+	if err != nil {
+		return nil, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 1 {
+		return nil, err
+	}
+	row := struct {
+		Fingerprint string
+		Status      int
+		Header      string
+		Body        []byte
+	}{}
+	err = s.db.Get(&row, "select fingerprint, status, header, body from idempotency_keys where idempotency_key = ?", key)
+	if err == sql.ErrNoRows {
+		// released since the insert, try again
+		return s.Reserve(key, fingerprint, now, expires)
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{Fingerprint: row.Fingerprint}
+	if row.Status != 0 {
+		record.Response = &Response{Status: row.Status, Body: row.Body}
+		if err = json.Unmarshal([]byte(row.Header), &record.Response.Header); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// Save keeps the response of key until expires
+func (s *SQLStore) Save(key string, response Response, expires time.Time) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("update idempotency_keys set status = ?, header = ?, body = ?, expires_at = ? where idempotency_key = ?",
+		response.Status, string(header), response.Body, expires.UnixNano(), key)
+	return err
+}
+
+// Release deletes key
+func (s *SQLStore) Release(key string) error {
+	_, err := s.db.Exec("delete from idempotency_keys where idempotency_key = ?", key)
+	return err
+}
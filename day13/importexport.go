@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+)
+
+// limits of an import
+const (
+	maxImport      = 10000
+	maxImportBytes = 10 << 20
+)
+
+// formats of import and export, with their content types
+var formats = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"json":   "application/json; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+}
+
+// errRollback discards an import that is a dry run or has errors
+var errRollback = errors.New("rollback")
+
+// cardColumn is a column of the csv, set is nil when it's only exported
+type cardColumn struct {
+	name string
+	get  func(card *cards.Card) string
+	set  func(card *cards.Card, value string) error
+}
+
+// columns are the columns of the csv, in the order they are exported
+var columns = []cardColumn{
+	{"id", func(c *cards.Card) string { return strconv.FormatInt(c.ID, 10) }, nil},
+	{"title", func(c *cards.Card) string { return quoteFormula(c.Title) }, func(c *cards.Card, v string) error {
+		c.Title = unquoteFormula(v)
+		return nil
+	}},
+	{"text", func(c *cards.Card) string { return quoteFormula(c.Text) }, func(c *cards.Card, v string) error {
+		c.Text = unquoteFormula(v)
+		return nil
+	}},
+	{"done", func(c *cards.Card) string { return strconv.FormatBool(c.Done) }, func(c *cards.Card, v string) (err error) {
+		if v != "" {
+			c.Done, err = strconv.ParseBool(v)
+		}
+		return err
+	}},
+	{"list_id", func(c *cards.Card) string { return formatID(c.ListID) }, func(c *cards.Card, v string) (err error) {
+		if v != "" {
+			c.ListID, err = strconv.ParseInt(v, 10, 64)
+		}
+		return err
+	}},
+	{"position", func(c *cards.Card) string { return strconv.FormatFloat(c.Position, 'g', -1, 64) }, nil},
+	{"due_at", func(c *cards.Card) string { return formatTime(c.DueAt) }, func(c *cards.Card, v string) (err error) {
+		c.DueAt, err = parseTime(v)
+		return err
+	}},
+	{"remind_at", func(c *cards.Card) string { return formatTime(c.RemindAt) }, func(c *cards.Card, v string) (err error) {
+		c.RemindAt, err = parseTime(v)
+		return err
+	}},
+	{"version", func(c *cards.Card) string { return strconv.FormatInt(c.Version, 10) }, nil},
+}
+
+// quoteFormula keeps spreadsheets from running a text as a formula,
+// the texts that start like one, or with the quote itself, are quoted
+// with an apostrophe, which spreadsheets hide
+func quoteFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r'", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// unquoteFormula removes the quote of quoteFormula
+func unquoteFormula(text string) string {
+	return strings.TrimPrefix(text, "'")
+}
+
+// formatID leaves a zero id empty
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// formatTime writes a time as RFC 3339, empty when there's none
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseTime reads a RFC 3339 time, empty is no time
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a RFC 3339 time", value)
+	}
+	return &t, nil
+}
+
+// csvOptions are the query parameters of the csv format: comma is the
+// separator and columns maps headers to columns, as in "Name:title,Notes:text"
+type csvOptions struct {
+	comma rune
+	// headers of each column and columns of each header
+	headers map[string]string
+	fields  map[string]string
+}
+
+// parseCSVOptions reads the csv options of the query string
+func parseCSVOptions(r *http.Request) (*csvOptions, error) {
+	opts := &csvOptions{comma: ',', headers: map[string]string{}, fields: map[string]string{}}
+	if comma := r.URL.Query().Get("comma"); comma != "" {
+		c, size := utf8.DecodeRuneInString(comma)
+		if size != len(comma) || c == '"' || c == '\r' || c == '\n' {
+			return nil, fmt.Errorf("comma must be a single character")
+		}
+		opts.comma = c
+	}
+	mapping := r.URL.Query().Get("columns")
+	if mapping == "" {
+		return opts, nil
+	}
+	for _, pair := range strings.Split(mapping, ",") {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("columns must be pairs of header:column")
+		}
+		header, field := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if column(field) == nil {
+			return nil, fmt.Errorf("unknown column %q", field)
+		}
+		opts.headers[field], opts.fields[strings.ToLower(header)] = header, field
+	}
+	return opts, nil
+}
+
+// column returns the column called name, nil when there's none
+func column(name string) *cardColumn {
+	for i := range columns {
+		if columns[i].name == name {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// header is the name of a column in the csv
+func (opts *csvOptions) header(field string) string {
+	if header, ok := opts.headers[field]; ok {
+		return header
+	}
+	return field
+}
+
+// column returns the column of a header, nil when it's not imported
+func (opts *csvOptions) column(header string) *cardColumn {
+	header = strings.ToLower(strings.TrimSpace(header))
+	field, ok := opts.fields[header]
+	if !ok {
+		field = header
+	}
+	if c := column(field); c != nil && c.set != nil {
+		return c
+	}
+	return nil
+}
+
+// format reads the format of the query string, json by default
+func format(r *http.Request) (string, error) {
+	f := r.URL.Query().Get("format")
+	if f == "" {
+		return "json", nil
+	}
+	if _, ok := formats[f]; !ok {
+		return "", fmt.Errorf("format must be csv, json or ndjson")
+	}
+	return f, nil
+}
+
+// cardWriter writes the cards of an export in a format
+type cardWriter interface {
+	write(card *cards.Card) error
+	flush() error
+	close() error
+}
+
+// csvWriter writes a header and a row for each card
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, opts *csvOptions) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	cw.w.Comma = opts.comma
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = opts.header(c.name)
+	}
+	return cw, cw.w.Write(header)
+}
+
+func (cw *csvWriter) write(card *cards.Card) error {
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		record[i] = c.get(card)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) close() error {
+	return cw.flush()
+}
+
+// jsonWriter writes an array of cards, or a card per line when lines is set
+type jsonWriter struct {
+	w     io.Writer
+	lines bool
+	count int
+}
+
+func (jw *jsonWriter) write(card *cards.Card) error {
+	content, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	switch {
+	case jw.lines:
+		sep = ""
+		content = append(content, '\n')
+	case jw.count == 0:
+		sep = "["
+	}
+	jw.count++
+	_, err = io.WriteString(jw.w, sep+string(content))
+	return err
+}
+
+func (jw *jsonWriter) flush() error {
+	return nil
+}
+
+func (jw *jsonWriter) close() error {
+	if jw.lines {
+		return nil
+	}
+	end := "]\n"
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+// exportCards streams every card, or those matching the filters of
+// GET /cards, as csv, json or ndjson. The cards are read a page at a time
+func exportCards(w http.ResponseWriter, r *http.Request) {
+	f, err := format(r)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	opts, err := parseCSVOptions(r)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	values.Del("cursor")
+	values.Del("limit")
+	q, err := parseQuery(values)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	q.Limit = database.MaxLimit
+	view := store(r)
+	// the first page is read before answering, so its errors still get a status
+	page, err := view.QueryCards(q)
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", formats[f])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="cards.%s"`, f))
+	w.WriteHeader(http.StatusOK)
+	var out cardWriter = &jsonWriter{w: w, lines: f == "ndjson"}
+	if f == "csv" {
+		if out, err = newCSVWriter(w, opts); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	for {
+		for _, card := range page.Cards {
+			if err = out.write(card); err != nil {
+				// the client went away, the status is already sent
+				log.Println(err)
+				return
+			}
+		}
+		// each page is sent as soon as it's written
+		if err = out.flush(); err != nil {
+			log.Println(err)
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		if page.Next == nil {
+			break
+		}
+		q.Cursor = page.Next
+		if page, err = view.QueryCards(q); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err = out.close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// importRow is a card read from the import, or why it could not be read
+type importRow struct {
+	card cards.Card
+	err  error
+}
+
+// rowError is the error of a row, rows are counted from 1 without the csv header
+type rowError struct {
+	Row    int    `json:"row"`
+	Errors string `json:"errors"`
+	// InvalidParams are the fields of the row that did not validate
+	InvalidParams []invalidParam `json:"invalid_params,omitempty"`
+}
+
+// newRowError describes the error of a row, naming its fields as the
+// json of the api does
+func newRowError(row int, err error) rowError {
+	params := invalidParams(err)
+	if err == database.ErrListNotFound {
+		params = []invalidParam{{Name: "list_id", Reason: err.Error()}}
+	}
+	if len(params) == 0 {
+		return rowError{Row: row, Errors: strings.TrimSuffix(err.Error(), ";")}
+	}
+	reasons := make([]string, len(params))
+	for i, param := range params {
+		reasons[i] = param.Name + ": " + param.Reason
+	}
+	return rowError{Row: row, Errors: strings.Join(reasons, "; "), InvalidParams: params}
+}
+
+// importReport is what an import did, or would do when it's a dry run
+type importReport struct {
+	DryRun   bool       `json:"dry_run"`
+	Imported int        `json:"imported"`
+	Errors   []rowError `json:"errors,omitempty"`
+}
+
+// importProblem is the problem of an import with invalid rows
+type importProblem struct {
+	problem
+	importReport
+}
+
+// readCSV reads a card from each record, the first record is the header.
+// The columns not imported, like id and version, are skipped
+func readCSV(in io.Reader, opts *csvOptions) ([]importRow, error) {
+	r := csv.NewReader(in)
+	r.Comma = opts.comma
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*cardColumn, len(header))
+	for i, h := range header {
+		targets[i] = opts.column(h)
+	}
+	rows := []importRow{}
+	for record, err := r.Read(); err != io.EOF; record, err = r.Read() {
+		row := importRow{}
+		if _, ok := err.(*csv.ParseError); ok {
+			row.err = err
+		} else if err != nil {
+			return nil, err
+		}
+		for i := 0; row.err == nil && i < len(record); i++ {
+			if targets[i] != nil {
+				if err = targets[i].set(&row.card, strings.TrimSpace(record[i])); err != nil {
+					// named like the field, whatever the header
+					row.err = valid.Error{Name: targets[i].name, Err: err}
+				}
+			}
+		}
+		if rows = append(rows, row); len(rows) > maxImport {
+			return nil, errTooManyRows
+		}
+	}
+	return rows, nil
+}
+
+// errTooManyRows is raised when an import has more than maxImport cards
+var errTooManyRows = fmt.Errorf("an import can have at most %d cards", maxImport)
+
+// readJSON reads an array of cards
+func readJSON(in io.Reader) ([]importRow, error) {
+	d := json.NewDecoder(in)
+	t, err := d.Token()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if t != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array of cards")
+	}
+	rows := []importRow{}
+	for d.More() {
+		row := importRow{}
+		if err := d.Decode(&row.card); err != nil {
+			// a value of the wrong type is skipped, the rest is broken
+			if _, ok := err.(*json.UnmarshalTypeError); !ok {
+				return nil, err
+			}
+			row.err = err
+		}
+		if rows = append(rows, row); len(rows) > maxImport {
+			return nil, errTooManyRows
+		}
+	}
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readNDJSON reads a card from each line, blank lines are skipped
+func readNDJSON(in io.Reader) ([]importRow, error) {
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 64*1024), maxImportBytes)
+	rows := []importRow{}
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		row := importRow{}
+		row.err = json.Unmarshal([]byte(line), &row.card)
+		if rows = append(rows, row); len(rows) > maxImport {
+			return nil, errTooManyRows
+		}
+	}
+	return rows, s.Err()
+}
+
+// check validates the card of a row as createCard does
+func (row importRow) check(card *cards.Card) error {
+	if row.err != nil {
+		return row.err
+	}
+	if _, err := valid.ValidateStruct(card); err != nil {
+		return err
+	}
+	return validDates(card)
+}
+
+// importable keeps the fields of a card that are imported
+func importable(card cards.Card) cards.Card {
+	return cards.Card{
+		Title: card.Title, Text: card.Text, Done: card.Done,
+		ListID: card.ListID, DueAt: card.DueAt, RemindAt: card.RemindAt,
+	}
+}
+
+// importCards creates the cards of a csv, json or ndjson body, the same
+// formats of the export. The import is all or nothing: when a row is
+// invalid no card is created and the errors of each row are reported.
+// With dry_run=true the cards are checked and the import reported, but
+// nothing is kept
+func importCards(w http.ResponseWriter, r *http.Request) {
+	f, err := format(r)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	opts, err := parseCSVOptions(r)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	report := importReport{}
+	if dryRun := r.URL.Query().Get("dry_run"); dryRun != "" {
+		if report.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			renderProblem(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	defer body.Close()
+	var rows []importRow
+	switch f {
+	case "csv":
+		rows, err = readCSV(body, opts)
+	case "json":
+		rows, err = readJSON(body)
+	default:
+		rows, err = readNDJSON(body)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		// STATUS 413 - Request entity too large
+		renderProblem(w, fmt.Sprintf("an import can have at most %d bytes", maxImportBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		// STATUS 422 - Unprocessable entity
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	created := []*cards.Card{}
+	err = store(r).Batch(func(tx database.Database) error {
+		for i, row := range rows {
+			card := importable(row.card)
+			if err := row.check(&card); err != nil {
+				report.Errors = append(report.Errors, newRowError(i+1, err))
+				continue
+			}
+			switch err := tx.CreateCard(&card); err {
+			case nil:
+				created = append(created, &card)
+			case database.ErrListNotFound:
+				report.Errors = append(report.Errors, newRowError(i+1, err))
+			default:
+				return err
+			}
+		}
+		if report.DryRun || len(report.Errors) > 0 {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	report.Imported = len(created)
+	if len(report.Errors) > 0 {
+		report.Imported = 0
+		writeProblem(w, importProblem{
+			problem:      newProblem("some rows are invalid, no card was imported", http.StatusUnprocessableEntity),
+			importReport: report,
+		}, http.StatusUnprocessableEntity)
+		return
+	}
+	if report.DryRun {
+		RenderJSON(w, report, http.StatusOK)
+		return
+	}
+	RenderJSON(w, report, http.StatusCreated)
+	for _, card := range created {
+		publish(webhook.EventCreated, card)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// contentTypes of the bodies of each import format
+var contentTypes = map[string]string{
+	"csv":    "text/csv",
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		body   string
+	}{
+		{"csv", "title,text,done\nmilk,buy,true\n\"bread\",bake,false\n"},
+		{"json", `[{"title":"milk","text":"buy","done":true},{"title":"bread","text":"bake"}]`},
+		{"ndjson", "{\"title\":\"milk\",\"text\":\"buy\",\"done\":true}\n\n{\"title\":\"bread\",\"text\":\"bake\"}\n"},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			server := testServer(t)
+			alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+			headers := []string{"Content-Type", contentTypes[test.format]}
+			path := "/cards/import?format=" + test.format
+			if resp, body := call(t, server, alice, http.MethodPost, path, test.body, headers...); resp.StatusCode != http.StatusCreated || !strings.Contains(string(body), `"imported":2`) {
+				t.Fatalf("import: status = %d, body = %s", resp.StatusCode, body)
+			}
+			resp, exported := call(t, server, alice, http.MethodGet, "/cards/export?format="+test.format, "")
+			if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), contentTypes[test.format]) {
+				t.Fatalf("export: status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+
+			// what alice exported is imported as it was
+			if resp, body := call(t, server, bob, http.MethodPost, path, string(exported), headers...); resp.StatusCode != http.StatusCreated {
+				t.Fatalf("import of the export: status = %d, body = %s", resp.StatusCode, body)
+			}
+			resp, body := call(t, server, bob, http.MethodGet, "/cards", "")
+			page := cardPage{}
+			if err := json.Unmarshal(body, &page); err != nil {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			want := []cards.Card{{Title: "milk", Text: "buy", Done: true}, {Title: "bread", Text: "bake"}}
+			if len(page.Cards) != len(want) {
+				t.Fatalf("expected %d cards but %s was obtained", len(want), body)
+			}
+			for i, card := range page.Cards {
+				if card.Title != want[i].Title || card.Text != want[i].Text || card.Done != want[i].Done || card.OwnerID != 2 {
+					t.Errorf("card %d: expected %+v but %+v was obtained", i, want[i], card)
+				}
+			}
+		})
+	}
+}
+
+func TestQuoteFormula(t *testing.T) {
+	for _, test := range []struct {
+		text, quoted string
+	}{
+		{"milk", "milk"},
+		{"", ""},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tx", "'\tx"},
+		{"'quoted", "''quoted"},
+		{"a=b", "a=b"},
+	} {
+		if quoted := quoteFormula(test.text); quoted != test.quoted {
+			t.Errorf("quoteFormula(%q) = %q, expected %q", test.text, quoted, test.quoted)
+		}
+		if text := unquoteFormula(test.quoted); text != test.text {
+			t.Errorf("unquoteFormula(%q) = %q, expected %q", test.quoted, text, test.text)
+		}
+	}
+}
+
+func TestImportColumns(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	// %3B is a semicolon, which query strings can't have
+	query := "?format=csv&comma=%3B&columns=Name:title,Notes:text"
+	resp, body := call(t, server, token, http.MethodPost, "/cards/import"+query, "Name;Notes;Ignored\nmilk;buy;x\n", "Content-Type", "text/csv")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("import: status = %d, body = %s", resp.StatusCode, body)
+	}
+	resp, body = call(t, server, token, http.MethodGet, "/cards/export"+query, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export: status = %d, body = %s", resp.StatusCode, body)
+	}
+	if lines := strings.Split(string(body), "\n"); len(lines) != 3 ||
+		lines[0] != "id;Name;Notes;done;list_id;position;due_at;remind_at;version" ||
+		!strings.HasPrefix(lines[1], "1;milk;buy;false;") {
+		t.Errorf("unexpected export\n%s", body)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	resp, body := call(t, server, token, http.MethodPost, "/cards/import?dry_run=true", `[{"title":"a","text":"b"},{"title":"c","text":"d"}]`)
+	report := importReport{}
+	if err := json.Unmarshal(body, &report); err != nil || resp.StatusCode != http.StatusOK || !report.DryRun || report.Imported != 2 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+	if resp, body = call(t, server, token, http.MethodGet, "/cards", ""); !strings.Contains(string(body), `"cards":[]`) {
+		t.Errorf("expected no card but status = %d, body = %s", resp.StatusCode, body)
+	}
+}
+
+func TestImportRowErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		format string
+		query  string
+		body   string
+		// invalid are the names of the invalid params of each row
+		invalid map[int]string
+	}{
+		{
+			name:   "ndjson",
+			format: "ndjson",
+			body: strings.Join([]string{
+				`{"title":"a","text":"b"}`,
+				`{"title":"no spaces","text":"b"}`,
+				`{"title":"a","text":"b","done":"yes"}`,
+				`{"title":"a","text":"b","list_id":9}`,
+				`{"title":"a","text":"b","due_at":"2030-01-01T00:00:00Z","remind_at":"2030-01-02T00:00:00Z"}`,
+			}, "\n"),
+			invalid: map[int]string{2: "title", 3: "done", 4: "list_id", 5: "remind_at"},
+		},
+		{
+			name:    "csv named by column",
+			format:  "csv",
+			query:   "&columns=Due:due_at",
+			body:    "title,text,Due,done\na,b,tomorrow,false\na,b,,maybe\n",
+			invalid: map[int]string{1: "due_at", 2: "done"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := testServer(t)
+			token := testToken(t, server, "alice")
+			resp, body := call(t, server, token, http.MethodPost, "/cards/import?format="+test.format+test.query, test.body, "Content-Type", contentTypes[test.format])
+			if resp.StatusCode != http.StatusUnprocessableEntity || resp.Header.Get("Content-Type") != problemType {
+				t.Fatalf("status = %d, Content-Type = %q, body = %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+			}
+			report := importReport{}
+			if err := json.Unmarshal(body, &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Imported != 0 || len(report.Errors) != len(test.invalid) {
+				t.Fatalf("expected %d row errors but %s was obtained", len(test.invalid), body)
+			}
+			for _, e := range report.Errors {
+				if len(e.InvalidParams) != 1 || e.InvalidParams[0].Name != test.invalid[e.Row] || !strings.HasPrefix(e.Errors, test.invalid[e.Row]+": ") {
+					t.Errorf("row %d: expected %s to be invalid but %+v was obtained", e.Row, test.invalid[e.Row], e)
+				}
+			}
+			if _, body = call(t, server, token, http.MethodGet, "/cards", ""); !strings.Contains(string(body), `"cards":[]`) {
+				t.Errorf("expected no card but %s was obtained", body)
+			}
+		})
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	// dry runs, so the limits are checked without keeping the cards
+	row := `{"title":"a","text":"b"}` + "\n"
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"most rows", strings.Repeat(row, maxImport), http.StatusOK},
+		{"too many rows", strings.Repeat(row, maxImport+1), http.StatusUnprocessableEntity},
+		{"too large", strings.Repeat("\n", maxImportBytes+1), http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := call(t, server, token, http.MethodPost, "/cards/import?format=ndjson&dry_run=true", test.body, "Content-Type", contentTypes["ndjson"])
+			if resp.StatusCode != test.status {
+				t.Errorf("status = %d, body = %.200s", resp.StatusCode, body)
+			}
+		})
+	}
+}
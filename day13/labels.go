@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+	"github.com/gorilla/mux"
+)
+
+// renderLabelError maps the errors of labels to a status
+func renderLabelError(w http.ResponseWriter, err error) {
+	switch err {
+	case database.ErrLabelNotFound, database.ErrCardNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case database.ErrLabelExists:
+		// STATUS 409 - CONFLICT
+		renderError(w, err, http.StatusConflict)
+	case database.ErrVersionMismatch:
+		renderError(w, err, http.StatusPreconditionFailed)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func createLabel(w http.ResponseWriter, r *http.Request) {
+	label := cards.Label{}
+	err := json.NewDecoder(r.Body).Decode(&label)
+	defer r.Body.Close()
+	if err != nil {
+		// STATUS 422 - Unprocessable entity
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if _, err = valid.ValidateStruct(label); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err = store(r).CreateLabel(&label); err != nil {
+		renderLabelError(w, err)
+		return
+	}
+	RenderJSON(w, label, http.StatusCreated)
+}
+
+func allLabels(w http.ResponseWriter, r *http.Request) {
+	labels, err := store(r).AllLabels()
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, labels, http.StatusOK)
+}
+
+func getLabel(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	label, err := store(r).GetLabel(id)
+	if err != nil {
+		renderLabelError(w, err)
+		return
+	}
+	RenderJSON(w, label, http.StatusOK)
+}
+
+// updateLabel renames or paints a label, empty fields are kept
+func updateLabel(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	label := cards.Label{}
+	err = json.NewDecoder(r.Body).Decode(&label)
+	defer r.Body.Close()
+	if err != nil {
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if label.Color != "" && !valid.IsHexcolor(label.Color) {
+		renderError(w, valid.Error{Name: "Color", Err: fmt.Errorf("%s does not validate as hexcolor", label.Color)}, http.StatusBadRequest)
+		return
+	}
+	label.ID = id
+	updated, err := store(r).UpdateLabel(&label)
+	if err != nil {
+		renderLabelError(w, err)
+		return
+	}
+	RenderJSON(w, updated, http.StatusOK)
+}
+
+func deleteLabel(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	if err = store(r).RemoveLabel(id); err != nil {
+		renderLabelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func attachLabel(w http.ResponseWriter, r *http.Request) {
+	labelCard(w, r, database.RevisionLabel)
+}
+
+func detachLabel(w http.ResponseWriter, r *http.Request) {
+	labelCard(w, r, database.RevisionUnlabel)
+}
+
+// labelCard attaches or detaches, as op says, the label in path
+func labelCard(w http.ResponseWriter, r *http.Request, op string) {
+	// Get the ids from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	labelID, err := strconv.ParseInt(vars["label"], 10, 64)
+	if err != nil {
+		renderProblem(w, "invalid label", http.StatusBadRequest)
+		return
+	}
+	version, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	view := store(r)
+	var card *cards.Card
+	if op == database.RevisionLabel {
+		card, err = view.AttachLabel(id, labelID, version)
+	} else {
+		card, err = view.DetachLabel(id, labelID, version)
+	}
+	if err != nil {
+		renderLabelError(w, err)
+		return
+	}
+	setETag(w, card)
+	RenderJSON(w, card, http.StatusOK)
+	publish(webhook.EventUpdated, card)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+func TestLabels(t *testing.T) {
+	server := testServer(t)
+	alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+	createCards(t, server, alice, "milk")
+	// each step runs on what the ones before it left
+	for _, test := range []struct {
+		name    string
+		token   string
+		method  string
+		path    string
+		body    string
+		ifMatch string
+		status  int
+		// result is a part expected in the body
+		result string
+	}{
+		{"create a label", alice, http.MethodPost, "/labels", `{"name":"red","color":"#ff0000"}`, "", http.StatusCreated, `"id":1`},
+		{"create a label without name", alice, http.MethodPost, "/labels", `{"color":"#ff0000"}`, "", http.StatusBadRequest, `"name":"name"`},
+		{"create a label of a bad color", alice, http.MethodPost, "/labels", `{"name":"blue","color":"blue"}`, "", http.StatusBadRequest, `"name":"color"`},
+		{"create a label of a name in use", alice, http.MethodPost, "/labels", `{"name":"red"}`, "", http.StatusConflict, ""},
+		{"create a label of a name in use by another user", bob, http.MethodPost, "/labels", `{"name":"red"}`, "", http.StatusCreated, `"id":2`},
+		{"create a broken label", alice, http.MethodPost, "/labels", `{"name":`, "", http.StatusUnprocessableEntity, ""},
+		{"create a second label", alice, http.MethodPost, "/labels", `{"name":"blue"}`, "", http.StatusCreated, `"id":3`},
+		{"get a label", alice, http.MethodGet, "/labels/1", "", "", http.StatusOK, `"color":"#ff0000"`},
+		{"get a label of another user", bob, http.MethodGet, "/labels/1", "", "", http.StatusNotFound, ""},
+		{"list the labels", alice, http.MethodGet, "/labels", "", "", http.StatusOK, `"name":"blue"`},
+		{"rename a label keeping its color", alice, http.MethodPut, "/labels/1", `{"name":"crimson"}`, "", http.StatusOK, `{"name":"crimson","color":"#ff0000"`},
+		{"rename a label to a name in use", alice, http.MethodPut, "/labels/1", `{"name":"blue"}`, "", http.StatusConflict, ""},
+		{"paint a label a bad color", alice, http.MethodPut, "/labels/1", `{"color":"red"}`, "", http.StatusBadRequest, `"name":"color"`},
+		{"attach a label", alice, http.MethodPost, "/cards/1/labels/1", "", `"1"`, http.StatusOK, `"labels":[1]`},
+		{"attach a label twice", alice, http.MethodPost, "/cards/1/labels/1", "", "", http.StatusOK, `"labels":[1]`},
+		{"attach a second label", alice, http.MethodPost, "/cards/1/labels/3", "", "", http.StatusOK, `"labels":[1,3]`},
+		{"attach to a stale version", alice, http.MethodPost, "/cards/1/labels/3", "", `"1"`, http.StatusPreconditionFailed, ""},
+		{"attach an unknown label", alice, http.MethodPost, "/cards/1/labels/9", "", "", http.StatusNotFound, ""},
+		{"attach a label of another user", alice, http.MethodPost, "/cards/1/labels/2", "", "", http.StatusNotFound, ""},
+		{"attach to a card of another user", bob, http.MethodPost, "/cards/1/labels/2", "", "", http.StatusNotFound, ""},
+		{"detach a label", alice, http.MethodDelete, "/cards/1/labels/1", "", "", http.StatusOK, `"labels":[3]`},
+		{"delete a label", alice, http.MethodDelete, "/labels/3", "", "", http.StatusNoContent, ""},
+		{"delete a deleted label", alice, http.MethodDelete, "/labels/3", "", "", http.StatusNotFound, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var headers []string
+			if test.ifMatch != "" {
+				headers = []string{"If-Match", test.ifMatch}
+			}
+			resp, body := call(t, server, test.token, test.method, test.path, test.body, headers...)
+			if resp.StatusCode != test.status || !strings.Contains(string(body), test.result) {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			if test.status >= http.StatusBadRequest && resp.Header.Get("Content-Type") != problemType {
+				t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+	// the deleted label is detached from the card
+	resp, body := call(t, server, alice, http.MethodGet, "/cards/1", "")
+	card := cards.Card{}
+	if err := json.Unmarshal(body, &card); err != nil || len(card.Labels) != 0 {
+		t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+	}
+}
+
+func TestLabelFilter(t *testing.T) {
+	server := testServer(t)
+	alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+	for _, name := range []string{"red", "blue", "green"} {
+		call(t, server, alice, http.MethodPost, "/labels", `{"name":"`+name+`"}`)
+	}
+	createCards(t, server, alice, "a", "b", "c", "d")
+	for _, path := range []string{"/cards/1/labels/1", "/cards/2/labels/1", "/cards/2/labels/2", "/cards/3/labels/2"} {
+		if resp, body := call(t, server, alice, http.MethodPost, path, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s: status = %d, body = %s", path, resp.StatusCode, body)
+		}
+	}
+	// bob's red label is not alice's
+	call(t, server, bob, http.MethodPost, "/labels", `{"name":"red"}`)
+	createCards(t, server, bob, "e")
+	call(t, server, bob, http.MethodPost, "/cards/5/labels/4", "")
+
+	for _, test := range []struct {
+		query  string
+		titles string
+	}{
+		{"label=red", "a b"},
+		{"label=red,blue", "b"},
+		{"label=red,blue&label_op=and", "b"},
+		{"label=red,blue&label_op=or", "a b c"},
+		{"label=green", ""},
+		{"label=green,blue&label_op=or", "b c"},
+		{"label=unknown", ""},
+		{"label=red,blue&label_op=or&sort=-id&limit=2", "c b|a"},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			if pages := strings.Join(listTitles(t, server, alice, "/cards?"+test.query), "|"); pages != test.titles {
+				t.Errorf("expected %q but %q was obtained", test.titles, pages)
+			}
+		})
+	}
+}
@@ -1,24 +1,46 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	valid "github.com/asaskevich/govalidator"
 	"github.com/cassiobotaro/60-days-of-go/day13/cards"
 	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/idempotency"
+	"github.com/cassiobotaro/60-days-of-go/day13/metrics"
+	"github.com/cassiobotaro/60-days-of-go/day13/openapi"
+	"github.com/cassiobotaro/60-days-of-go/day13/patch"
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+	"github.com/cassiobotaro/60-days-of-go/day13/stream"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
 	"github.com/gorilla/mux"
+	"github.com/urfave/negroni"
 )
 
 // future ideas:
-// - paginate results
 // - tests
 // controllers by package
 
 // Ugly but for while is the solution
-var db = database.NewMemoryDB()
+var db database.Database
 
 // RenderJSON render a content as json(thinking about middleware)
 func RenderJSON(w http.ResponseWriter, content interface{}, statusCode int) {
@@ -40,25 +62,121 @@ func createCard(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if err != nil {
 		// STATUS 422 - Unprocessable entity
-		renderJSON(w, map[string]string{"errors": err.Error()}, http.StatusUnprocessableEntity)
+		renderError(w, err, http.StatusUnprocessableEntity)
 		return
 	}
 	//if is a valid card
 	result, err := valid.ValidateStruct(card)
 	if result {
+		if err = validDates(&card); err != nil {
+			renderError(w, err, http.StatusBadRequest)
+			return
+		}
 		// create card
-		db.CreateCard(&card)
-		RenderJSON(w, card, http.StatusCreated)
+		err = store(r).CreateCard(&card)
+		switch err {
+		case database.ErrListNotFound:
+			renderError(w, err, http.StatusUnprocessableEntity)
+		case nil:
+			setETag(w, &card)
+			RenderJSON(w, card, http.StatusCreated)
+			publish(webhook.EventCreated, &card)
+		default:
+			renderError(w, err, http.StatusInternalServerError)
+		}
 	} else {
 		// STATUS 401 - BAD REQUEST
-		RenderJSON(w, map[string]string{"errors": err.Error()}, http.StatusBadRequest)
+		renderError(w, err, http.StatusBadRequest)
+	}
+}
+
+// cardPage is the envelope of a page of cards
+type cardPage struct {
+	Cards []*cards.Card `json:"cards"`
+	Next  string        `json:"next,omitempty"`
+	Prev  string        `json:"prev,omitempty"`
+}
+
+// parseQuery reads filters, sort and pagination from the query string
+func parseQuery(values url.Values) (database.Query, error) {
+	q := database.Query{
+		TitlePrefix: values.Get("title_prefix"),
+		Sort:        values.Get("sort"),
+		LabelOp:     values.Get("label_op"),
+	}
+	if done := values.Get("done"); done != "" {
+		d, err := strconv.ParseBool(done)
+		if err != nil {
+			return q, fmt.Errorf("done must be true or false")
+		}
+		q.Done = &d
+	}
+	if listID := values.Get("list_id"); listID != "" {
+		id, err := strconv.ParseInt(listID, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("list_id must be a number")
+		}
+		q.ListID = id
+	}
+	if dueBefore := values.Get("due_before"); dueBefore != "" {
+		t, err := time.Parse(time.RFC3339, dueBefore)
+		if err != nil {
+			return q, fmt.Errorf("due_before must be a RFC 3339 time")
+		}
+		q.DueBefore = &t
+	}
+	if labels := values.Get("label"); labels != "" {
+		q.Labels = strings.Split(labels, ",")
+	}
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, database.ErrInvalidLimit
+		}
+		q.Limit = l
 	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		c, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return q, err
+		}
+		q.Cursor = c
+	}
+	return q, q.Validate()
+}
+
+// pageLink is the current url pointing to another cursor
+func pageLink(u *url.URL, cursor *database.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	values := u.Query()
+	values.Set("cursor", cursor.Encode())
+	link := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return link.String()
 }
 
 func allCards(w http.ResponseWriter, r *http.Request) {
-	//list all cards
-	cardList := db.AllCards()
-	RenderJSON(w, cardList, http.StatusOK)
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	renderPage(w, r, q)
+}
+
+// renderPage lists a page of cards
+func renderPage(w http.ResponseWriter, r *http.Request, q database.Query) {
+	page, err := store(r).QueryCards(q)
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, cardPage{
+		Cards: page.Cards,
+		Next:  pageLink(r.URL, page.Next),
+		Prev:  pageLink(r.URL, page.Prev),
+	}, http.StatusOK)
 }
 
 func getCard(w http.ResponseWriter, r *http.Request) {
@@ -66,38 +184,53 @@ func getCard(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		RenderJSON(w, err, http.StatusInternalServerError)
+		renderError(w, errInvalidID, http.StatusBadRequest)
 		return
 	}
 
 	//get the card by id
-	card, err := db.getCard(id)
+	card, err := store(r).GetCard(id)
 	switch err {
 	case database.ErrCardNotFound:
-		RenderJSON(w, err, http.StatusNotFound)
+		renderError(w, err, http.StatusNotFound)
 	case nil:
+		setETag(w, card)
 		RenderJSON(w, card, http.StatusOK)
 	default:
-		RenderJSON(w, err, http.StatusInternalServerError)
+		renderError(w, err, http.StatusInternalServerError)
 	}
 }
 
-func deleteCart(w http.ResponseWriter, r *http.Request) {
+func deleteCard(w http.ResponseWriter, r *http.Request) {
 	// GET the id from path
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		RenderJSON(w, err, http.StatusInternalServerError)
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	version, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	// the card as it was is sent to the webhooks
+	removed, err := store(r).GetCard(id)
+	if err != nil {
+		removed = &cards.Card{ID: id}
 	}
 	//try to delete the card from id
-	err = db.RemoveCard(id)
+	err = store(r).RemoveCard(id, version)
 	switch err {
 	case database.ErrCardNotFound:
-		RenderJSON(w, err, http.StatusNotFound)
+		renderError(w, err, http.StatusNotFound)
+	case database.ErrVersionMismatch:
+		// STATUS 412 - PRECONDITION FAILED
+		renderError(w, err, http.StatusPreconditionFailed)
 	case nil:
 		RenderJSON(w, "", http.StatusNoContent)
+		publish(webhook.EventDeleted, removed)
 	default:
-		RenderJSON(w, err, http.StatusInternalServerError)
+		renderError(w, err, http.StatusInternalServerError)
 	}
 }
 
@@ -106,75 +239,427 @@ func updateCard(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		RenderJSON(w, err, http.StatusInternalServerError)
+		renderError(w, errInvalidID, http.StatusBadRequest)
 		return
 	}
 	card := cards.Card{}
 	err = json.NewDecoder(r.Body).Decode(&card)
 	defer r.Body.Close()
 	if err != nil {
-		RenderJSON(w, map[string]string{"errors": err.Error()}, http.StatusUnprocessableEntity)
+		renderError(w, err, http.StatusUnprocessableEntity)
 		return
 	}
 	result, err := valid.ValidateStruct(card)
 	card.ID = id
 	// if valid, update the docker
 	if result {
-		updated, err := db.UpdateCard(&card)
+		if err = validDates(&card); err != nil {
+			renderError(w, err, http.StatusBadRequest)
+			return
+		}
+		version, ok := checkIfMatch(w, r)
+		if !ok {
+			return
+		}
+		card.Version = version
+		before, _ := store(r).GetCard(id)
+		updated, err := store(r).UpdateCard(&card)
 		switch err {
 		case database.ErrCardNotFound:
-			RenderJSON(w, err, http.StatusNotFound)
+			renderError(w, err, http.StatusNotFound)
+		case database.ErrVersionMismatch:
+			renderError(w, err, http.StatusPreconditionFailed)
 		case nil:
+			setETag(w, updated)
 			RenderJSON(w, updated, http.StatusOK)
+			publishUpdate(before, updated)
 		default:
-			RenderJSON(w, err, http.StatusInternalServerError)
+			renderError(w, err, http.StatusInternalServerError)
 		}
 	} else {
 		// STATUS 401 - BAD REQUEST
-		RenderJSON(w, map[string]string{"errors": err.Error()}, http.StatusBadRequest)
+		renderError(w, err, http.StatusBadRequest)
 	}
 }
 
+// patchers applies a patch document by content type.
+// Plain json is handled as a merge patch
+var patchers = map[string]func(doc, patch []byte) ([]byte, error){
+	patch.MergePatchType: patch.MergePatch,
+	"application/json":   patch.MergePatch,
+	patch.JSONPatchType:  patch.JSONPatch,
+}
+
 func partialUpdateCard(w http.ResponseWriter, r *http.Request) {
 	// GET THE ID FROM PATH
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		RenderJSON(w, err, http.StatusInternalServerError)
+		renderError(w, errInvalidID, http.StatusBadRequest)
 		return
 	}
-	card := cards.Card{}
-	err = json.NewDecoder(r.Body).Decode(&card)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	apply, ok := patchers[mediaType]
+	if !ok {
+		// STATUS 415 - UNSUPPORTED MEDIA TYPE
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		renderProblem(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		RenderJSON(w, map[string]string{"errors": err.Error()}, http.StatusUnprocessableEntity)
+		renderError(w, err, http.StatusUnprocessableEntity)
 		return
 	}
-	card.ID = id
-	updated, err := db.UpdateCard(&card)
-	switch err {
-	case database.ErrCardNotFound:
-		RenderJSON(w, err, http.StatusNotFound)
-	case nil:
-		RenderJSON(w, updated, http.StatusOK)
+	version, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	before, updated, status, err := patchCard(store(r), id, version, apply, body)
+	if status != http.StatusOK {
+		renderError(w, err, status)
+		return
+	}
+	setETag(w, updated)
+	RenderJSON(w, updated, http.StatusOK)
+	publishUpdate(before, updated)
+}
+
+// patchCard applies a patch document to the stored card, retrying on top
+// of the new version when version is zero and the card changed meanwhile.
+// It returns the card before and after with 200 or the error with its status
+func patchCard(view database.Database, id, version int64, apply func(doc, patch []byte) ([]byte, error), body []byte) (before, after *cards.Card, status int, err error) {
+	for {
+		// the patch is applied over the stored card
+		card, err := view.GetCard(id)
+		if err == database.ErrCardNotFound {
+			return nil, nil, http.StatusNotFound, err
+		}
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, err
+		}
+		if version != 0 && version != card.Version {
+			return nil, nil, http.StatusPreconditionFailed, database.ErrVersionMismatch
+		}
+		doc, err := json.Marshal(card)
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, err
+		}
+		doc, err = apply(doc, body)
+		if err == patch.ErrTestFailed {
+			// STATUS 409 - CONFLICT
+			return nil, nil, http.StatusConflict, err
+		}
+		if err != nil {
+			return nil, nil, http.StatusUnprocessableEntity, err
+		}
+		patched := cards.Card{}
+		if err = json.Unmarshal(doc, &patched); err != nil {
+			return nil, nil, http.StatusUnprocessableEntity, err
+		}
+		// same rules of updateCard
+		if result, err := valid.ValidateStruct(patched); !result {
+			return nil, nil, http.StatusBadRequest, err
+		}
+		if err = validDates(&patched); err != nil {
+			return nil, nil, http.StatusBadRequest, err
+		}
+		// id and version can not be patched
+		patched.ID = id
+		patched.Version = card.Version
+		updated, err := view.UpdateCard(&patched)
+		switch err {
+		case database.ErrCardNotFound:
+			return nil, nil, http.StatusNotFound, err
+		case database.ErrVersionMismatch:
+			// changed after it was read, try again on top of the new version
+			if version == 0 {
+				continue
+			}
+			return nil, nil, http.StatusPreconditionFailed, err
+		case nil:
+			return card, updated, http.StatusOK, nil
+		default:
+			return nil, nil, http.StatusInternalServerError, err
+		}
+	}
+}
+
+// openDatabase returns the backend chosen by the flags
+func openDatabase(backend, dsn, dataDir string, snapshotEvery int) (database.Database, error) {
+	switch backend {
+	case "memory":
+		if dataDir == "" {
+			return database.NewMemoryDB(), nil
+		}
+		return database.OpenMemoryDB(dataDir, snapshotEvery)
+	case "sqlite":
+		return database.NewSQLiteDB(dsn)
 	default:
-		RenderJSON(w, err, http.StatusInternalServerError)
+		return nil, fmt.Errorf("unknown backend %q", backend)
 	}
 }
 
-func main() {
-	// router is router group
+// claimOrphans gives the user name the cards, boards and labels made
+// before there were users, returning how many cards they got
+func claimOrphans(db database.Database, name string) (int, error) {
+	account, err := db.GetAccount(name)
+	if err != nil {
+		return 0, fmt.Errorf("claim orphans: %v", err)
+	}
+	return db.ClaimOrphans(account.ID)
+}
+
+// idempotencyStore keeps the idempotency keys next to the cards, in the
+// database of the sqlite backend and in memory otherwise
+func idempotencyStore(db database.Database) (idempotency.Store, error) {
+	if sqlite, ok := db.(*database.SQLiteDB); ok {
+		return idempotency.NewSQLStore(sqlite.DB())
+	}
+	return idempotency.NewMemoryStore(time.Minute), nil
+}
+
+// newRouter registers the routes of the api
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
-	r.HandleFunc("cards", createCard).Methods(http.MethodPost)
+	r.HandleFunc("/openapi.json", openAPISpec).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", healthz).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", readyz).Methods(http.MethodGet)
+	r.HandleFunc("/users", signup).Methods(http.MethodPost)
+	r.HandleFunc("/users/me", me).Methods(http.MethodGet)
+	r.HandleFunc("/tokens", login).Methods(http.MethodPost)
+	r.HandleFunc("/tokens", logout).Methods(http.MethodDelete)
+	r.HandleFunc("/cards", createCard).Methods(http.MethodPost)
 	r.HandleFunc("/cards", allCards).Methods(http.MethodGet)
+	r.HandleFunc("/cards/batch", batchCards).Methods(http.MethodPost)
+	r.HandleFunc("/cards/export", exportCards).Methods(http.MethodGet)
+	r.HandleFunc("/cards/import", importCards).Methods(http.MethodPost)
+	r.HandleFunc("/cards/overdue", overdueCards).Methods(http.MethodGet)
+	r.HandleFunc("/cards/events", cardEvents).Methods(http.MethodGet)
 	r.HandleFunc("/cards/{id:[0-9]+}", getCard).Methods(http.MethodGet)
 	r.HandleFunc("/cards/{id:[0-9]+}", deleteCard).Methods(http.MethodDelete)
 	r.HandleFunc("/cards/{id:[0-9]+}", updateCard).Methods(http.MethodPut)
-	r.HandleFunc("/cards/{id:[0-9]+}", partialUPdateCard).Methods(http.MethodPatch)
-	n := negroni.Classic() // includes some default middlewares
+	r.HandleFunc("/cards/{id:[0-9]+}", partialUpdateCard).Methods(http.MethodPatch)
+	r.HandleFunc("/cards/{id:[0-9]+}/history", cardHistory).Methods(http.MethodGet)
+	r.HandleFunc("/cards/{id:[0-9]+}/history/{rev:[0-9]+}", cardRevision).Methods(http.MethodGet)
+	r.HandleFunc("/cards/{id:[0-9]+}/revert/{rev:[0-9]+}", revertCard).Methods(http.MethodPost)
+	r.HandleFunc("/cards/{id:[0-9]+}/move", moveCard).Methods(http.MethodPost)
+	r.HandleFunc("/cards/{id:[0-9]+}/labels/{label:[0-9]+}", attachLabel).Methods(http.MethodPost)
+	r.HandleFunc("/cards/{id:[0-9]+}/labels/{label:[0-9]+}", detachLabel).Methods(http.MethodDelete)
+	r.HandleFunc("/labels", createLabel).Methods(http.MethodPost)
+	r.HandleFunc("/labels", allLabels).Methods(http.MethodGet)
+	r.HandleFunc("/labels/{id:[0-9]+}", getLabel).Methods(http.MethodGet)
+	r.HandleFunc("/labels/{id:[0-9]+}", updateLabel).Methods(http.MethodPut)
+	r.HandleFunc("/labels/{id:[0-9]+}", deleteLabel).Methods(http.MethodDelete)
+	r.HandleFunc("/boards", createBoard).Methods(http.MethodPost)
+	r.HandleFunc("/boards", allBoards).Methods(http.MethodGet)
+	r.HandleFunc("/boards/{id:[0-9]+}", getBoard).Methods(http.MethodGet)
+	r.HandleFunc("/boards/{id:[0-9]+}", updateBoard).Methods(http.MethodPut)
+	r.HandleFunc("/boards/{id:[0-9]+}", deleteBoard).Methods(http.MethodDelete)
+	r.HandleFunc("/boards/{id:[0-9]+}/lists", createList).Methods(http.MethodPost)
+	r.HandleFunc("/boards/{id:[0-9]+}/lists", boardLists).Methods(http.MethodGet)
+	r.HandleFunc("/boards/{id:[0-9]+}/lists/{list:[0-9]+}", getList).Methods(http.MethodGet)
+	r.HandleFunc("/boards/{id:[0-9]+}/lists/{list:[0-9]+}", updateList).Methods(http.MethodPut)
+	r.HandleFunc("/boards/{id:[0-9]+}/lists/{list:[0-9]+}", deleteList).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks", createWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks", allWebhooks).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{id:[0-9]+}", getWebhook).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{id:[0-9]+}", updateWebhook).Methods(http.MethodPut)
+	r.HandleFunc("/webhooks/{id:[0-9]+}", deleteWebhook).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", webhookDeliveries).Methods(http.MethodGet)
+	r.HandleFunc("/trash", listTrash).Methods(http.MethodGet)
+	r.HandleFunc("/trash", emptyTrash).Methods(http.MethodDelete)
+	r.HandleFunc("/trash/{id:[0-9]+}/restore", restoreCard).Methods(http.MethodPost)
+	r.HandleFunc("/trash/{id:[0-9]+}", purgeCard).Methods(http.MethodDelete)
+	r.NotFoundHandler = http.HandlerFunc(notFound)
+	return r
+}
+
+// newServer puts the middlewares in front of the router and describes
+// its routes. The limiter and the idempotency keys apply to each user
+func newServer(r *mux.Router, limiter *ratelimit.Limiter, idempotent *idempotency.Handler) (*negroni.Negroni, error) {
+	var err error
+	if spec, err = describeAPI(r); err != nil {
+		return nil, err
+	}
+	// the metrics come first, so they also time the requests that
+	// panic or are rejected
+	stats = metrics.New()
+	stats.Route = metrics.MuxRoute(r)
+	stats.Gauge("cards", "Cards of every user, by state.", cardTotals)
+	n := negroni.New(stats)
+	// the middlewares of negroni.Classic, with a recovery that answers problems
+	n.Use(negroni.HandlerFunc(recovery))
+	n.Use(negroni.NewLogger())
+	n.Use(negroni.NewStatic(http.Dir("public")))
+	// the limiter runs before the requests without a user are rejected
+	n.UseFunc(identify)
+	limiter.Key = clientKey
+	limiter.Rules = append(append([]ratelimit.Rule{}, probeRules...), limiter.Rules...)
+	limiter.Exceeded = func(w http.ResponseWriter, r *http.Request) {
+		renderProblem(w, "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	n.Use(limiter)
+	n.UseFunc(authenticate)
+	// the bodies read whole before the handlers are as long as an import
+	validator := openapi.NewValidator(spec)
+	validator.MaxBodyBytes = maxImportBytes
+	validator.Invalid = func(w http.ResponseWriter, r *http.Request, err error) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			renderProblem(w, fmt.Sprintf("a request can have at most %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		renderError(w, err, http.StatusBadRequest)
+	}
+	n.Use(validator)
+	idempotent.MaxBodyBytes = maxImportBytes
+	idempotent.Scope = userScope
+	idempotent.Reject = func(w http.ResponseWriter, r *http.Request, status int, detail string) {
+		renderError(w, errors.New(detail), status)
+	}
+	n.Use(idempotent)
 	n.UseHandler(r)
+	return n, nil
+}
 
-	baseURL := "localhost:3000"
-	log.Printf("Server running at: http://%s", baseURL)
-	log.Fatal(http.ListenAndServer(baseURL, n))
+func main() {
+	addr := flag.String("addr", "localhost:3000", "address the server listens on")
+	readTimeout := flag.Duration("read-timeout", 30*time.Second, "how long reading a request, body included, can take")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Second, "how long writing a response can take, the event stream and the export are not limited")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "how long idle keep-alive connections are kept open")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long the requests in flight have to finish when the server stops")
+	metricsAddr := flag.String("metrics-addr", ":9090", "address serving GET /metrics apart from the api, empty does not serve the metrics")
+	backend := flag.String("backend", "memory", "database backend: memory or sqlite")
+	dsn := flag.String("dsn", "cards.db", "sqlite file path or :memory:")
+	dataDir := flag.String("data-dir", "", "directory of the memory backend log and snapshot, empty keeps cards only in RAM")
+	orphansOwner := flag.String("claim-orphans", "", "user name given, on startup, the cards, boards and labels made before there were users, which no user sees otherwise")
+	snapshotEvery := flag.Int("snapshot-every", database.DefaultSnapshotEvery, "log entries written before the memory backend compacts them")
+	retention := flag.Duration("trash-retention", 30*24*time.Hour, "how long removed cards stay in the trash")
+	sweepEvery := flag.Duration("sweep-every", time.Hour, "how often the trash is swept")
+	remindEvery := flag.Duration("remind-every", 10*time.Second, "how often the reminders that passed are fired")
+	webhookPrivate := flag.Bool("webhook-allow-private", false, "let webhooks be delivered to loopback, link-local and private addresses")
+	eventBuffer := flag.Int("event-buffer", 1000, "card events kept for clients that resume the stream")
+	heartbeat := flag.Duration("heartbeat", stream.DefaultHeartbeat, "how often idle event streams receive a heartbeat")
+	flag.DurationVar(&tokenTTL, "token-ttl", tokenTTL, "how long the API tokens last")
+	rate := flag.Float64("rate", 10, "requests a second each client can make, 0 does not limit")
+	burst := flag.Int("burst", 20, "requests each client can make at once")
+	rules := &rateRules{rules: loginRules}
+	flag.Var(rules, "rate-rule", "limit of a route as \"[METHOD] /pattern=rate:burst\", can be repeated")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "how long the responses of the Idempotency-Key requests are kept")
+	flag.BoolVar(&requireIfMatch, "require-if-match", false, "reject PUT, PATCH and DELETE without If-Match")
+	flag.CommandLine.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nEvery flag can also be set by an environment variable, %s sets -trash-retention.\n", envName("trash-retention"))
+	}
+	if err := setFromEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		log.Fatal(err)
+	}
+	flag.Parse()
+
+	var err error
+	db, err = openDatabase(*backend, *dsn, *dataDir, *snapshotEvery)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *orphansOwner != "" {
+		claimed, err := claimOrphans(db, *orphansOwner)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%d cards without an owner given to %s", claimed, *orphansOwner)
+	}
+	keys, err := idempotencyStore(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the background jobs stop before the store is closed
+	background, stopBackground := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		sweepTrash(background, db, *retention, *sweepEvery)
+	}()
+	hooks = webhook.NewDispatcher(webhook.Options{AllowPrivate: *webhookPrivate})
+	events = newStreams(*eventBuffer, *heartbeat)
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		runReminders(background, db, *remindEvery, func(card *cards.Card) {
+			logReminder(card)
+			publish(webhook.EventReminder, card)
+		})
+	}()
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(time.Minute), ratelimit.Limit{Rate: *rate, Burst: *burst}, rules.rules...)
+	n, err := newServer(newRouter(), limiter, idempotency.New(keys, *idempotencyTTL))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{
+		Handler:      withoutWriteTimeout(n),
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+	// the event streams never end by themselves
+	server.RegisterOnShutdown(events.close)
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server running at: http://%s", l.Addr())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// the metrics, when served, stop with the api
+	metricsDone := make(chan error, 1)
+	if *metricsAddr == "" {
+		metricsDone <- nil
+	} else {
+		ml, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Metrics at: http://%s/metrics", ml.Addr())
+		metricsServer := &http.Server{
+			Handler:      metricsHandler(ratelimit.New(ratelimit.NewMemoryStore(time.Minute), ratelimit.Limit{Rate: *rate, Burst: *burst})),
+			ReadTimeout:  *readTimeout,
+			WriteTimeout: *writeTimeout,
+			IdleTimeout:  *idleTimeout,
+		}
+		go func() {
+			metricsDone <- serve(ctx, metricsServer, ml, *shutdownTimeout)
+		}()
+	}
+	err = serve(ctx, server, l, *shutdownTimeout)
+	// a second signal stops right away
+	stop()
+	if err != nil {
+		log.Println(err)
+	}
+	if metricsErr := <-metricsDone; metricsErr != nil {
+		log.Println("metrics:", metricsErr)
+	}
+	stopBackground()
+	jobs.Wait()
+	// the queued deliveries are sent, for as long as the requests had
+	// to finish, then the store is flushed
+	drain, cancelDrain := context.WithTimeout(context.Background(), *shutdownTimeout)
+	if hooksErr := hooks.Shutdown(drain); hooksErr != nil {
+		log.Println("webhooks:", hooksErr)
+	}
+	cancelDrain()
+	if closer, ok := db.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil {
+			log.Println(closeErr)
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// createCards creates a card for each title, the ones starting
+// with a capital letter are done
+func createCards(t *testing.T, server *httptest.Server, token string, titles ...string) {
+	t.Helper()
+	for _, title := range titles {
+		done := strings.ToUpper(title[:1]) == title[:1]
+		body, _ := json.Marshal(map[string]interface{}{"title": title, "text": "text", "done": done})
+		if resp, content := call(t, server, token, http.MethodPost, "/cards", string(body)); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /cards: status = %d, body = %s", resp.StatusCode, content)
+		}
+	}
+}
+
+// listTitles follows the next links from path, returning the titles of
+// each page
+func listTitles(t *testing.T, server *httptest.Server, token, path string) []string {
+	t.Helper()
+	var pages []string
+	for path != "" {
+		resp, body := call(t, server, token, http.MethodGet, path, "")
+		page := cardPage{}
+		if err := json.Unmarshal(body, &page); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, body = %s", path, resp.StatusCode, body)
+		}
+		titles := make([]string, len(page.Cards))
+		for i, card := range page.Cards {
+			titles[i] = card.Title
+		}
+		pages = append(pages, strings.Join(titles, " "))
+		path = page.Next
+	}
+	return pages
+}
+
+func TestListCards(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	createCards(t, server, token, "apple", "avocado", "Banana", "Cherry", "apricot")
+	// bob's cards are never listed for alice
+	createCards(t, server, testToken(t, server, "bob"), "almond")
+
+	for _, test := range []struct {
+		query string
+		pages []string
+	}{
+		{"", []string{"apple avocado Banana Cherry apricot"}},
+		{"?limit=2", []string{"apple avocado", "Banana Cherry", "apricot"}},
+		{"?limit=5", []string{"apple avocado Banana Cherry apricot"}},
+		{"?sort=-id&limit=2", []string{"apricot Cherry", "Banana avocado", "apple"}},
+		{"?sort=title&limit=3", []string{"Banana Cherry apple", "apricot avocado"}},
+		{"?done=false&limit=2", []string{"apple avocado", "apricot"}},
+		{"?done=true", []string{"Banana Cherry"}},
+		{"?title_prefix=ap&sort=title", []string{"apple apricot"}},
+		{"?title_prefix=a&done=false&sort=-id&limit=1", []string{"apricot", "avocado", "apple"}},
+		{"?title_prefix=z", []string{""}},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			pages := listTitles(t, server, token, "/cards"+test.query)
+			if strings.Join(pages, "|") != strings.Join(test.pages, "|") {
+				t.Errorf("expected pages %q but %q was obtained", test.pages, pages)
+			}
+		})
+	}
+}
+
+func TestListCardsPrev(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	createCards(t, server, token, "a", "b", "c", "d", "e")
+	first, second := cardPage{}, cardPage{}
+	_, body := call(t, server, token, http.MethodGet, "/cards?limit=2&done=false", "")
+	if err := json.Unmarshal(body, &first); err != nil || first.Prev != "" || !strings.Contains(first.Next, "done=false") {
+		t.Fatalf("expected a next link that keeps the filter but %s was obtained", body)
+	}
+	_, body = call(t, server, token, http.MethodGet, first.Next, "")
+	if err := json.Unmarshal(body, &second); err != nil || second.Prev == "" {
+		t.Fatalf("expected a prev link but %s was obtained", body)
+	}
+	if pages := listTitles(t, server, token, second.Prev); pages[0] != "a b" {
+		t.Errorf("expected the prev link to list a b but %q was obtained", pages)
+	}
+}
+
+func TestListCardsInvalidQuery(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	for _, query := range []string{
+		"limit=0",
+		"limit=101",
+		"limit=many",
+		"sort=name",
+		"done=maybe",
+		"cursor=garbage",
+		"label_op=xor",
+	} {
+		t.Run(query, func(t *testing.T) {
+			resp, body := call(t, server, token, http.MethodGet, "/cards?"+query, "")
+			if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Type") != problemType {
+				t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestPatchCard(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		// card is what is expected of the patched card, Milk is done
+		card string
+	}{
+		{"merge patch", "application/merge-patch+json", `{"text":"sell"}`, http.StatusOK, "Milk sell true"},
+		{"merge patch of done", "application/merge-patch+json", `{"done":false}`, http.StatusOK, "Milk text false"},
+		{"plain json is a merge patch", "application/json; charset=utf-8", `{"text":"sell"}`, http.StatusOK, "Milk sell true"},
+		{"id and version are not patched", "application/merge-patch+json", `{"id":7,"version":9}`, http.StatusOK, "Milk text true"},
+		{"json patch", "application/json-patch+json", `[{"op":"replace","path":"/done","value":false},{"op":"replace","path":"/text","value":"sell"}]`, http.StatusOK, "Milk sell false"},
+		{"passing test", "application/json-patch+json", `[{"op":"test","path":"/done","value":true},{"op":"replace","path":"/title","value":"Bread"}]`, http.StatusOK, "Bread text true"},
+		{"failing test", "application/json-patch+json", `[{"op":"test","path":"/done","value":false},{"op":"replace","path":"/title","value":"Bread"}]`, http.StatusConflict, ""},
+		{"unknown op", "application/json-patch+json", `[{"op":"swap","path":"/done"}]`, http.StatusUnprocessableEntity, ""},
+		{"broken patch", "application/merge-patch+json", `{"text":`, http.StatusUnprocessableEntity, ""},
+		{"invalid card", "application/merge-patch+json", `{"title":"no spaces"}`, http.StatusBadRequest, ""},
+		{"invalid title", "application/json-patch+json", `[{"op":"replace","path":"/title","value":"no spaces"}]`, http.StatusBadRequest, ""},
+		{"text", "text/plain", `text=sell`, http.StatusUnsupportedMediaType, ""},
+		{"no content type", "", `{"text":"sell"}`, http.StatusUnsupportedMediaType, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := testServer(t)
+			token := testToken(t, server, "alice")
+			createCards(t, server, token, "Milk")
+			resp, body := call(t, server, token, http.MethodPatch, "/cards/1", test.body, "Content-Type", test.contentType)
+			if resp.StatusCode != test.status {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			if test.status == http.StatusUnsupportedMediaType && resp.Header.Get("Accept-Patch") != "application/merge-patch+json, application/json-patch+json" {
+				t.Errorf("Accept-Patch = %q", resp.Header.Get("Accept-Patch"))
+			}
+			want, version := test.card, int64(2)
+			if test.status != http.StatusOK {
+				if resp.Header.Get("Content-Type") != problemType {
+					t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+				}
+				// the card is left as it was
+				want, version = "Milk text true", 1
+				_, body = call(t, server, token, http.MethodGet, "/cards/1", "")
+			}
+			card := cards.Card{}
+			if err := json.Unmarshal(body, &card); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%s %s %t", card.Title, card.Text, card.Done); got != want || card.ID != 1 || card.Version != version {
+				t.Errorf("expected %q at version %d but %s was obtained", want, version, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/metrics"
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni"
+)
+
+// stats are the metrics of the requests, served apart from the api
+// by metricsHandler
+var stats *metrics.Metrics
+
+// cardTotals are the cards of every user, pending, done or in the trash
+func cardTotals() ([]metrics.Sample, error) {
+	counts, err := db.CardCounts()
+	if err != nil {
+		return nil, err
+	}
+	return []metrics.Sample{
+		{Labels: []metrics.Label{{Name: "state", Value: "pending"}}, Value: float64(counts.Pending)},
+		{Labels: []metrics.Label{{Name: "state", Value: "done"}}, Value: float64(counts.Done)},
+		{Labels: []metrics.Label{{Name: "state", Value: "trashed"}}, Value: float64(counts.Trashed)},
+	}, nil
+}
+
+// serveMetrics writes the metrics in the Prometheus text format
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if _, err := stats.WriteTo(w); err != nil {
+		log.Println("metrics:", err)
+	}
+}
+
+// metricsHandler serves GET /metrics. The metrics count the cards of
+// every user, so they're served on an address of their own, which
+// should only be reachable by the scrapers, and limited by address
+func metricsHandler(limiter *ratelimit.Limiter) http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/metrics", serveMetrics).Methods(http.MethodGet)
+	limiter.Exceeded = func(w http.ResponseWriter, r *http.Request) {
+		renderProblem(w, "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return negroni.New(limiter, negroni.Wrap(r))
+}
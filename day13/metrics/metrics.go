@@ -0,0 +1,273 @@
+// Package metrics is a negroni middleware that counts the requests and
+// times them by route, method and status. What it records is written,
+// with gauges read at each scrape, in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni"
+)
+
+// ContentType is the media type of the text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Unmatched is the route of the requests that match none
+const Unmatched = "unmatched"
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Label is a dimension of a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value of a gauge
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// key identifies the series of the requests
+type key struct {
+	route  string
+	method string
+	status int
+}
+
+// series are the count and the latency histogram of a key, each bucket
+// counts the requests not counted by the smaller ones
+type series struct {
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+// gauge is read when the metrics are written
+type gauge struct {
+	name    string
+	help    string
+	collect func() ([]Sample, error)
+}
+
+// Metrics is the middleware
+type Metrics struct {
+	// Route names the route of a request. Raw paths would make a series
+	// for every id, so it's Unmatched for all of them by default
+	Route func(r *http.Request) string
+
+	buckets  []float64
+	mu       sync.Mutex
+	requests map[key]*series
+	gauges   []gauge
+}
+
+// New returns the middleware, with the latency histogram bounded by
+// buckets or by DefaultBuckets when there are none
+func New(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		Route:    func(r *http.Request) string { return Unmatched },
+		buckets:  buckets,
+		requests: map[key]*series{},
+	}
+}
+
+// Gauge adds a gauge whose samples collect returns at each scrape.
+// name must be a valid metric name
+func (m *Metrics) Gauge(name, help string, collect func() ([]Sample, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges = append(m.gauges, gauge{name: name, help: help, collect: collect})
+}
+
+// segment is a variable of a mux template, with its pattern if any
+var segment = regexp.MustCompile(`\{(\w+)(?::[^}]*)?\}`)
+
+// MuxRoute names the requests by the template of the route of router
+// that matches them, without the patterns, like /cards/{id}
+func MuxRoute(router *mux.Router) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		match := mux.RouteMatch{}
+		if !router.Match(r, &match) || match.Route == nil {
+			return Unmatched
+		}
+		template, err := match.Route.GetPathTemplate()
+		if err != nil {
+			return Unmatched
+		}
+		return segment.ReplaceAllString(template, "{$1}")
+	}
+}
+
+// ServeHTTP times the request and records it once it is answered
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	// the route is named before the handlers change the request
+	route := m.Route(r)
+	rw, ok := w.(negroni.ResponseWriter)
+	if !ok {
+		rw = negroni.NewResponseWriter(w)
+	}
+	next(rw, r)
+	status := rw.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	m.observe(key{route: route, method: r.Method, status: status}, time.Since(start).Seconds())
+}
+
+// observe adds a request of k that took seconds
+func (m *Metrics) observe(k key, seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.requests[k]
+	if !ok {
+		// the last bucket is +Inf
+		s = &series{buckets: make([]uint64, len(m.buckets)+1)}
+		m.requests[k] = s
+	}
+	s.count++
+	s.sum += seconds
+	s.buckets[sort.SearchFloat64s(m.buckets, seconds)]++
+}
+
+// WriteTo writes the metrics in the text format. A gauge that fails
+// is left out and the first of the errors is returned
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	keys := make([]key, 0, len(m.requests))
+	requests := make(map[key]series, len(m.requests))
+	for k, s := range m.requests {
+		keys = append(keys, k)
+		requests[k] = series{count: s.count, sum: s.sum, buckets: append([]uint64{}, s.buckets...)}
+	}
+	gauges := append([]gauge{}, m.gauges...)
+	m.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	header(cw, "http_requests_total", "Requests answered, by route, method and status.", "counter")
+	for _, k := range keys {
+		sample(cw, "http_requests_total", k.labels(), float64(requests[k].count))
+	}
+	header(cw, "http_request_duration_seconds", "Time taken to answer the requests, by route, method and status.", "histogram")
+	for _, k := range keys {
+		s := requests[k]
+		var cumulative uint64
+		for i, n := range s.buckets {
+			cumulative += n
+			le := math.Inf(1)
+			if i < len(m.buckets) {
+				le = m.buckets[i]
+			}
+			sample(cw, "http_request_duration_seconds_bucket", append(k.labels(), Label{"le", formatFloat(le)}), float64(cumulative))
+		}
+		sample(cw, "http_request_duration_seconds_sum", k.labels(), s.sum)
+		sample(cw, "http_request_duration_seconds_count", k.labels(), float64(s.count))
+	}
+
+	var err error
+	for _, g := range gauges {
+		samples, collectErr := g.collect()
+		if collectErr != nil {
+			if err == nil {
+				err = fmt.Errorf("%s: %v", g.name, collectErr)
+			}
+			continue
+		}
+		header(cw, g.name, g.help, "gauge")
+		for _, s := range samples {
+			sample(cw, g.name, s.Labels, s.Value)
+		}
+	}
+	if flushErr := cw.w.Flush(); cw.err == nil {
+		cw.err = flushErr
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, err
+}
+
+// labels of the series of a key
+func (k key) labels() []Label {
+	return []Label{{"method", k.method}, {"route", k.route}, {"status", strconv.Itoa(k.status)}}
+}
+
+// countingWriter counts what is written and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// header writes the help and the type of a metric
+func header(cw *countingWriter, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	cw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelValue escapes a label value
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sample writes a line of a metric
+func sample(cw *countingWriter, name string, labels []Label, value float64) {
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		pairs[i] = l.Name + `="` + labelValue.Replace(l.Value) + `"`
+	}
+	if len(pairs) == 0 {
+		cw.printf("%s %s\n", name, formatFloat(value))
+		return
+	}
+	cw.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+// formatFloat writes a value like Prometheus does
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,103 @@
+package metrics_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/metrics"
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni"
+)
+
+// scrape writes the metrics of m
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("wrote %d bytes but counted %d", buf.Len(), n)
+	}
+	return buf.String()
+}
+
+// contains checks that every line is in out
+func contains(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("%q is missing from\n%s", line, out)
+		}
+	}
+}
+
+func TestRequests(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/cards/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "2" {
+			http.NotFound(w, r)
+		}
+	}).Methods(http.MethodGet)
+	m := metrics.New(0.5, 0.1)
+	m.Route = metrics.MuxRoute(router)
+	n := negroni.New(m)
+	n.UseHandler(router)
+
+	for _, path := range []string{"/cards/1", "/cards/3", "/cards/2", "/boards"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	out := scrape(t, m)
+	contains(t, out,
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",route="/cards/{id}",status="200"} 2`,
+		`http_requests_total{method="GET",route="/cards/{id}",status="404"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_bucket{method="GET",route="/cards/{id}",status="200",le="0.1"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/cards/{id}",status="200",le="0.5"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/cards/{id}",status="200",le="+Inf"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/cards/{id}",status="200"} 2`,
+	)
+	// the series are sorted, so scrapes are stable
+	if strings.Index(out, `route="/cards/{id}",status="404"} 1`) > strings.Index(out, `route="unmatched"`) {
+		t.Errorf("the series are not sorted\n%s", out)
+	}
+}
+
+func TestGauges(t *testing.T) {
+	m := metrics.New()
+	m.Gauge("cards", "Cards \\ by state.", func() ([]metrics.Sample, error) {
+		return []metrics.Sample{
+			{Labels: []metrics.Label{{Name: "state", Value: "done"}}, Value: 2},
+			{Labels: []metrics.Label{{Name: "title", Value: "say \"hi\"\n"}}, Value: 1.5},
+		}, nil
+	})
+	m.Gauge("broken", "Always fails.", func() ([]metrics.Sample, error) {
+		return nil, errors.New("no database")
+	})
+	m.Gauge("up", "Always 1.", func() ([]metrics.Sample, error) {
+		return []metrics.Sample{{Value: 1}}, nil
+	})
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err == nil || err.Error() != "broken: no database" {
+		t.Fatalf("err = %v", err)
+	}
+	out := buf.String()
+	contains(t, out,
+		`# HELP cards Cards \\ by state.`,
+		"# TYPE cards gauge",
+		`cards{state="done"} 2`,
+		`cards{title="say \"hi\"\n"} 1.5`,
+		"up 1",
+	)
+	// the gauges that fail are left out
+	if strings.Contains(out, "broken") {
+		t.Errorf("broken was written\n%s", out)
+	}
+}
@@ -0,0 +1,435 @@
+// Package openapi describes the routes of a gorilla/mux router as an
+// OpenAPI 3 document and validates the requests against it. The schemas
+// are derived from the json and valid tags of the types, as they are
+// read by encoding/json and govalidator.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+)
+
+// Version of the specification the documents follow
+const Version = "3.0.3"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info is the title and the version of the api
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem are the operations of a path by lower case method
+type PathItem map[string]*Operation
+
+// Operation is a method of a path
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security is empty for the operations that need no credentials
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a value of the path or of the query string
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody are the bodies accepted by media type
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a response by status, or the default one
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a media type, nil when it's not json
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components are the schemas referenced by name
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is how the client authenticates
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// Schema describes a json value, an empty schema accepts any value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// schemaPrefix starts the references to the components
+const schemaPrefix = "#/components/schemas/"
+
+// New returns a document without paths
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version},
+		Paths:      map[string]PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// Bearer requires a bearer token on every operation, except the public ones
+func (d *Document) Bearer() {
+	d.Components.SecuritySchemes = map[string]SecurityScheme{"bearer": {Type: "http", Scheme: "bearer"}}
+	d.Security = []map[string][]string{{"bearer": {}}}
+}
+
+// resolve follows the reference of a schema, alone or in an allOf
+func (d *Document) resolve(s *Schema) *Schema {
+	for s != nil && (s.Ref != "" || len(s.AllOf) == 1) {
+		if s.Ref == "" {
+			s = s.AllOf[0]
+			continue
+		}
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, schemaPrefix)]
+	}
+	return s
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema returns the schema of the type of v. The named structs are
+// added to the components and referenced, so they are described once
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := *d.schemaOf(t.Elem())
+		s.Nullable = true
+		if s.Ref != "" {
+			// siblings of a reference are ignored, so it's wrapped
+			return &Schema{AllOf: []*Schema{{Ref: s.Ref}}, Nullable: true}
+		}
+		return &s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// json.RawMessage is any value and []byte is base64
+			if t == rawMessageType {
+				return &Schema{}
+			}
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// added before the fields, in case they refer to the type
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.structSchema(t)
+		}
+		return &Schema{Ref: schemaPrefix + name}
+	}
+	return &Schema{}
+}
+
+// componentName is the name of a type, starting with a capital letter
+func componentName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// structSchema describes the fields of a struct as encoding/json writes them
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// the fields of an embedded struct are promoted
+			embedded := d.structSchema(field.Type)
+			for property, schema := range embedded.Properties {
+				s.Properties[property] = schema
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := d.schemaOf(field.Type)
+		if validations(schema, field.Tag.Get("valid")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = schema
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// patterns of the govalidator validators of strings
+var patterns = map[string]string{
+	"alpha":       valid.Alpha,
+	"alphanum":    valid.Alphanumeric,
+	"numeric":     valid.Numeric,
+	"hexadecimal": valid.Hexadecimal,
+	"hexcolor":    valid.Hexcolor,
+	"uuid":        valid.UUID,
+}
+
+// formats of the govalidator validators of strings
+var formats = map[string]string{
+	"email":   "email",
+	"url":     "uri",
+	"ipv4":    "ipv4",
+	"ipv6":    "ipv6",
+	"rfc3339": "date-time",
+}
+
+// length reads length(min|max)
+var length = regexp.MustCompile(`^(?:length|runelength)\((\d+)\|(\d+)\)$`)
+
+// validations applies a valid tag to the schema of a field, telling if
+// the field is required. Like govalidator, an empty string is only
+// rejected by required, so the patterns of the other fields match it.
+// The options are read as govalidator reads them, spaces included, so
+// an option it does not know, like " required", is left out
+func validations(s *Schema, tag string) bool {
+	required := false
+	pattern := ""
+	for _, option := range strings.Split(tag, ",") {
+		option = strings.Split(option, "~")[0]
+		if option == "required" {
+			required = true
+		} else if p, ok := patterns[option]; ok {
+			pattern = p
+		} else if f, ok := formats[option]; ok {
+			s.Format = f
+		} else if m := length.FindStringSubmatch(option); m != nil {
+			min, _ := strconv.Atoi(m[1])
+			max, _ := strconv.Atoi(m[2])
+			s.MinLength, s.MaxLength = &min, &max
+		}
+	}
+	if s.Type != "string" {
+		return required
+	}
+	if required && s.MinLength == nil {
+		one := 1
+		s.MinLength = &one
+	}
+	if pattern != "" {
+		s.Pattern = pattern
+		if !required {
+			s.Pattern = "^(" + strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$") + ")?$"
+		}
+	}
+	return required
+}
+
+// Route describes an operation beyond what the router knows
+type Route struct {
+	Summary string
+	// Query are the parameters of the query string
+	Query []Parameter
+	// Body is a value of the type of the json body, nil when there is none
+	Body interface{}
+	// Accepts are the other media types of the body, with a value of
+	// the type of their body or nil when they are not json
+	Accepts map[string]interface{}
+	// Response is a value of the type of the response body and Status
+	// is its status, 200 by default. A nil Response has no body
+	Response interface{}
+	Status   int
+	// Produces is the media type of the response, json by default
+	Produces string
+	// Public operations need no credentials
+	Public bool
+}
+
+// segment reads a variable of a path template, {name} or {name:pattern}
+var segment = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// AddRouter describes every route of router, the routes are looked up
+// by "METHOD template", the template as it was given to the router.
+// The default response of every operation is an error with the schema
+// of problem
+func (d *Document) AddRouter(router *mux.Router, routes map[string]Route, problem interface{}) error {
+	errorResponse := &Response{
+		Description: "Error",
+		Content:     map[string]MediaType{"application/problem+json": {Schema: d.Schema(problem)}},
+	}
+	return router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path := segment.ReplaceAllString(template, "{$1}")
+		var params []Parameter
+		for _, m := range segment.FindAllStringSubmatch(template, -1) {
+			param := Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}}
+			switch m[2] {
+			case "":
+			case "[0-9]+":
+				param.Schema = &Schema{Type: "integer", Format: "int64"}
+			default:
+				param.Schema.Pattern = "^" + m[2] + "$"
+			}
+			params = append(params, param)
+		}
+		for _, method := range methods(route) {
+			doc := routes[method+" "+template]
+			op := &Operation{
+				OperationID: handlerName(route.GetHandler()),
+				Summary:     doc.Summary,
+				Parameters:  append(append([]Parameter{}, params...), doc.Query...),
+				Responses:   map[string]*Response{"default": errorResponse},
+			}
+			if doc.Public {
+				op.Security = &[]map[string][]string{}
+			}
+			if doc.Body != nil || doc.Accepts != nil {
+				op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{}}
+				if doc.Body != nil {
+					op.RequestBody.Content["application/json"] = MediaType{Schema: d.Schema(doc.Body)}
+				}
+				for mediaType, body := range doc.Accepts {
+					media := MediaType{}
+					if body != nil {
+						media.Schema = d.Schema(body)
+					}
+					op.RequestBody.Content[mediaType] = media
+				}
+			}
+			status := doc.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			response := &Response{Description: http.StatusText(status)}
+			if doc.Response != nil {
+				produces := doc.Produces
+				if produces == "" {
+					produces = "application/json"
+				}
+				response.Content = map[string]MediaType{produces: {Schema: d.Schema(doc.Response)}}
+			}
+			op.Responses[strconv.Itoa(status)] = response
+			if d.Paths[path] == nil {
+				d.Paths[path] = PathItem{}
+			}
+			d.Paths[path][strings.ToLower(method)] = op
+		}
+		return nil
+	})
+}
+
+// methods are the methods a route matches, GET when it matches any
+func methods(route *mux.Route) []string {
+	req := &http.Request{}
+	var matched []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		req.Method = method
+		if matchesMethod(route, req) {
+			matched = append(matched, method)
+		}
+	}
+	return matched
+}
+
+// matchesMethod tells if the route accepts the method of req, whatever its path
+func matchesMethod(route *mux.Route, req *http.Request) bool {
+	template, _ := route.GetPathTemplate()
+	// a path the route builds matches it, then only the method is left
+	vars := []string{}
+	for _, m := range segment.FindAllStringSubmatch(template, -1) {
+		vars = append(vars, m[1], "1")
+	}
+	u, err := route.URLPath(vars...)
+	if err != nil {
+		return false
+	}
+	req.URL = u
+	return route.Match(req, &mux.RouteMatch{})
+}
+
+// handlerName is the name of the function of a handler, like createCard
+func handlerName(h http.Handler) string {
+	if f, ok := h.(http.HandlerFunc); ok {
+		name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+		return name[strings.LastIndex(name, ".")+1:]
+	}
+	return fmt.Sprintf("%T", h)
+}
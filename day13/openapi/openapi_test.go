@@ -0,0 +1,245 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/openapi"
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni"
+)
+
+type base struct {
+	ID int64 `json:"id,omitempty"`
+}
+
+type tag struct {
+	Name  string `json:"name" valid:"alphanum, required"`
+	Color string `json:"color" valid:"hexcolor"`
+}
+
+type item struct {
+	base
+	Title   string          `json:"title" valid:"required,length(1|10)"`
+	Done    bool            `json:"done"`
+	DueAt   *time.Time      `json:"due_at,omitempty"`
+	Tags    []tag           `json:"tags"`
+	Parent  *item           `json:"parent"`
+	Extra   json.RawMessage `json:"extra"`
+	Score   float64         `json:"score"`
+	Hidden  string          `json:"-"`
+	private string
+}
+
+type failure struct {
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func TestSchema(t *testing.T) {
+	doc := openapi.New("test", "1")
+	ref := doc.Schema(item{})
+	if ref.Ref != "#/components/schemas/Item" {
+		t.Fatalf("schema = %+v", ref)
+	}
+	s := doc.Components.Schemas["Item"]
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	if len(names) != 8 || s.Properties["Hidden"] != nil || s.Properties["private"] != nil {
+		t.Fatalf("properties = %v", names)
+	}
+	if !reflect.DeepEqual(s.Required, []string{"title"}) {
+		t.Fatalf("required = %v", s.Required)
+	}
+	if title := s.Properties["title"]; *title.MinLength != 1 || *title.MaxLength != 10 {
+		t.Fatalf("title = %+v", title)
+	}
+	if due := s.Properties["due_at"]; due.Type != "string" || due.Format != "date-time" || !due.Nullable {
+		t.Fatalf("due_at = %+v", due)
+	}
+	if id := s.Properties["id"]; id.Type != "integer" || id.Format != "int64" {
+		t.Fatalf("id = %+v", id)
+	}
+	if extra := s.Properties["extra"]; extra.Type != "" {
+		t.Fatalf("extra = %+v", extra)
+	}
+	if parent := s.Properties["parent"]; !parent.Nullable || parent.AllOf[0].Ref != ref.Ref {
+		t.Fatalf("parent = %+v", parent)
+	}
+	if tags := s.Properties["tags"]; tags.Type != "array" || tags.Items.Ref != "#/components/schemas/Tag" {
+		t.Fatalf("tags = %+v", tags)
+	}
+	// like govalidator, " required" with its space is not an option it
+	// knows, so name is optional and its pattern matches ""
+	tag := doc.Components.Schemas["Tag"]
+	if len(tag.Required) != 0 || tag.Properties["name"].Pattern != "^([a-zA-Z0-9]+)?$" {
+		t.Fatalf("tag = %+v", tag)
+	}
+	if color := tag.Properties["color"].Pattern; color != "^(#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6}))?$" {
+		t.Fatalf("color = %s", color)
+	}
+}
+
+func createItem(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusCreated)
+}
+
+func getItem(w http.ResponseWriter, r *http.Request) {}
+
+// router is described by routes
+func router() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/items", createItem).Methods(http.MethodPost)
+	r.HandleFunc("/items", getItem).Methods(http.MethodGet)
+	r.HandleFunc("/items/{id:[0-9]+}", getItem).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/items/{id:[0-9]+}/tags/{name}", getItem)
+	return r
+}
+
+var routes = map[string]openapi.Route{
+	"POST /items": {Summary: "Create", Body: item{}, Response: item{}, Status: http.StatusCreated, Public: true},
+	"GET /items": {Query: []openapi.Parameter{
+		{Name: "done", In: "query", Schema: &openapi.Schema{Type: "boolean"}},
+		{Name: "sort", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{"id", "title"}}},
+		{Name: "q", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+	}},
+	"GET /items/{id:[0-9]+}": {Response: item{}},
+}
+
+func TestAddRouter(t *testing.T) {
+	doc := openapi.New("test", "1")
+	doc.Bearer()
+	if err := doc.AddRouter(router(), routes, failure{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Paths) != 3 {
+		t.Fatalf("paths = %v", doc.Paths)
+	}
+	create := doc.Paths["/items"]["post"]
+	if create == nil || create.OperationID != "createItem" || create.Summary != "Create" {
+		t.Fatalf("operation = %+v", create)
+	}
+	if create.Security == nil || len(*create.Security) != 0 {
+		t.Fatal("a public operation needs credentials")
+	}
+	if create.Responses["201"].Content["application/json"].Schema.Ref != "#/components/schemas/Item" {
+		t.Fatalf("responses = %+v", create.Responses)
+	}
+	if create.Responses["default"].Content["application/problem+json"].Schema.Ref != "#/components/schemas/Failure" {
+		t.Fatalf("responses = %+v", create.Responses)
+	}
+	get := doc.Paths["/items/{id}"]["get"]
+	if get == nil || get.Security != nil || len(get.Parameters) != 1 || get.Parameters[0].Schema.Type != "integer" {
+		t.Fatalf("operation = %+v", get)
+	}
+	// a route without methods matches every method, and is still described
+	if tags := doc.Paths["/items/{id}/tags/{name}"]; len(tags) != 5 || tags["delete"].Responses["200"] == nil {
+		t.Fatalf("path = %+v", tags)
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve sends a request through the validator
+func serve(v *openapi.Validator, method, target, body string) *httptest.ResponseRecorder {
+	n := negroni.New(v)
+	n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	w := httptest.NewRecorder()
+	n.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestValidator(t *testing.T) {
+	doc := openapi.New("test", "1")
+	if err := doc.AddRouter(router(), routes, failure{}); err != nil {
+		t.Fatal(err)
+	}
+	v := openapi.NewValidator(doc)
+	for _, valid := range []struct{ method, target, body string }{
+		{http.MethodPost, "/items", `{"title":"a","tags":[{"name":"a1","color":""}],"due_at":null,"extra":[1]}`},
+		{http.MethodPost, "/items", `{"title":"a","parent":{"title":"b"},"unknown":1}`},
+		{http.MethodGet, "/items?q=a&done=true&sort=id", ""},
+		{http.MethodGet, "/items/1", ""},
+		// not json is left to the handler
+		{http.MethodPost, "/items", `{"title":`},
+		// no operation
+		{http.MethodGet, "/other", ""},
+	} {
+		if w := serve(v, valid.method, valid.target, valid.body); w.Code != http.StatusNoContent {
+			t.Errorf("%s %s %s: status = %d, body = %s", valid.method, valid.target, valid.body, w.Code, w.Body)
+		}
+	}
+
+	var got openapi.Errors
+	v.Invalid = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err.(openapi.Errors)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	for _, invalid := range []struct {
+		method, target, body string
+		want                 openapi.Errors
+	}{
+		{http.MethodPost, "/items", `{"title":"","tags":[{"color":"red"}],"done":1,"score":"high"}`, openapi.Errors{
+			{Name: "done", Reason: "must be a boolean"},
+			{Name: "score", Reason: "must be a number"},
+			{Name: "tags.0.color", Reason: "must match ^(#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6}))?$"},
+			{Name: "title", Reason: "must not be empty"},
+		}},
+		{http.MethodPost, "/items", `{"title":"12345678901","parent":{"id":1.5}}`, openapi.Errors{
+			{Name: "parent.title", Reason: "is required"},
+			{Name: "parent.id", Reason: "must be an integer"},
+			{Name: "title", Reason: "must have at most 10 characters"},
+		}},
+		{http.MethodPost, "/items", `[]`, openapi.Errors{{Name: "body", Reason: "must be an object"}}},
+		{http.MethodPost, "/items", `{"title":"a","tags":null,"due_at":"today"}`, openapi.Errors{
+			{Name: "due_at", Reason: "must be a RFC 3339 date-time"},
+		}},
+		{http.MethodGet, "/items?done=maybe&sort=name", "", openapi.Errors{
+			{Name: "done", Reason: "must be a boolean"},
+			{Name: "sort", Reason: "must be one of id, title"},
+			{Name: "q", Reason: "is required"},
+		}},
+		{http.MethodGet, "/items/99999999999999999999", "", openapi.Errors{{Name: "id", Reason: "must be an integer"}}},
+	} {
+		got = nil
+		w := serve(v, invalid.method, invalid.target, invalid.body)
+		if w.Code != http.StatusBadRequest || !reflect.DeepEqual(got, invalid.want) {
+			t.Errorf("%s %s %s: status = %d, errors = %v", invalid.method, invalid.target, invalid.body, w.Code, got)
+		}
+	}
+}
+
+func TestValidatorLargeBody(t *testing.T) {
+	doc := openapi.New("test", "1")
+	if err := doc.AddRouter(router(), routes, failure{}); err != nil {
+		t.Fatal(err)
+	}
+	v := openapi.NewValidator(doc)
+	v.MaxBodyBytes = 20
+	body := `{"title":"a"}` + strings.Repeat(" ", 10)
+	if w := serve(v, http.MethodPost, "/items", body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var got error
+	v.Invalid = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+	serve(v, http.MethodPost, "/items", body)
+	if tooLarge, ok := got.(*http.MaxBytesError); !ok || tooLarge.Limit != 20 {
+		t.Errorf("expected the body to be too large but %v was obtained", got)
+	}
+	if w := serve(v, http.MethodPost, "/items", body[:20]); w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body)
+	}
+}
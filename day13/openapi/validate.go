@@ -0,0 +1,383 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is a value of a request that does not match the document. Name
+// is the parameter or the field of the body, like labels.0 or title
+type Error struct {
+	Name   string
+	Reason string
+}
+
+// Errors are the values of a request that do not match the document
+type Errors []Error
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Name + ": " + err.Reason
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add appends an error
+func (errs *Errors) add(name, format string, args ...interface{}) {
+	*errs = append(*errs, Error{Name: name, Reason: fmt.Sprintf(format, args...)})
+}
+
+// operation is an operation with the regexp of its path
+type operation struct {
+	method string
+	path   *regexp.Regexp
+	// names of the groups of path
+	names []string
+	op    *Operation
+}
+
+// DefaultMaxBodyBytes is how long a body that is checked can be
+const DefaultMaxBodyBytes = 10 << 20
+
+// Validator is a middleware that checks the parameters and the json body
+// of the requests against a document before they reach the handlers.
+// The requests no operation matches, and the bodies that are not json,
+// are left to the handlers
+type Validator struct {
+	// Invalid answers the requests that do not match, err is Errors, or
+	// a *http.MaxBytesError when the body is too long. By default it
+	// answers 400, or 413 to a body too long, with a json error
+	Invalid func(w http.ResponseWriter, r *http.Request, err error)
+	// MaxBodyBytes is how long a body that is checked can be. By default
+	// it's DefaultMaxBodyBytes
+	MaxBodyBytes int64
+
+	doc        *Document
+	operations []operation
+}
+
+// NewValidator returns a validator of the operations of doc
+func NewValidator(doc *Document) *Validator {
+	v := &Validator{doc: doc}
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	// the paths without variables are tried first, like /cards/batch
+	// before /cards/{id}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Count(paths[i], "{") < strings.Count(paths[j], "{")
+	})
+	for _, path := range paths {
+		for method, op := range doc.Paths[path] {
+			pattern, names := pathRegexp(path)
+			v.operations = append(v.operations, operation{
+				method: strings.ToUpper(method),
+				path:   pattern,
+				names:  names,
+				op:     op,
+			})
+		}
+	}
+	return v
+}
+
+// pathRegexp matches a path like /cards/{id}, the variables are a segment
+func pathRegexp(path string) (*regexp.Regexp, []string) {
+	var names []string
+	for _, m := range segment.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	pattern := regexp.QuoteMeta(path)
+	for _, name := range names {
+		pattern = strings.Replace(pattern, regexp.QuoteMeta("{"+name+"}"), "([^/]+)", 1)
+	}
+	return regexp.MustCompile("^" + pattern + "$"), names
+}
+
+// match finds the operation of a request and the values of its path
+func (v *Validator) match(r *http.Request) (*Operation, map[string]string) {
+	for _, o := range v.operations {
+		if o.method != r.Method {
+			continue
+		}
+		if m := o.path.FindStringSubmatch(r.URL.Path); m != nil {
+			vars := map[string]string{}
+			for i, name := range o.names {
+				vars[name] = m[i+1]
+			}
+			return o.op, vars
+		}
+	}
+	return nil, nil
+}
+
+// ServeHTTP validates the request, answering with Invalid when it does not match
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	op, vars := v.match(r)
+	if op == nil {
+		next(w, r)
+		return
+	}
+	errs := Errors{}
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = vars[param.Name]
+		case "query":
+			value, present = query.Get(param.Name), query.Get(param.Name) != ""
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				errs.add(param.Name, "is required")
+			}
+			continue
+		}
+		v.doc.check(param.Schema, parse(v.doc.resolve(param.Schema), value), param.Name, &errs)
+	}
+	if schema := v.bodySchema(op, r); schema != nil {
+		limit := v.MaxBodyBytes
+		if limit == 0 {
+			limit = DefaultMaxBodyBytes
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		r.Body.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			v.reject(w, r, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			errs.add("body", "%v", err)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value interface{}
+		if err == nil && decoder.Decode(&value) == nil {
+			v.doc.check(schema, value, "", &errs)
+		}
+	}
+	if len(errs) == 0 {
+		next(w, r)
+		return
+	}
+	v.reject(w, r, errs, http.StatusBadRequest)
+}
+
+// reject answers a request that does not match with Invalid, or with
+// status and a json error
+func (v *Validator) reject(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if v.Invalid != nil {
+		v.Invalid(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"errors": err.Error()})
+}
+
+// bodySchema is the schema of the body of the request. A request without
+// a media type of the operation is read as json, like the handlers do
+func (v *Validator) bodySchema(op *Operation, r *http.Request) *Schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if media, ok := op.RequestBody.Content[mediaType]; ok {
+		return media.Schema
+	}
+	return op.RequestBody.Content["application/json"].Schema
+}
+
+// parse reads a parameter as the json value of its schema, a value that
+// can not be read is kept as a string to be reported
+func parse(s *Schema, value string) interface{} {
+	if s == nil {
+		return value
+	}
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// check validates a json value, decoded with UseNumber, against a schema
+func (d *Document) check(s *Schema, value interface{}, name string, errs *Errors) {
+	if s == nil {
+		return
+	}
+	if value == nil {
+		if !s.Nullable && !d.resolve(s).Nullable && d.resolve(s).Type != "" {
+			errs.add(field(name), "must not be null")
+		}
+		return
+	}
+	s = d.resolve(s)
+	switch s.Type {
+	case "":
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs.add(field(name), "must be an object")
+			return
+		}
+		for _, property := range s.Required {
+			if _, ok := object[property]; !ok {
+				errs.add(path(name, property), "is required")
+			}
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := s.Properties[key]; ok {
+				d.check(property, object[key], path(name, key), errs)
+			} else if s.AdditionalProperties != nil {
+				d.check(s.AdditionalProperties, object[key], path(name, key), errs)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			errs.add(field(name), "must be an array")
+			return
+		}
+		for i, item := range array {
+			d.check(s.Items, item, path(name, strconv.Itoa(i)), errs)
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			errs.add(field(name), "must be an integer")
+			return
+		}
+		if _, err := strconv.ParseInt(string(n), 10, 64); err != nil {
+			errs.add(field(name), "must be an integer")
+			return
+		}
+		d.checkRange(s, n, name, errs)
+	case "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			errs.add(field(name), "must be a number")
+			return
+		}
+		d.checkRange(s, n, name, errs)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs.add(field(name), "must be a boolean")
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			errs.add(field(name), "must be a string")
+			return
+		}
+		checkString(s, str, name, errs)
+	}
+}
+
+// checkRange checks the minimum and maximum of a number
+func (d *Document) checkRange(s *Schema, n json.Number, name string, errs *Errors) {
+	f, _ := n.Float64()
+	if s.Minimum != nil && f < *s.Minimum {
+		errs.add(field(name), "must be at least %g", *s.Minimum)
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		errs.add(field(name), "must be at most %g", *s.Maximum)
+	}
+}
+
+// checkString checks the length, pattern, format and enum of a string
+func checkString(s *Schema, str, name string, errs *Errors) {
+	length := len([]rune(str))
+	switch {
+	case s.MinLength != nil && length < *s.MinLength && *s.MinLength == 1:
+		errs.add(field(name), "must not be empty")
+	case s.MinLength != nil && length < *s.MinLength:
+		errs.add(field(name), "must have at least %d characters", *s.MinLength)
+	case s.MaxLength != nil && length > *s.MaxLength:
+		errs.add(field(name), "must have at most %d characters", *s.MaxLength)
+	case s.Pattern != "" && !matches(s.Pattern, str):
+		errs.add(field(name), "must match %s", s.Pattern)
+	case s.Format == "date-time" && !validTime(str):
+		errs.add(field(name), "must be a RFC 3339 date-time")
+	case len(s.Enum) > 0 && !contains(s.Enum, str):
+		errs.add(field(name), "must be one of %s", strings.Join(s.Enum, ", "))
+	}
+}
+
+// compiled are the patterns of the schemas, compiled once
+var compiled sync.Map
+
+// matches tells if str matches pattern, an invalid pattern matches anything
+func matches(pattern, str string) bool {
+	re, ok := compiled.Load(pattern)
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return true
+		}
+		compiled.Store(pattern, re)
+	}
+	return re.(*regexp.Regexp).MatchString(str)
+}
+
+// validTime tells if s is a RFC 3339 time
+func validTime(s string) bool {
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+// contains tells if values has s
+func contains(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// path is the name of a field of a value, the fields of the body have no prefix
+func path(name, key string) string {
+	if name == "" {
+		return key
+	}
+	return name + "." + key
+}
+
+// field is the name of a value, the body itself is body
+func field(name string) string {
+	if name == "" {
+		return "body"
+	}
+	return name
+}
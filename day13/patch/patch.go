@@ -0,0 +1,276 @@
+// Package patch applies JSON Merge Patch (RFC 7396)
+// and JSON Patch (RFC 6902) documents
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MergePatchType is the media type of RFC 7396 documents
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is the media type of RFC 6902 documents
+	JSONPatchType = "application/json-patch+json"
+)
+
+var (
+	// ErrTestFailed raised when a test operation does not match the document
+	ErrTestFailed = errors.New("test operation failed")
+	// ErrPathNotFound raised when a path points to nothing
+	ErrPathNotFound = errors.New("path not found")
+)
+
+// MergePatch applies a merge patch to a json document
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// merge follows the MergePatch pseudo code of RFC 7396
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for key, value := range p {
+		// null removes the member
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = merge(t[key], value)
+		}
+	}
+	return t
+}
+
+// Operation is one step of a json patch
+type Operation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// Value is nil when the member is missing, null is a valid value
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies the add, remove, replace and test operations to a json document
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	operations := []Operation{}
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, err
+	}
+	for i, op := range operations {
+		var err error
+		target, err = apply(target, op)
+		if err == ErrTestFailed {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+// apply runs a single operation over the document
+func apply(doc interface{}, op Operation) (interface{}, error) {
+	tokens, err := pointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%s requires a value", op.Op)
+		}
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+	switch op.Op {
+	case "add":
+		return add(doc, tokens, value)
+	case "remove":
+		return remove(doc, tokens)
+	case "replace":
+		// replace is remove followed by add on the same path
+		if _, err = get(doc, tokens); err != nil {
+			return nil, err
+		}
+		if len(tokens) == 0 {
+			return value, nil
+		}
+		if doc, err = remove(doc, tokens); err != nil {
+			return nil, err
+		}
+		return add(doc, tokens, value)
+	case "test":
+		current, err := get(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// pointer splits a json pointer (RFC 6901) into tokens
+func pointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// index parses an array index, "-" is the end of the array
+func index(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	// leading zeros are not allowed
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, ErrPathNotFound
+	}
+	return i, nil
+}
+
+// get returns the value pointed by tokens
+func get(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return doc, nil
+}
+
+// add sets value at tokens, inserting into arrays
+func add(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token, last := tokens[0], len(tokens) == 1
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if last {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		child, err := add(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		i, err := index(token, len(node), last)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		if node[i], err = add(node[i], tokens[1:], value); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// remove deletes the value at tokens
+func remove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("can not remove the whole document")
+	}
+	token, last := tokens[0], len(tokens) == 1
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		if last {
+			delete(node, token)
+			return node, nil
+		}
+		child, err := remove(child, tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		i, err := index(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			return append(node[:i], node[i+1:]...), nil
+		}
+		if node[i], err = remove(node[i], tokens[1:]); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
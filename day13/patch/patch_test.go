@@ -0,0 +1,97 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// equalJSON compares two documents ignoring the order of members
+func equalJSON(t *testing.T, expected string, obtained []byte) {
+	var e, o interface{}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(obtained, &o); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(e, o) {
+		t.Errorf("expected %s but %s was obtained", expected, obtained)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396 appendix A
+	table := []struct {
+		Doc      string
+		Patch    string
+		Expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{"done":true}`, `{"done":false}`, `{"done":false}`},
+	}
+	for _, data := range table {
+		obtained, err := MergePatch([]byte(data.Doc), []byte(data.Patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		equalJSON(t, data.Expected, obtained)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	table := []struct {
+		Doc      string
+		Patch    string
+		Expected string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, `{"a/b":3}`},
+		{`{"done":true}`, `[{"op":"test","path":"/done","value":true},{"op":"replace","path":"/done","value":false}]`, `{"done":false}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":null}]`, `{"foo":"bar","child":null}`},
+	}
+	for _, data := range table {
+		obtained, err := JSONPatch([]byte(data.Doc), []byte(data.Patch))
+		if err != nil {
+			t.Fatalf("%s: %v", data.Patch, err)
+		}
+		equalJSON(t, data.Expected, obtained)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	table := []struct {
+		Patch    string
+		Expected error
+	}{
+		{`[{"op":"test","path":"/foo","value":"baz"}]`, ErrTestFailed},
+		{`[{"op":"remove","path":"/nothing"}]`, nil},
+		{`[{"op":"replace","path":"/nothing","value":1}]`, nil},
+		{`[{"op":"add","path":"/a/b","value":1}]`, nil},
+		{`[{"op":"add","path":"/foo"}]`, nil},
+		{`[{"op":"move","from":"/foo","path":"/bar"}]`, nil},
+		{`[{"op":"add","path":"foo","value":1}]`, nil},
+	}
+	for _, data := range table {
+		_, err := JSONPatch([]byte(`{"foo":"bar"}`), []byte(data.Patch))
+		if err == nil {
+			t.Errorf("%s: expected an error", data.Patch)
+		}
+		if data.Expected != nil && err != data.Expected {
+			t.Errorf("%s: expected %v but %v was obtained", data.Patch, data.Expected, err)
+		}
+	}
+}
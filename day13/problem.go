@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"unicode"
+
+	valid "github.com/asaskevich/govalidator"
+	"github.com/cassiobotaro/60-days-of-go/day13/openapi"
+	"github.com/urfave/negroni"
+)
+
+// problemType is the content type of the errors
+const problemType = "application/problem+json"
+
+// errInvalidID is raised when an id of the path is not a number
+var errInvalidID = errors.New("invalid id")
+
+// problem is an error response as described by RFC 7807. Type is
+// always about:blank, so Title is the text of the status
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// InvalidParams are the fields of the body that did not validate
+	InvalidParams []invalidParam `json:"invalid_params,omitempty"`
+}
+
+// invalidParam is a field that did not validate and why
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// newProblem returns the problem of a status
+func newProblem(detail string, status int) problem {
+	return problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// writeProblem writes a problem, or a struct embedding a problem to
+// add members to it, like the results of a batch
+func writeProblem(w http.ResponseWriter, content interface{}, status int) {
+	w.Header().Set("Content-Type", problemType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(content); err != nil {
+		log.Println(err)
+	}
+}
+
+// renderProblem renders a problem with detail
+func renderProblem(w http.ResponseWriter, detail string, status int) {
+	writeProblem(w, newProblem(detail, status), status)
+}
+
+// renderError renders err as a problem. The fields that did not
+// validate become invalid params and the errors of a 5xx are only
+// logged, they may tell more than the client should know
+func renderError(w http.ResponseWriter, err error, status int) {
+	writeProblem(w, errorProblem(err, status), status)
+}
+
+// errorProblem is the problem of err, as rendered by renderError
+func errorProblem(err error, status int) problem {
+	if status >= http.StatusInternalServerError {
+		log.Println(err)
+		return newProblem("", status)
+	}
+	// govalidator ends every error with a semicolon
+	p := newProblem(strings.TrimSuffix(err.Error(), ";"), status)
+	p.InvalidParams = invalidParams(err)
+	if len(p.InvalidParams) > 0 {
+		// the detail names the fields as the params do, govalidator
+		// names them as the struct does
+		reasons := make([]string, len(p.InvalidParams))
+		for i, param := range p.InvalidParams {
+			reasons[i] = param.Name + ": " + param.Reason
+		}
+		p.Detail = strings.Join(reasons, "; ")
+	}
+	return p
+}
+
+// invalidParams lists the fields of a validation error, in order
+func invalidParams(err error) []invalidParam {
+	switch e := err.(type) {
+	case valid.Errors:
+		params := []invalidParam{}
+		for _, item := range e.Errors() {
+			params = append(params, invalidParams(item)...)
+		}
+		return params
+	case valid.Error:
+		return []invalidParam{{Name: jsonName(e.Name), Reason: e.Err.Error()}}
+	case *json.UnmarshalTypeError:
+		return []invalidParam{{Name: e.Field, Reason: "cannot be a " + e.Value}}
+	case openapi.Errors:
+		params := make([]invalidParam, len(e))
+		for i, item := range e {
+			params[i] = invalidParam{Name: item.Name, Reason: item.Reason}
+		}
+		return params
+	}
+	if err == errRemindAfterDue {
+		return []invalidParam{{Name: "remind_at", Reason: err.Error()}}
+	}
+	return nil
+}
+
+// jsonName is the name of a field in the json of the api, ListID is list_id
+func jsonName(field string) string {
+	var name strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+	return name.String()
+}
+
+// notFound answers the paths that match no route
+func notFound(w http.ResponseWriter, r *http.Request) {
+	renderProblem(w, "no route matches "+r.URL.Path, http.StatusNotFound)
+}
+
+// recovery is a middleware that turns a panic into a 500 problem,
+// unless the response was already started
+func recovery(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("PANIC: %v\n%s", err, debug.Stack())
+			if rw, ok := w.(negroni.ResponseWriter); ok && rw.Written() {
+				return
+			}
+			renderProblem(w, "", http.StatusInternalServerError)
+		}
+	}()
+	next(w, r)
+}
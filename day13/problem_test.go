@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/idempotency"
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+)
+
+func TestProblems(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	createCards(t, server, token, "milk")
+	for _, test := range []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		status int
+		// detail is a part expected in the detail of the problem
+		detail  string
+		invalid []invalidParam
+	}{
+		{
+			name: "invalid fields", token: token, method: http.MethodPost, path: "/cards",
+			body:   `{"title":"no spaces","text":"","done":"yes"}`,
+			status: http.StatusBadRequest, detail: "done: must be a boolean; title: must match",
+			invalid: []invalidParam{
+				{Name: "done", Reason: "must be a boolean"},
+				{Name: "title", Reason: "must match ^([a-zA-Z0-9]+)?$"},
+			},
+		},
+		{
+			name: "fields of a patched card", token: token, method: http.MethodPatch, path: "/cards/1",
+			body:   `{"title":"no spaces","text":"with spaces"}`,
+			status: http.StatusBadRequest, detail: "title: no spaces does not validate as alphanum",
+			invalid: []invalidParam{
+				{Name: "title", Reason: "no spaces does not validate as alphanum"},
+				{Name: "text", Reason: "with spaces does not validate as alphanum"},
+			},
+		},
+		{
+			name: "field of a wrong type", token: token, method: http.MethodPost, path: "/cards",
+			body:    `{"title":"milk","text":"buy","done":"yes"}`,
+			status:  http.StatusBadRequest,
+			invalid: []invalidParam{{Name: "done", Reason: "must be a boolean"}},
+		},
+		{
+			name: "reminder after the due date", token: token, method: http.MethodPost, path: "/cards",
+			body:    `{"title":"milk","text":"buy","due_at":"2030-01-01T00:00:00Z","remind_at":"2030-01-02T00:00:00Z"}`,
+			status:  http.StatusBadRequest,
+			invalid: []invalidParam{{Name: "remind_at", Reason: errRemindAfterDue.Error()}},
+		},
+		{
+			name: "broken json", token: token, method: http.MethodPost, path: "/cards",
+			body: `{"title":`, status: http.StatusUnprocessableEntity, detail: "unexpected EOF",
+		},
+		{
+			name: "bad query", token: token, method: http.MethodGet, path: "/cards?limit=0",
+			status: http.StatusBadRequest, detail: "limit: must be at least 1",
+			invalid: []invalidParam{{Name: "limit", Reason: "must be at least 1"}},
+		},
+		{
+			name: "not found", token: token, method: http.MethodGet, path: "/cards/9",
+			status: http.StatusNotFound, detail: "card not found",
+		},
+		{
+			name: "no route", token: token, method: http.MethodGet, path: "/nowhere",
+			status: http.StatusNotFound, detail: "no route matches /nowhere",
+		},
+		{
+			name: "no token", method: http.MethodGet, path: "/cards",
+			status: http.StatusUnauthorized, detail: "missing bearer token",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := call(t, server, test.token, test.method, test.path, test.body)
+			p := problem{}
+			if err := json.Unmarshal(body, &p); err != nil || resp.StatusCode != test.status || resp.Header.Get("Content-Type") != problemType {
+				t.Fatalf("status = %d, Content-Type = %q, body = %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+			}
+			if p.Type != "about:blank" || p.Title != http.StatusText(test.status) || p.Status != test.status || !strings.Contains(p.Detail, test.detail) {
+				t.Errorf("unexpected problem %s", body)
+			}
+			if !reflect.DeepEqual(p.InvalidParams, test.invalid) {
+				t.Errorf("expected invalid params %+v but %+v was obtained", test.invalid, p.InvalidParams)
+			}
+		})
+	}
+}
+
+func TestPanicProblem(t *testing.T) {
+	// the globals of the api are set by testServer
+	token := testToken(t, testServer(t), "alice")
+	r := newRouter()
+	r.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("secret details")
+	})
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(time.Minute), ratelimit.Limit{})
+	n, err := newServer(r, limiter, idempotency.New(idempotency.NewMemoryStore(time.Minute), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(n)
+	defer server.Close()
+
+	resp, body := call(t, server, token, http.MethodGet, "/panic", "")
+	p := problem{}
+	if err := json.Unmarshal(body, &p); err != nil || resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("Content-Type") != problemType {
+		t.Fatalf("status = %d, Content-Type = %q, body = %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	// what went wrong is only logged
+	if !reflect.DeepEqual(p, newProblem("", http.StatusInternalServerError)) || strings.Contains(string(body), "secret") {
+		t.Errorf("unexpected problem %s", body)
+	}
+}
+
+func TestJSONName(t *testing.T) {
+	for field, name := range map[string]string{
+		"Title":    "title",
+		"ListID":   "list_id",
+		"RemindAt": "remind_at",
+		"ID":       "id",
+	} {
+		if got := jsonName(field); got != name {
+			t.Errorf("jsonName(%q) = %q, expected %q", field, got, name)
+		}
+	}
+}
+
+func TestLargeBodies(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	createCards(t, server, token, "milk")
+	call(t, server, token, http.MethodDelete, "/cards/1", "")
+	large := `{"title":"milk","text":"buy"}` + strings.Repeat(" ", maxImportBytes)
+	for _, test := range []struct {
+		name    string
+		path    string
+		headers []string
+	}{
+		// the body of a card is read by the validator
+		{"card", "/cards", nil},
+		// restoring has no body to validate, the idempotency key reads it
+		{"idempotent request", "/trash/1/restore", []string{"Idempotency-Key", "k"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := call(t, server, token, http.MethodPost, test.path, large, test.headers...)
+			if resp.StatusCode != http.StatusRequestEntityTooLarge || resp.Header.Get("Content-Type") != problemType {
+				t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+			}
+		})
+	}
+	// nothing ran
+	if resp, body := call(t, server, token, http.MethodGet, "/cards/1", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+	}
+}
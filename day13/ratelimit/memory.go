@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is the state of a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// refill adds the tokens earned since the last request
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// MemoryStore keeps the buckets in a map. Every sweep interval the
+// buckets that are full again are evicted, a full bucket is the same
+// as a new one, so idle clients do not take memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	sweep     time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a store that evicts the idle buckets every sweep
+func NewMemoryStore(sweep time.Duration) *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, sweep: sweep}
+}
+
+// Len is how many buckets are kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// Take takes a token of the bucket of key
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= s.sweep {
+		s.evict(now)
+		s.lastSweep = now
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+	result := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second))
+	return result
+}
+
+// evict removes the buckets that are full by now
+func (s *MemoryStore) evict(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= b.limit.fill() {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package ratelimit is a negroni middleware that limits how often each
+// client calls the server. Every client has a token bucket per rule, a
+// request takes a token and the bucket refills at the rate of the rule.
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headers of a limited response, the limit is the burst of the bucket
+// and the reset is the seconds until it is full
+const (
+	LimitHeader     = "X-RateLimit-Limit"
+	RemainingHeader = "X-RateLimit-Remaining"
+	ResetHeader     = "X-RateLimit-Reset"
+)
+
+// Limit is a token bucket, it holds Burst tokens and refills Rate tokens
+// a second. A Rate that is not positive does not limit
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// unlimited tells if the limit lets everything through
+func (l Limit) unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// fill is how long an empty bucket takes to be full
+func (l Limit) fill() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Result is what a bucket answered to a request
+type Result struct {
+	Allowed bool
+	// Remaining are the tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until a token is available, zero when allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full
+	Reset time.Duration
+}
+
+// Store keeps the buckets, a store shared by many servers makes the
+// limits apply to all of them
+type Store interface {
+	// Take takes a token of the bucket of key at now, creating a full
+	// bucket when key has none
+	Take(key string, limit Limit, now time.Time) Result
+}
+
+// Rule is the limit of the requests with Method to the paths matching
+// Pattern. An empty Method matches any method and the {name} segments of
+// Pattern match any segment, like the routes of gorilla/mux
+type Rule struct {
+	Method  string
+	Pattern string
+	Limit   Limit
+}
+
+// matches tells if the rule applies to the request
+func (rule Rule) matches(r *http.Request) bool {
+	if rule.Method != "" && rule.Method != r.Method {
+		return false
+	}
+	want := strings.Split(strings.Trim(rule.Pattern, "/"), "/")
+	got := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			continue
+		}
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String is the rule in the format read by ParseRule
+func (rule Rule) String() string {
+	return fmt.Sprintf("%s %s=%g:%d", rule.Method, rule.Pattern, rule.Limit.Rate, rule.Limit.Burst)
+}
+
+// ParseRule reads a rule written as "METHOD /pattern=rate:burst",
+// the method can be left out and rate is in requests per second
+func ParseRule(s string) (Rule, error) {
+	rule := Rule{}
+	eq := strings.LastIndex(s, "=")
+	if eq < 0 {
+		return rule, fmt.Errorf("rule %q: missing =rate:burst", s)
+	}
+	route := strings.Fields(s[:eq])
+	switch len(route) {
+	case 1:
+		rule.Pattern = route[0]
+	case 2:
+		rule.Method, rule.Pattern = strings.ToUpper(route[0]), route[1]
+	default:
+		return rule, fmt.Errorf("rule %q: route must be [METHOD] /pattern", s)
+	}
+	if !strings.HasPrefix(rule.Pattern, "/") {
+		return rule, fmt.Errorf("rule %q: pattern must start with /", s)
+	}
+	limit := strings.Split(s[eq+1:], ":")
+	if len(limit) != 2 {
+		return rule, fmt.Errorf("rule %q: limit must be rate:burst", s)
+	}
+	var err error
+	if rule.Limit.Rate, err = strconv.ParseFloat(limit[0], 64); err != nil {
+		return rule, fmt.Errorf("rule %q: %v", s, err)
+	}
+	if rule.Limit.Burst, err = strconv.Atoi(limit[1]); err != nil {
+		return rule, fmt.Errorf("rule %q: %v", s, err)
+	}
+	return rule, nil
+}
+
+// Limiter is the middleware, the first rule matching a request limits
+// it and the requests no rule matches share the Default limit
+type Limiter struct {
+	Default Limit
+	Rules   []Rule
+	// Key tells the clients apart, RemoteIP by default
+	Key func(r *http.Request) string
+	// Exceeded answers the limited requests, after the headers are
+	// set. By default it answers with a json error
+	Exceeded http.HandlerFunc
+
+	store Store
+}
+
+// New returns a limiter keeping its buckets in store
+func New(store Store, limit Limit, rules ...Rule) *Limiter {
+	return &Limiter{Default: limit, Rules: rules, Key: RemoteIP, store: store}
+}
+
+// RemoteIP is the address of the client without the port
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rule returns the name of the bucket and the limit of the request
+func (l *Limiter) rule(r *http.Request) (string, Limit) {
+	for _, rule := range l.Rules {
+		if rule.matches(r) {
+			return rule.Method + " " + rule.Pattern, rule.Limit
+		}
+	}
+	return "*", l.Default
+}
+
+// ServeHTTP takes a token for the request, answering 429 Too Many
+// Requests when the bucket is empty
+func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	name, limit := l.rule(r)
+	if limit.unlimited() {
+		next(w, r)
+		return
+	}
+	result := l.store.Take(l.Key(r)+"|"+name, limit, time.Now())
+	w.Header().Set(LimitHeader, strconv.Itoa(limit.Burst))
+	w.Header().Set(RemainingHeader, strconv.Itoa(result.Remaining))
+	w.Header().Set(ResetHeader, strconv.Itoa(seconds(result.Reset)))
+	if result.Allowed {
+		next(w, r)
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+	if l.Exceeded != nil {
+		l.Exceeded(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{"errors": "rate limit exceeded"})
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
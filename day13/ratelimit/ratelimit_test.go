@@ -0,0 +1,136 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+	"github.com/urfave/negroni"
+)
+
+func TestBucket(t *testing.T) {
+	s := ratelimit.NewMemoryStore(time.Hour)
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if got := s.Take("a", limit, now); got.Allowed != want {
+			t.Fatalf("request %d allowed = %v", i, got.Allowed)
+		}
+	}
+	// another client has its own bucket
+	if !s.Take("b", limit, now).Allowed {
+		t.Fatal("b was limited by a")
+	}
+	// half a token was earned
+	got := s.Take("a", limit, now.Add(500*time.Millisecond))
+	if got.Allowed || got.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("result = %+v", got)
+	}
+	got = s.Take("a", limit, now.Add(time.Second))
+	if !got.Allowed || got.Remaining != 0 || got.Reset != 2*time.Second {
+		t.Fatalf("result = %+v", got)
+	}
+}
+
+func TestIdleBucketsAreEvicted(t *testing.T) {
+	s := ratelimit.NewMemoryStore(time.Minute)
+	limit := ratelimit.Limit{Rate: 1, Burst: 10}
+	now := time.Now()
+	s.Take("idle", limit, now)
+	s.Take("busy", limit, now)
+	s.Take("busy", limit, now.Add(55*time.Second))
+	// idle is full again, busy took a token 5 seconds ago
+	s.Take("new", limit, now.Add(time.Minute))
+	if got := s.Len(); got != 2 {
+		t.Fatalf("buckets = %d, want busy and new", got)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ratelimit.ParseRule("post /tokens=0.5:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ratelimit.Rule{Method: "POST", Pattern: "/tokens", Limit: ratelimit.Limit{Rate: 0.5, Burst: 5}}
+	if rule != want {
+		t.Fatalf("rule = %+v", rule)
+	}
+	if rule, err = ratelimit.ParseRule("/cards/{id}=10:20"); err != nil || rule.Method != "" {
+		t.Fatalf("rule = %+v, err = %v", rule, err)
+	}
+	for _, s := range []string{"/cards", "POST tokens=1:1", "/cards=1", "/cards=a:1", "GET /a /b=1:1"} {
+		if _, err = ratelimit.ParseRule(s); err == nil {
+			t.Errorf("%q was parsed", s)
+		}
+	}
+}
+
+// serve sends a request through the limiter, returning the response
+func serve(l *ratelimit.Limiter, method, path, remote string) *httptest.ResponseRecorder {
+	n := negroni.New(l)
+	n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote
+	w := httptest.NewRecorder()
+	n.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	l := ratelimit.New(ratelimit.NewMemoryStore(time.Hour), ratelimit.Limit{Rate: 1.0 / 3600, Burst: 2},
+		ratelimit.Rule{Method: http.MethodPost, Pattern: "/tokens", Limit: ratelimit.Limit{Rate: 1.0 / 3600, Burst: 1}},
+		ratelimit.Rule{Pattern: "/cards/events"},
+	)
+	w := serve(l, http.MethodGet, "/cards", "10.0.0.1:1000")
+	if w.Code != http.StatusOK || w.Header().Get(ratelimit.LimitHeader) != "2" || w.Header().Get(ratelimit.RemainingHeader) != "1" {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+	// another port is the same client
+	serve(l, http.MethodGet, "/cards/1", "10.0.0.1:2000")
+	w = serve(l, http.MethodGet, "/cards", "10.0.0.1:1000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3600" {
+		t.Fatalf("Retry-After = %q", got)
+	}
+	if got := w.Header().Get(ratelimit.ResetHeader); got != "7200" {
+		t.Fatalf("%s = %q", ratelimit.ResetHeader, got)
+	}
+
+	// routes with a rule have their own bucket
+	if w = serve(l, http.MethodPost, "/tokens", "10.0.0.1:1000"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if w = serve(l, http.MethodPost, "/tokens", "10.0.0.1:1000"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d", w.Code)
+	}
+	// a rule without a rate does not limit
+	for i := 0; i < 5; i++ {
+		if w = serve(l, http.MethodGet, "/cards/events", "10.0.0.1:1000"); w.Code != http.StatusOK || w.Header().Get(ratelimit.LimitHeader) != "" {
+			t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+		}
+	}
+	// other clients are not limited
+	if w = serve(l, http.MethodGet, "/cards", "10.0.0.2:1000"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	l.Exceeded = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if w = serve(l, http.MethodGet, "/cards", "10.0.0.1:1000"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+
+	l.Key = func(r *http.Request) string { return r.Header.Get("Authorization") }
+	req := httptest.NewRequest(http.MethodGet, "/cards", nil)
+	req.Header.Set("Authorization", "Bearer a")
+	w = httptest.NewRecorder()
+	l.ServeHTTP(w, req, func(http.ResponseWriter, *http.Request) {})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+)
+
+// rateRules are the -rate-rule flags, the first one set replaces the defaults
+type rateRules struct {
+	rules []ratelimit.Rule
+	set   bool
+}
+
+// loginRules make guessing passwords and creating users slow
+var loginRules = []ratelimit.Rule{
+	{Method: http.MethodPost, Pattern: "/tokens", Limit: ratelimit.Limit{Rate: 0.1, Burst: 5}},
+	{Method: http.MethodPost, Pattern: "/users", Limit: ratelimit.Limit{Rate: 0.1, Burst: 5}},
+}
+
+// probeRules never limit the health checks, they would use the limit
+// of the clients behind the same address
+var probeRules = []ratelimit.Rule{
+	{Method: http.MethodGet, Pattern: "/healthz"},
+	{Method: http.MethodGet, Pattern: "/readyz"},
+}
+
+func (f *rateRules) String() string {
+	rules := make([]string, len(f.rules))
+	for i, rule := range f.rules {
+		rules[i] = rule.String()
+	}
+	return strings.Join(rules, ", ")
+}
+
+func (f *rateRules) Set(s string) error {
+	rule, err := ratelimit.ParseRule(s)
+	if err != nil {
+		return err
+	}
+	if !f.set {
+		f.rules, f.set = nil, true
+	}
+	f.rules = append(f.rules, rule)
+	return nil
+}
+
+// clientKey tells the clients apart, by user when they are
+// authenticated, whatever token they use, and by address when they
+// are not, like the logins and the requests with a wrong token
+func clientKey(r *http.Request) string {
+	if user := currentUser(r); user != nil {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return "ip:" + ratelimit.RemoteIP(r)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+)
+
+func TestRateLimitKeys(t *testing.T) {
+	// the logins are not limited, so the test can take many tokens
+	server := limitedServer(t, ratelimit.New(ratelimit.NewMemoryStore(time.Minute), ratelimit.Limit{Rate: 1.0 / 3600, Burst: 2},
+		ratelimit.Rule{Method: http.MethodPost, Pattern: "/users"},
+		ratelimit.Rule{Method: http.MethodPost, Pattern: "/tokens"}))
+
+	// the requests with a wrong token are limited by address
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if resp, content := call(t, server, "wrong", http.MethodGet, "/cards", ""); resp.StatusCode != want {
+			t.Errorf("request %d with a wrong token: status = %d, body = %s", i, resp.StatusCode, content)
+		}
+	}
+
+	// a user keeps their bucket when they log in again
+	first := testToken(t, server, "alice")
+	for i, want := range []int{http.StatusOK, http.StatusOK} {
+		if resp, content := call(t, server, first, http.MethodGet, "/cards", ""); resp.StatusCode != want {
+			t.Errorf("request %d of alice: status = %d, body = %s", i, resp.StatusCode, content)
+		}
+	}
+	resp, content := call(t, server, "", http.MethodPost, "/tokens", `{"name":"alice","password":"secretpass"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /tokens: status = %d, body = %s", resp.StatusCode, content)
+	}
+	second := session{}
+	if err := json.Unmarshal(content, &second); err != nil {
+		t.Fatal(err)
+	}
+	if resp, content := call(t, server, second.Token, http.MethodGet, "/cards", ""); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("request of alice with a new token: status = %d, body = %s", resp.StatusCode, content)
+	}
+
+	// another user behind the same address has a bucket of their own
+	bob := testToken(t, server, "bob")
+	if resp, content := call(t, server, bob, http.MethodGet, "/cards", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("request of bob: status = %d, body = %s", resp.StatusCode, content)
+	}
+}
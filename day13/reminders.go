@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+)
+
+// errRemindAfterDue raised when a card would be reminded after it's due
+var errRemindAfterDue = errors.New("remind_at must not be after due_at")
+
+// validDates checks the due and reminder dates of a card
+func validDates(card *cards.Card) error {
+	if card.DueAt != nil && card.RemindAt != nil && card.RemindAt.After(*card.DueAt) {
+		return errRemindAfterDue
+	}
+	return nil
+}
+
+// overdueCards lists the cards not done whose due date passed,
+// the other filters of GET /cards can be used too. An earlier
+// due_before narrows the list
+func overdueCards(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	notDone, now := false, time.Now()
+	q.Done = &notDone
+	if q.DueBefore == nil || q.DueBefore.After(now) {
+		q.DueBefore = &now
+	}
+	renderPage(w, r, q)
+}
+
+// logReminder is the reminder fired by default
+func logReminder(card *cards.Card) {
+	log.Printf("reminder: card %d %q", card.ID, card.Title)
+}
+
+// runReminders fires, every interval, the reminders whose time passed.
+// Pending reminders are kept by the database, so the ones that passed
+// while the server was down are fired when it's back. A reminder is
+// marked only after it's fired, so a crash in between fires it again.
+// It returns when ctx is done.
+func runReminders(ctx context.Context, db database.Database, interval time.Duration, remind func(card *cards.Card)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		due, err := db.DueReminders(time.Now())
+		if err != nil {
+			log.Println("reminders:", err)
+			continue
+		}
+		for _, card := range due {
+			remind(card)
+			if err = db.MarkReminded(card.ID, *card.RemindAt); err != nil && err != database.ErrCardNotFound {
+				log.Println("reminders:", err)
+			}
+		}
+	}
+}
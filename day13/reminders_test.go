@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+)
+
+func TestRunReminders(t *testing.T) {
+	memory := database.NewMemoryDB()
+	past := time.Now().Add(-time.Minute)
+	if err := memory.CreateCard(&cards.Card{Title: "milk", Text: "buy", RemindAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	reminded := make(chan int64, 10)
+	stopped := make(chan bool)
+	go func() {
+		runReminders(ctx, memory, 10*time.Millisecond, func(card *cards.Card) {
+			reminded <- card.ID
+		})
+		stopped <- true
+	}()
+	select {
+	case id := <-reminded:
+		if id != 1 {
+			t.Errorf("card %d was reminded", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the reminder was not fired")
+	}
+
+	stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the reminders did not stop")
+	}
+	// fired once, it's marked
+	if len(reminded) != 0 {
+		t.Errorf("the reminder was fired %d more times", len(reminded))
+	}
+	if due, err := memory.DueReminders(time.Now()); err != nil || len(due) != 0 {
+		t.Errorf("due = %v, err = %v", due, err)
+	}
+}
+
+func TestOverdueCards(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	now := time.Now().UTC()
+	for _, due := range []time.Duration{-2 * time.Hour, -time.Hour, time.Hour} {
+		body := `{"title":"card","text":"text","due_at":"` + now.Add(due).Format(time.RFC3339) + `"}`
+		if resp, content := call(t, server, token, http.MethodPost, "/cards", body); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("status = %d, body = %s", resp.StatusCode, content)
+		}
+	}
+	for _, test := range []struct {
+		dueBefore time.Duration
+		ids       []int64
+	}{
+		{0, []int64{1, 2}},
+		// an earlier due_before narrows the list
+		{-90 * time.Minute, []int64{1}},
+		// a later one does not list what is not due yet
+		{2 * time.Hour, []int64{1, 2}},
+	} {
+		path := "/cards/overdue"
+		if test.dueBefore != 0 {
+			path += "?due_before=" + url.QueryEscape(now.Add(test.dueBefore).Format(time.RFC3339))
+		}
+		resp, content := call(t, server, token, http.MethodGet, path, "")
+		page := cardPage{}
+		if err := json.Unmarshal(content, &page); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", path, resp.StatusCode, content)
+		}
+		var ids []int64
+		for _, card := range page.Cards {
+			ids = append(ids, card.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(test.ids) {
+			t.Errorf("%s: ids = %v, want %v", path, ids, test.ids)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// longLived are the responses that last as long as the client wants,
+// the write timeout of the server does not apply to them
+var longLived = map[string]bool{"/cards/events": true, "/cards/export": true}
+
+// withoutWriteTimeout lifts the write deadline of the long lived responses.
+// It must wrap negroni, whose response writer hides the connection
+func withoutWriteTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && longLived[r.URL.Path] {
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+				log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve answers on l until ctx is done, then stops taking connections and
+// waits up to timeout for the requests in flight to finish
+func serve(ctx context.Context, server *http.Server, l net.Listener, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(l)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("shutting down, waiting up to %s for the requests in flight", timeout)
+	shutdown, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(shutdown)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/cardsclient"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/metrics"
+	"github.com/cassiobotaro/60-days-of-go/day13/ratelimit"
+)
+
+func TestHealth(t *testing.T) {
+	server := testServer(t)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status = %d", path, resp.StatusCode)
+		}
+	}
+
+	db.(*database.MemoryDB).Close()
+	resp, err := http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if resp, err = http.Get(server.URL + "/healthz"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := testServer(t)
+	client := testClient(t, server, "alice")
+	ctx := context.Background()
+	for _, title := range []string{"milk", "eggs", "bread"} {
+		if _, err := client.CreateCard(ctx, &cards.Card{Title: title, Text: "buy"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.PatchCard(ctx, 1, 0, map[string]bool{"done": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteCard(ctx, 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetCard(ctx, 7); err != cardsclient.ErrCardNotFound {
+		t.Fatalf("err = %v", err)
+	}
+
+	// the api does not serve them
+	if resp, _ := call(t, server, "", http.MethodGet, "/metrics", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /metrics of the api: status = %d", resp.StatusCode)
+	}
+
+	scraper := httptest.NewServer(metricsHandler(ratelimit.New(ratelimit.NewMemoryStore(time.Minute), ratelimit.Limit{Rate: 1.0 / 3600, Burst: 1})))
+	defer scraper.Close()
+	resp, err := http.Get(scraper.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		`http_requests_total{method="POST",route="/cards",status="201"} 3`,
+		`http_requests_total{method="PATCH",route="/cards/{id}",status="200"} 1`,
+		`http_requests_total{method="GET",route="/cards/{id}",status="404"} 1`,
+		`cards{state="pending"} 1`,
+		`cards{state="done"} 1`,
+		`cards{state="trashed"} 1`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("%q is missing from\n%s", line, body)
+		}
+	}
+
+	// the scrapes are limited too
+	limited, err := http.Get(scraper.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited.Body.Close()
+	if limited.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second scrape: status = %d", limited.StatusCode)
+	}
+}
+
+func TestSetFromEnv(t *testing.T) {
+	flags := flag.NewFlagSet("day13", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:3000", "")
+	timeout := flags.Duration("write-timeout", time.Second, "")
+	rate := flags.Float64("rate", 10, "")
+	env := map[string]string{"CARDS_ADDR": ":8080", "CARDS_WRITE_TIMEOUT": "1m", "RATE": "1"}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	if err := setFromEnv(flags, lookup); err != nil {
+		t.Fatal(err)
+	}
+	// the command line wins
+	if err := flags.Parse([]string{"-addr", ":9090"}); err != nil {
+		t.Fatal(err)
+	}
+	if *addr != ":9090" || *timeout != time.Minute || *rate != 10 {
+		t.Errorf("addr = %q, write timeout = %s, rate = %v", *addr, *timeout, *rate)
+	}
+
+	env["CARDS_RATE"] = "fast"
+	if err := setFromEnv(flags, lookup); err == nil || err.Error()[:10] != "CARDS_RATE" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	started := make(chan bool)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server, l, time.Minute)
+	}()
+
+	answer := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			answer <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		answer <- string(body)
+	}()
+	<-started
+	stop()
+	if got := <-answer; got != "done" {
+		t.Errorf("the request in flight got %q", got)
+	}
+	if err = <-served; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = http.Get("http://" + l.Addr().String()); err == nil {
+		t.Error("the server still takes requests")
+	}
+}
+
+func TestServeTimeout(t *testing.T) {
+	started := make(chan bool)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-r.Context().Done()
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server, l, 50*time.Millisecond)
+	}()
+	go http.Get("http://" + l.Addr().String())
+	<-started
+	stop()
+	if err = <-served; err != context.DeadlineExceeded {
+		t.Fatalf("err = %v", err)
+	}
+	server.Close()
+}
+
+func TestClaimOrphans(t *testing.T) {
+	server := testServer(t)
+	// a card from before the users
+	if err := db.CreateCard(&cards.Card{Title: "old", Text: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	token := testToken(t, server, "alice")
+	if _, err := claimOrphans(db, "bob"); err == nil {
+		t.Error("expected an error claiming for an unknown user")
+	}
+	if claimed, err := claimOrphans(db, "alice"); err != nil || claimed != 1 {
+		t.Fatalf("claimed = %d, err = %v", claimed, err)
+	}
+	// the history of the card is alice's too
+	for _, step := range []struct{ method, path string }{
+		{http.MethodGet, "/cards/1"},
+		{http.MethodGet, "/cards/1/history"},
+		{http.MethodGet, "/cards/1/history/1"},
+		{http.MethodPost, "/cards/1/revert/1"},
+	} {
+		if resp, body := call(t, server, token, step.method, step.path, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s %s: status = %d, body = %s", step.method, step.path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	server := testServer(t)
+	// the handlers read the global database at each request
+	sqlite, err := openDatabase("sqlite", ":memory:", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.(*database.SQLiteDB).Close() })
+	db = sqlite
+	token := testToken(t, server, "alice")
+	if resp, body := call(t, server, token, http.MethodPost, "/cards", `{"title":"milk","text":"buy"}`); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /cards: status = %d, body = %s", resp.StatusCode, body)
+	}
+	resp, body := call(t, server, token, http.MethodGet, "/cards/1", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"title":"milk"`) {
+		t.Errorf("GET /cards/1: status = %d, body = %s", resp.StatusCode, body)
+	}
+	if all := sqlite.AllCards(); len(all) != 1 {
+		t.Errorf("expected the card in sqlite but %v was obtained", all)
+	}
+}
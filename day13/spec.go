@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/openapi"
+	"github.com/cassiobotaro/60-days-of-go/day13/patch"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+	"github.com/gorilla/mux"
+)
+
+// spec is the OpenAPI document of the routes, built once they are registered
+var spec *openapi.Document
+
+// query parameters of the routes
+var (
+	cardFilters = []openapi.Parameter{
+		{Name: "title_prefix", In: "query", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "done", In: "query", Schema: &openapi.Schema{Type: "boolean"}},
+		{Name: "list_id", In: "query", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		{Name: "due_before", In: "query", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+		{Name: "label", In: "query", Description: "label names separated by commas", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "label_op", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{"and", "or"}}},
+		{Name: "sort", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{"id", "title", "-id", "position"}}},
+	}
+	pageParameters = []openapi.Parameter{
+		{Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(database.MaxLimit)}},
+		{Name: "cursor", In: "query", Description: "the cursor of the next or prev link", Schema: &openapi.Schema{Type: "string"}},
+	}
+	formatParameters = []openapi.Parameter{
+		{Name: "format", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{"csv", "json", "ndjson"}}},
+		{Name: "comma", In: "query", Description: "the separator of the csv fields", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "columns", In: "query", Description: "csv headers of the fields, as Header:field,...", Schema: &openapi.Schema{Type: "string"}},
+	}
+	dryRun = openapi.Parameter{Name: "dry_run", In: "query", Schema: &openapi.Schema{Type: "boolean"}}
+)
+
+// labelChanges is the body of PUT /labels/{id}, empty fields are kept
+type labelChanges struct {
+	Name  string `json:"name"`
+	Color string `json:"color" valid:"hexcolor"`
+}
+
+// listChanges is the body of PUT /boards/{id}/lists/{list}, empty fields are kept
+type listChanges struct {
+	Name     string  `json:"name"`
+	Position float64 `json:"position"`
+}
+
+// float is a pointer to a limit of a schema
+func float(f float64) *float64 {
+	return &f
+}
+
+// join concatenates groups of parameters
+func join(groups ...[]openapi.Parameter) []openapi.Parameter {
+	var params []openapi.Parameter
+	for _, group := range groups {
+		params = append(params, group...)
+	}
+	return params
+}
+
+// routeDocs describe the routes by "METHOD template", the routes not
+// described here are still in the document, only with fewer details
+var routeDocs = map[string]openapi.Route{
+	"GET /openapi.json": {Summary: "This document", Response: map[string]interface{}{}, Public: true},
+	"GET /healthz":      {Summary: "The server is running", Response: health{}, Public: true},
+	"GET /readyz":       {Summary: "The server and its database can serve requests", Response: health{}, Public: true},
+
+	"POST /users":    {Summary: "Sign up", Body: credentials{}, Response: cards.User{}, Status: http.StatusCreated, Public: true},
+	"GET /users/me":  {Summary: "The user of the token", Response: cards.User{}},
+	"POST /tokens":   {Summary: "Log in", Body: credentials{}, Response: session{}, Status: http.StatusCreated, Public: true},
+	"DELETE /tokens": {Summary: "Log out", Status: http.StatusNoContent},
+
+	"POST /cards":               {Summary: "Create a card", Body: cards.Card{}, Response: cards.Card{}, Status: http.StatusCreated},
+	"GET /cards":                {Summary: "List the cards", Query: join(cardFilters, pageParameters), Response: cardPage{}},
+	"POST /cards/batch":         {Summary: "Run many operations on cards", Body: batchRequest{}, Response: batchResponse{}},
+	"GET /cards/export":         {Summary: "Export the cards", Query: join(formatParameters, cardFilters), Response: []cards.Card{}},
+	"GET /cards/overdue":        {Summary: "List the cards past due", Query: join(cardFilters, pageParameters), Response: cardPage{}},
+	"GET /cards/events":         {Summary: "Stream the changes of the cards", Produces: "text/event-stream", Response: webhook.Event{}},
+	"GET /cards/{id:[0-9]+}":    {Summary: "Get a card", Response: cards.Card{}},
+	"DELETE /cards/{id:[0-9]+}": {Summary: "Move a card to the trash", Status: http.StatusNoContent},
+	"PUT /cards/{id:[0-9]+}":    {Summary: "Replace a card", Body: cards.Card{}, Response: cards.Card{}},
+	"PATCH /cards/{id:[0-9]+}": {Summary: "Change some fields of a card", Response: cards.Card{}, Accepts: map[string]interface{}{
+		"application/json":   map[string]interface{}{},
+		patch.MergePatchType: map[string]interface{}{},
+		patch.JSONPatchType:  []patch.Operation{},
+	}},
+	"POST /cards/import": {Summary: "Import cards", Query: join(formatParameters, []openapi.Parameter{dryRun}), Response: importReport{}, Status: http.StatusCreated, Accepts: map[string]interface{}{
+		"text/csv":             nil,
+		"application/json":     nil,
+		"application/x-ndjson": nil,
+	}},
+	"GET /cards/{id:[0-9]+}/history":                  {Summary: "List the revisions of a card", Response: []database.Revision{}},
+	"GET /cards/{id:[0-9]+}/history/{rev:[0-9]+}":     {Summary: "Get a revision of a card", Response: database.Revision{}},
+	"POST /cards/{id:[0-9]+}/revert/{rev:[0-9]+}":     {Summary: "Revert a card to a revision", Response: cards.Card{}},
+	"POST /cards/{id:[0-9]+}/move":                    {Summary: "Move a card to a list", Body: move{}, Response: cards.Card{}},
+	"POST /cards/{id:[0-9]+}/labels/{label:[0-9]+}":   {Summary: "Attach a label to a card", Response: cards.Card{}},
+	"DELETE /cards/{id:[0-9]+}/labels/{label:[0-9]+}": {Summary: "Detach a label from a card", Response: cards.Card{}},
+
+	"POST /labels":               {Summary: "Create a label", Body: cards.Label{}, Response: cards.Label{}, Status: http.StatusCreated},
+	"GET /labels":                {Summary: "List the labels", Response: []cards.Label{}},
+	"GET /labels/{id:[0-9]+}":    {Summary: "Get a label", Response: cards.Label{}},
+	"PUT /labels/{id:[0-9]+}":    {Summary: "Rename or paint a label", Body: labelChanges{}, Response: cards.Label{}},
+	"DELETE /labels/{id:[0-9]+}": {Summary: "Delete a label", Status: http.StatusNoContent},
+
+	"POST /boards":                                   {Summary: "Create a board", Body: cards.Board{}, Response: cards.Board{}, Status: http.StatusCreated},
+	"GET /boards":                                    {Summary: "List the boards", Response: []cards.Board{}},
+	"GET /boards/{id:[0-9]+}":                        {Summary: "Get a board", Response: cards.Board{}},
+	"PUT /boards/{id:[0-9]+}":                        {Summary: "Rename a board", Body: cards.Board{}, Response: cards.Board{}},
+	"DELETE /boards/{id:[0-9]+}":                     {Summary: "Delete an empty board", Status: http.StatusNoContent},
+	"POST /boards/{id:[0-9]+}/lists":                 {Summary: "Create a list", Body: cards.List{}, Response: cards.List{}, Status: http.StatusCreated},
+	"GET /boards/{id:[0-9]+}/lists":                  {Summary: "List the lists of a board", Response: []cards.List{}},
+	"GET /boards/{id:[0-9]+}/lists/{list:[0-9]+}":    {Summary: "Get a list", Response: cards.List{}},
+	"PUT /boards/{id:[0-9]+}/lists/{list:[0-9]+}":    {Summary: "Rename or move a list", Body: listChanges{}, Response: cards.List{}},
+	"DELETE /boards/{id:[0-9]+}/lists/{list:[0-9]+}": {Summary: "Delete an empty list", Status: http.StatusNoContent},
+
+	"POST /webhooks":                       {Summary: "Subscribe a webhook", Body: webhookBody{}, Response: webhook.Subscription{}, Status: http.StatusCreated},
+	"GET /webhooks":                        {Summary: "List the webhooks", Response: []webhook.Subscription{}},
+	"GET /webhooks/{id:[0-9]+}":            {Summary: "Get a webhook", Response: webhook.Subscription{}},
+	"PUT /webhooks/{id:[0-9]+}":            {Summary: "Change a webhook", Body: webhookBody{}, Response: webhook.Subscription{}},
+	"DELETE /webhooks/{id:[0-9]+}":         {Summary: "Unsubscribe a webhook", Status: http.StatusNoContent},
+	"GET /webhooks/{id:[0-9]+}/deliveries": {Summary: "List the deliveries of a webhook", Response: []webhook.Delivery{}},
+
+	"GET /trash":                      {Summary: "List the cards in the trash", Response: []cards.Card{}},
+	"DELETE /trash":                   {Summary: "Empty the trash", Response: map[string]int{}},
+	"POST /trash/{id:[0-9]+}/restore": {Summary: "Restore a card from the trash", Response: cards.Card{}},
+	"DELETE /trash/{id:[0-9]+}":       {Summary: "Delete a card for good", Status: http.StatusNoContent},
+}
+
+// describeAPI builds the document of the routes of the router
+func describeAPI(r *mux.Router) (*openapi.Document, error) {
+	doc := openapi.New("cards", "1.0.0")
+	doc.Bearer()
+	if err := doc.AddRouter(r, routeDocs, problem{}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// openAPISpec serves the document of the api
+func openAPISpec(w http.ResponseWriter, r *http.Request) {
+	RenderJSON(w, spec, http.StatusOK)
+}
@@ -0,0 +1,186 @@
+// Package stream sends events to clients as Server-Sent Events.
+// The last events are kept in a ring buffer, so a client that
+// reconnects with Last-Event-ID gets what it missed.
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ResetEvent is sent when the events after Last-Event-ID are no longer
+// buffered, the client has to reload everything it shows
+const ResetEvent = "reset"
+
+// DefaultHeartbeat is how often a comment is sent to keep idle connections open
+const DefaultHeartbeat = 15 * time.Second
+
+// clientBuffer is how many events a client can fall behind before it's dropped
+const clientBuffer = 64
+
+// Event is a message of the stream
+type Event struct {
+	ID   uint64
+	Type string
+	Data []byte
+}
+
+// Broker keeps the last events and fans out the new ones to the clients
+type Broker struct {
+	// Heartbeat is how often idle clients receive a comment
+	Heartbeat time.Duration
+
+	mu      sync.Mutex
+	ring    []Event
+	start   int
+	last    uint64
+	clients map[chan Event]bool
+	closed  bool
+}
+
+// NewBroker returns a broker that buffers the last size events
+func NewBroker(size int) *Broker {
+	return &Broker{
+		Heartbeat: DefaultHeartbeat,
+		ring:      make([]Event, 0, size),
+		clients:   map[chan Event]bool{},
+	}
+}
+
+// Publish adds an event to the buffer and sends it to the clients.
+// A client that is too far behind is disconnected, it can resume
+// from the buffer when it reconnects
+func (b *Broker) Publish(eventType string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last++
+	event := Event{ID: b.last, Type: eventType, Data: data}
+	if len(b.ring) < cap(b.ring) {
+		b.ring = append(b.ring, event)
+	} else if cap(b.ring) > 0 {
+		b.ring[b.start] = event
+		b.start = (b.start + 1) % len(b.ring)
+	}
+	for client := range b.clients {
+		select {
+		case client <- event:
+		default:
+			delete(b.clients, client)
+			close(client)
+		}
+	}
+}
+
+// Close disconnects the clients, they resume from the buffer when they
+// reconnect. Clients that come after Close are disconnected right away
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for client := range b.clients {
+		delete(b.clients, client)
+		close(client)
+	}
+}
+
+// subscribe registers a client. When it resumes, it also returns the
+// buffered events after lastID or, when some of them are gone or the ids
+// started over, a reset event
+func (b *Broker) subscribe(resume bool, lastID uint64) ([]Event, chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var backlog []Event
+	if resume && lastID != b.last {
+		for i := 0; i < len(b.ring); i++ {
+			event := b.ring[(b.start+i)%len(b.ring)]
+			if event.ID > lastID {
+				backlog = append(backlog, event)
+			}
+		}
+		if len(backlog) == 0 || backlog[0].ID != lastID+1 {
+			// the client reloads what it shows, so it goes on from now
+			backlog = []Event{{ID: b.last, Type: ResetEvent, Data: []byte("{}")}}
+		}
+	}
+	client := make(chan Event, clientBuffer)
+	if b.closed {
+		close(client)
+		return backlog, client
+	}
+	b.clients[client] = true
+	return backlog, client
+}
+
+// unsubscribe removes a client, unless it was already dropped
+func (b *Broker) unsubscribe(client chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[client] {
+		delete(b.clients, client)
+		close(client)
+	}
+}
+
+// write sends an event in the text/event-stream format
+func write(w http.ResponseWriter, event Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+// ServeHTTP streams the events until the client goes away.
+// Without Last-Event-ID only the new events are sent
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	var lastID uint64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(resume, 10, 64); err != nil {
+			http.Error(w, "Last-Event-ID must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	backlog, client := b.subscribe(resume != "", lastID)
+	defer b.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range backlog {
+		if err := write(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(b.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, open := <-client:
+			if !open {
+				// too slow or closed, the client reconnects and resumes
+				return
+			}
+			if err := write(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
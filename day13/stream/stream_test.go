@@ -0,0 +1,192 @@
+package stream_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/stream"
+)
+
+// client reads the stream of a broker
+type client struct {
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+// connect opens the stream, resuming after lastID when it's not empty.
+// The client is subscribed when it returns
+func connect(t *testing.T, server *httptest.Server, lastID string) *client {
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	return &client{resp: resp, reader: bufio.NewReader(resp.Body)}
+}
+
+// close hangs up, the server does not close while the stream is open
+func (c *client) close() {
+	c.resp.Body.Close()
+}
+
+// next reads a message, the fields of an event or a comment
+func (c *client) next(t *testing.T) string {
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "|")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func expect(t *testing.T, c *client, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if got := c.next(t); got != w {
+			t.Fatalf("message = %q, want %q", got, w)
+		}
+	}
+}
+
+func TestLiveEvents(t *testing.T) {
+	b := stream.NewBroker(10)
+	server := httptest.NewServer(b)
+	defer server.Close()
+
+	b.Publish("card.created", []byte(`{"id":1}`))
+	c := connect(t, server, "")
+	defer c.close()
+	// only what comes after connecting
+	b.Publish("card.updated", []byte(`{"id":1}`))
+	b.Publish("card.deleted", []byte(`{"id":1}`))
+	expect(t, c,
+		`id: 2|event: card.updated|data: {"id":1}`,
+		`id: 3|event: card.deleted|data: {"id":1}`,
+	)
+}
+
+func TestResume(t *testing.T) {
+	b := stream.NewBroker(3)
+	server := httptest.NewServer(b)
+	defer server.Close()
+
+	for i := 0; i < 5; i++ {
+		b.Publish("card.updated", []byte("{}"))
+	}
+	// 3, 4 and 5 are buffered
+	c := connect(t, server, "2")
+	defer c.close()
+	b.Publish("card.created", []byte("{}"))
+	expect(t, c,
+		"id: 3|event: card.updated|data: {}",
+		"id: 4|event: card.updated|data: {}",
+		"id: 5|event: card.updated|data: {}",
+		"id: 6|event: card.created|data: {}",
+	)
+
+	// up to date
+	c = connect(t, server, "6")
+	defer c.close()
+	b.Publish("card.deleted", []byte("{}"))
+	expect(t, c, "id: 7|event: card.deleted|data: {}")
+
+	// 2 is gone
+	c = connect(t, server, "1")
+	defer c.close()
+	expect(t, c, "id: 7|event: reset|data: {}")
+
+	// ids from before a restart
+	c = connect(t, server, "100")
+	defer c.close()
+	expect(t, c, "id: 7|event: reset|data: {}")
+}
+
+func TestInvalidLastEventID(t *testing.T) {
+	server := httptest.NewServer(stream.NewBroker(1))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	b := stream.NewBroker(1)
+	b.Heartbeat = 10 * time.Millisecond
+	server := httptest.NewServer(b)
+	defer server.Close()
+	c := connect(t, server, "")
+	defer c.close()
+	expect(t, c, ": heartbeat", ": heartbeat")
+}
+
+func TestSlowClientIsDropped(t *testing.T) {
+	b := stream.NewBroker(1000)
+	server := httptest.NewServer(b)
+	defer server.Close()
+	c := connect(t, server, "")
+	defer c.close()
+	// nobody reads, the client falls behind and its stream ends
+	// once what was written before dropping it is read
+	for i := 0; i < 1000; i++ {
+		b.Publish("card.updated", []byte(strings.Repeat("x", 64*1024)))
+	}
+	read := 0
+	for {
+		if _, err := c.reader.ReadString('\n'); err != nil {
+			break
+		}
+		read++
+	}
+	if read >= 1000*4 {
+		t.Fatalf("read %d lines, the client was not dropped", read)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := stream.NewBroker(10)
+	server := httptest.NewServer(b)
+	defer server.Close()
+	c := connect(t, server, "")
+	defer c.close()
+	b.Publish("card.created", []byte("{}"))
+	expect(t, c, "id: 1|event: card.created|data: {}")
+	b.Close()
+	if _, err := c.reader.ReadString('\n'); err == nil {
+		t.Fatal("the stream is still open")
+	}
+	// a client that resumes after Close is disconnected too
+	late := connect(t, server, "1")
+	defer late.close()
+	if _, err := late.reader.ReadString('\n'); err == nil {
+		t.Fatal("the stream of a late client is open")
+	}
+}
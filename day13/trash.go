@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+	"github.com/gorilla/mux"
+)
+
+func listTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := store(r).TrashedCards()
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, trash, http.StatusOK)
+}
+
+func restoreCard(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	card, err := store(r).RestoreCard(id)
+	switch err {
+	case database.ErrCardNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case nil:
+		setETag(w, card)
+		RenderJSON(w, card, http.StatusOK)
+		publish(webhook.EventRestored, card)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func purgeCard(w http.ResponseWriter, r *http.Request) {
+	// Get the id from path
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		renderError(w, errInvalidID, http.StatusBadRequest)
+		return
+	}
+	// the card as it was is sent to the webhooks
+	purged := &cards.Card{ID: id}
+	if trash, err := store(r).TrashedCards(); err == nil {
+		for _, card := range trash {
+			if card.ID == id {
+				purged = card
+			}
+		}
+	}
+	err = store(r).PurgeCard(id)
+	switch err {
+	case database.ErrCardNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+		publish(webhook.EventPurged, purged)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func emptyTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := store(r).PurgeTrash(time.Now())
+	if err != nil {
+		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, map[string]int{"purged": purged}, http.StatusOK)
+}
+
+// sweepTrash purges, every interval, the cards that are in the
+// trash for longer than retention. It returns when ctx is done
+func sweepTrash(ctx context.Context, db database.Database, retention, interval time.Duration) {
+	sweeper := db.As("trash sweeper")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		purged, err := sweeper.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("trash sweeper:", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("trash sweeper: %d cards purged", purged)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/database"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+)
+
+func TestSweepTrash(t *testing.T) {
+	memory := database.NewMemoryDB()
+	for _, title := range []string{"old", "new"} {
+		if err := memory.CreateCard(&cards.Card{Title: title, Text: "text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	memory.RemoveCard(1, 0)
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan bool)
+	go func() {
+		sweepTrash(ctx, memory, 0, 10*time.Millisecond)
+		stopped <- true
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		trash, _ := memory.TrashedCards()
+		if len(trash) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the trash was not swept")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if history, err := memory.CardHistory(1); err != nil || history[len(history)-1].Author != "trash sweeper" {
+		t.Errorf("history = %v, err = %v", history, err)
+	}
+
+	stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the sweeper did not stop")
+	}
+	// nothing is swept once it stopped
+	memory.RemoveCard(2, 0)
+	time.Sleep(30 * time.Millisecond)
+	if trash, _ := memory.TrashedCards(); len(trash) != 1 {
+		t.Errorf("trash = %v", trash)
+	}
+}
+
+// trashIDs lists the ids of the cards in the trash of token
+func trashIDs(t *testing.T, server *httptest.Server, token string) string {
+	t.Helper()
+	resp, body := call(t, server, token, http.MethodGet, "/trash", "")
+	trash := []*cards.Card{}
+	if err := json.Unmarshal(body, &trash); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /trash: status = %d, body = %s", resp.StatusCode, body)
+	}
+	ids := ""
+	for _, card := range trash {
+		if card.DeletedAt == nil {
+			t.Errorf("card %d has no deleted_at", card.ID)
+		}
+		ids += strconv.FormatInt(card.ID, 10)
+	}
+	return ids
+}
+
+func TestTrash(t *testing.T) {
+	server := testServer(t)
+	alice, bob := testToken(t, server, "alice"), testToken(t, server, "bob")
+	createCards(t, server, alice, "a", "b", "c", "d")
+	createCards(t, server, bob, "e")
+	for _, path := range []string{"/cards/3", "/cards/1", "/cards/2"} {
+		if resp, body := call(t, server, alice, http.MethodDelete, path, ""); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE %s: status = %d, body = %s", path, resp.StatusCode, body)
+		}
+	}
+	call(t, server, bob, http.MethodDelete, "/cards/5", "")
+	if ids := trashIDs(t, server, alice); ids != "312" {
+		t.Fatalf("expected cards 3, 1 and 2 in the order they were deleted but %s was obtained", ids)
+	}
+	if resp, body := call(t, server, alice, http.MethodGet, "/cards/1", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a trashed card was found: status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	for _, test := range []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+		// trash is what is left in the trash of alice
+		trash string
+	}{
+		{"restore", alice, http.MethodPost, "/trash/1/restore", http.StatusOK, "32"},
+		{"restore of a live card", alice, http.MethodPost, "/trash/1/restore", http.StatusNotFound, "32"},
+		{"restore of a card of another user", bob, http.MethodPost, "/trash/3/restore", http.StatusNotFound, "32"},
+		{"purge", alice, http.MethodDelete, "/trash/3", http.StatusNoContent, "2"},
+		{"purge of a purged card", alice, http.MethodDelete, "/trash/3", http.StatusNotFound, "2"},
+		{"purge of a live card", alice, http.MethodDelete, "/trash/4", http.StatusNotFound, "2"},
+		{"purge of a card of another user", bob, http.MethodDelete, "/trash/2", http.StatusNotFound, "2"},
+		{"empty the trash", alice, http.MethodDelete, "/trash", http.StatusOK, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := call(t, server, test.token, test.method, test.path, "")
+			if resp.StatusCode != test.status {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			if ids := trashIDs(t, server, alice); ids != test.trash {
+				t.Errorf("expected %q in the trash but %q was obtained", test.trash, ids)
+			}
+		})
+	}
+
+	// the restored card is back as it was, in a new version
+	resp, body := call(t, server, alice, http.MethodGet, "/cards/1", "")
+	card := cards.Card{}
+	if err := json.Unmarshal(body, &card); err != nil || card.Title != "a" || card.DeletedAt != nil || resp.Header.Get("ETag") != strconv.Quote(strconv.FormatInt(card.Version, 10)) {
+		t.Errorf("status = %d, ETag = %q, body = %s", resp.StatusCode, resp.Header.Get("ETag"), body)
+	}
+	if pages := listTitles(t, server, alice, "/cards"); pages[0] != "a d" {
+		t.Errorf("expected cards a and d but %q was obtained", pages)
+	}
+	// the trash of bob is left alone
+	if ids := trashIDs(t, server, bob); ids != "5" {
+		t.Errorf("expected card 5 in the trash of bob but %q was obtained", ids)
+	}
+}
+
+func TestTrashEvents(t *testing.T) {
+	server := testServer(t)
+	token := testToken(t, server, "alice")
+	createCards(t, server, token, "milk")
+	for _, step := range []struct{ method, path string }{
+		{http.MethodDelete, "/cards/1"},
+		{http.MethodPost, "/trash/1/restore"},
+		{http.MethodDelete, "/cards/1"},
+		{http.MethodDelete, "/trash/1"},
+	} {
+		if resp, body := call(t, server, token, step.method, step.path, ""); resp.StatusCode >= http.StatusBadRequest {
+			t.Fatalf("%s %s: status = %d, body = %s", step.method, step.path, resp.StatusCode, body)
+		}
+	}
+
+	// the stream replays what it keeps from the first event on
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/cards/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	expected := []string{webhook.EventCreated, webhook.EventDeleted, webhook.EventRestored, webhook.EventDeleted, webhook.EventPurged}
+	var obtained []string
+	lines := bufio.NewScanner(resp.Body)
+	for len(obtained) < len(expected) && lines.Scan() {
+		if event := strings.TrimPrefix(lines.Text(), "event: "); event != lines.Text() {
+			obtained = append(obtained, event)
+		}
+	}
+	if strings.Join(obtained, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected events %v but %v was obtained", expected, obtained)
+	}
+}
@@ -0,0 +1,556 @@
+// Package webhook delivers card events to the urls subscribed to them.
+// Deliveries are queued and sent in the background, retried with
+// exponential backoff and signed with HMAC-SHA256.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+)
+
+// events sent to subscriptions
+const (
+	EventCreated   = "card.created"
+	EventUpdated   = "card.updated"
+	EventCompleted = "card.completed"
+	EventDeleted   = "card.deleted"
+	EventRestored  = "card.restored"
+	EventPurged    = "card.purged"
+	EventReminder  = "card.reminder"
+)
+
+// Events are every event that can be subscribed
+var Events = []string{EventCreated, EventUpdated, EventCompleted, EventDeleted, EventRestored, EventPurged, EventReminder}
+
+// headers of a delivery
+const (
+	SignatureHeader = "X-Cards-Signature-256"
+	EventHeader     = "X-Cards-Event"
+	DeliveryHeader  = "X-Cards-Delivery"
+)
+
+var (
+	// ErrSubscriptionNotFound raised when a subscription is not found
+	ErrSubscriptionNotFound = errors.New("webhook not found")
+	// ErrInvalidURL raised when the url is not absolute http or https
+	ErrInvalidURL = errors.New("url must be an absolute http or https url")
+	// ErrUnknownEvent raised when subscribing to an event that does not exist
+	ErrUnknownEvent = errors.New("unknown event")
+	// ErrMissingSecret raised when a subscription has no secret
+	ErrMissingSecret = errors.New("secret is required")
+	// ErrPrivateAddress is the error of the deliveries to a loopback,
+	// link-local or private address, which the default client refuses
+	ErrPrivateAddress = errors.New("private address refused")
+)
+
+// Subscription sends the events it's subscribed to to URL
+type Subscription struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Events filters the events sent, empty sends every event
+	Events []string `json:"events"`
+	// Secret signs the deliveries, it's never shown
+	Secret string `json:"-"`
+	// Active is cleared after DisableAfter failed deliveries in a row
+	Active bool `json:"active"`
+	// Failures are the failed deliveries in a row
+	Failures int `json:"failures"`
+	// Owner is the user whose cards are sent, zero sends every card
+	Owner int64 `json:"owner_id,omitempty"`
+}
+
+// Event is something that happened to a card
+type Event struct {
+	Type string      `json:"type"`
+	At   time.Time   `json:"at"`
+	Card *cards.Card `json:"card"`
+}
+
+// Delivery is an attempt to send an event to a subscription
+type Delivery struct {
+	ID             int64     `json:"id"`
+	SubscriptionID int64     `json:"webhook_id"`
+	Event          string    `json:"event"`
+	Attempt        int       `json:"attempt"`
+	At             time.Time `json:"at"`
+	// StatusCode is the response status, zero when there was no response
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+}
+
+// Options configure a Dispatcher, zero values use the defaults
+type Options struct {
+	// Workers send the deliveries, 4 by default
+	Workers int
+	// QueueSize is how many deliveries wait for a worker, 1000 by default
+	QueueSize int
+	// MaxAttempts a delivery is tried, 5 by default
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled on each
+	// retry up to MaxBackoff. 1s and 5m by default
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// DisableAfter failed deliveries in a row deactivate the
+	// subscription, 10 by default
+	DisableAfter int
+	// KeepDeliveries is how many attempts are kept in the log of each
+	// subscription, 100 by default
+	KeepDeliveries int
+	// Client sends the requests, a client with a 10s timeout by default.
+	// The default client refuses to connect to loopback, link-local and
+	// private addresses, so a subscription can't reach the network of
+	// the server, unless AllowPrivate is set. A Client given is used as is
+	Client       *http.Client
+	AllowPrivate bool
+}
+
+// withDefaults fills the zero options
+func (o Options) withDefaults() Options {
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1000
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	if o.DisableAfter <= 0 {
+		o.DisableAfter = 10
+	}
+	if o.KeepDeliveries <= 0 {
+		o.KeepDeliveries = 100
+	}
+	if o.Client == nil {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		if !o.AllowPrivate {
+			dialer.Control = refusePrivate
+		}
+		o.Client = &http.Client{
+			Timeout: 10 * time.Second,
+			// no proxy, it would connect to the addresses for us
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		}
+	}
+	return o
+}
+
+// refusePrivate is the control of the dialer of the default client. It
+// runs once the host is resolved, on the address about to be
+// connected, so a name resolving to a private address is refused too
+func refusePrivate(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// job is an event waiting to be sent to a subscription
+type job struct {
+	subscription int64
+	delivery     int64
+	event        string
+	body         []byte
+	attempt      int
+}
+
+// Dispatcher keeps the subscriptions in memory and delivers the events
+// published to them. It's safe for concurrent use.
+type Dispatcher struct {
+	options Options
+
+	mu            sync.Mutex
+	subscriptions []*Subscription
+	index         int64
+	deliveries    map[int64][]*Delivery
+	lastDelivery  int64
+
+	queue chan *job
+	// queued are the jobs in the queue or being sent
+	queued atomic.Int64
+	stop   chan struct{}
+	closed sync.Once
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher starts the workers of a dispatcher
+func NewDispatcher(options Options) *Dispatcher {
+	d := &Dispatcher{
+		options:       options.withDefaults(),
+		subscriptions: []*Subscription{},
+		deliveries:    map[int64][]*Delivery{},
+		stop:          make(chan struct{}),
+	}
+	d.queue = make(chan *job, d.options.QueueSize)
+	for i := 0; i < d.options.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Close stops the workers once they send the deliveries they are
+// sending, the queued deliveries and the retries still waiting are dropped
+func (d *Dispatcher) Close() {
+	d.closed.Do(func() { close(d.stop) })
+	d.wg.Wait()
+}
+
+// Shutdown sends the queued deliveries, waiting until they are sent or
+// ctx is done, then closes the dispatcher. Delivery is best effort: the
+// retries waiting for their backoff are dropped, as are the deliveries
+// still queued when ctx is done, whose error is returned
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	defer d.Close()
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for d.queued.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature of a body, as sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells if signature is the one of body, in constant time
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// validate checks a subscription
+func validate(s *Subscription) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	for _, event := range s.Events {
+		if !known(event) {
+			return ErrUnknownEvent
+		}
+	}
+	if s.Secret == "" {
+		return ErrMissingSecret
+	}
+	return nil
+}
+
+// known tells if the event exists
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// wants tells if the subscription is sent the event
+func (s *Subscription) wants(event Event) bool {
+	if !s.Active {
+		return false
+	}
+	if s.Owner != 0 && (event.Card == nil || event.Card.OwnerID != s.Owner) {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the position of a subscription, -1 when not found.
+// Callers must hold the lock
+func (d *Dispatcher) find(id int64) (int, *Subscription) {
+	for index, s := range d.subscriptions {
+		if s.ID == id {
+			return index, s
+		}
+	}
+	return -1, nil
+}
+
+// Subscribe adds an active subscription
+func (d *Dispatcher) Subscribe(s *Subscription) error {
+	if err := validate(s); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.index++
+	created := *s
+	created.ID = d.index
+	created.Active = true
+	created.Failures = 0
+	if created.Events == nil {
+		created.Events = []string{}
+	}
+	d.subscriptions = append(d.subscriptions, &created)
+	*s = created
+	return nil
+}
+
+// Subscriptions returns every subscription
+func (d *Dispatcher) Subscriptions() []*Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	subscriptions := make([]*Subscription, 0, len(d.subscriptions))
+	for _, s := range d.subscriptions {
+		c := *s
+		subscriptions = append(subscriptions, &c)
+	}
+	return subscriptions
+}
+
+// Subscription retrieves a subscription
+func (d *Dispatcher) Subscription(id int64) (*Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, s := d.find(id)
+	if s == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	c := *s
+	return &c, nil
+}
+
+// Update replaces url, events, secret and active of a subscription,
+// an empty secret keeps the old one. Activating it again clears the failures
+func (d *Dispatcher) Update(new *Subscription) (*Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, s := d.find(new.ID)
+	if s == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	updated := *new
+	if updated.Secret == "" {
+		updated.Secret = s.Secret
+	}
+	if err := validate(&updated); err != nil {
+		return nil, err
+	}
+	if updated.Events == nil {
+		updated.Events = []string{}
+	}
+	new = &updated
+	if new.Active && !s.Active {
+		s.Failures = 0
+	}
+	s.URL, s.Events, s.Secret, s.Active = new.URL, new.Events, new.Secret, new.Active
+	c := *s
+	return &c, nil
+}
+
+// Unsubscribe removes a subscription and its deliveries
+func (d *Dispatcher) Unsubscribe(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	index, _ := d.find(id)
+	if index < 0 {
+		return ErrSubscriptionNotFound
+	}
+	d.subscriptions = append(d.subscriptions[:index], d.subscriptions[index+1:]...)
+	delete(d.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the last attempts to deliver to a subscription,
+// the newest first
+func (d *Dispatcher) Deliveries(id int64) ([]*Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, s := d.find(id); s == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	log := d.deliveries[id]
+	deliveries := make([]*Delivery, 0, len(log))
+	for i := len(log) - 1; i >= 0; i-- {
+		c := *log[i]
+		deliveries = append(deliveries, &c)
+	}
+	return deliveries, nil
+}
+
+// Publish queues the event to every active subscription that wants it,
+// it never blocks. When the queue is full the delivery fails right away
+func (d *Dispatcher) Publish(event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	jobs := []*job{}
+	for _, s := range d.subscriptions {
+		if s.wants(event) {
+			d.lastDelivery++
+			jobs = append(jobs, &job{subscription: s.ID, delivery: d.lastDelivery, event: event.Type, body: body, attempt: 1})
+		}
+	}
+	d.mu.Unlock()
+	for _, j := range jobs {
+		d.queued.Add(1)
+		select {
+		case d.queue <- j:
+		default:
+			d.queued.Add(-1)
+			d.finish(j, &Delivery{Error: "delivery queue is full"})
+		}
+	}
+}
+
+// work sends the queued deliveries until the dispatcher is closed
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case j := <-d.queue:
+			d.send(j)
+			d.queued.Add(-1)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// send tries a delivery once
+func (d *Dispatcher) send(j *job) {
+	d.mu.Lock()
+	_, s := d.find(j.subscription)
+	if s == nil || !s.Active {
+		// removed or disabled while waiting
+		d.mu.Unlock()
+		return
+	}
+	target, secret := s.URL, s.Secret
+	d.mu.Unlock()
+
+	delivery := &Delivery{}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(j.body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, j.event)
+		req.Header.Set(DeliveryHeader, strconv.FormatInt(j.delivery, 10))
+		req.Header.Set(SignatureHeader, Sign(secret, j.body))
+		var resp *http.Response
+		resp, err = d.options.Client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			delivery.StatusCode = resp.StatusCode
+			delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+		}
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if !delivery.Success && j.attempt < d.options.MaxAttempts {
+		d.record(j, delivery)
+		retry := *j
+		retry.attempt++
+		time.AfterFunc(d.backoff(j.attempt), func() {
+			d.queued.Add(1)
+			select {
+			case d.queue <- &retry:
+			case <-d.stop:
+				d.queued.Add(-1)
+			}
+		})
+		return
+	}
+	d.finish(j, delivery)
+}
+
+// backoff is the wait after a failed attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.options.Backoff
+	for i := 1; i < attempt && wait < d.options.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.options.MaxBackoff {
+		wait = d.options.MaxBackoff
+	}
+	return wait
+}
+
+// record adds an attempt to the delivery log
+func (d *Dispatcher) record(j *job, delivery *Delivery) {
+	delivery.ID = j.delivery
+	delivery.SubscriptionID = j.subscription
+	delivery.Event = j.event
+	delivery.Attempt = j.attempt
+	delivery.At = time.Now().UTC()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, s := d.find(j.subscription); s == nil {
+		return
+	}
+	log := append(d.deliveries[j.subscription], delivery)
+	if len(log) > d.options.KeepDeliveries {
+		log = log[len(log)-d.options.KeepDeliveries:]
+	}
+	d.deliveries[j.subscription] = log
+}
+
+// finish records the last attempt of a delivery, counting the failures
+func (d *Dispatcher) finish(j *job, delivery *Delivery) {
+	d.record(j, delivery)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, s := d.find(j.subscription)
+	if s == nil {
+		return
+	}
+	if delivery.Success {
+		s.Failures = 0
+		return
+	}
+	s.Failures++
+	if s.Failures >= d.options.DisableAfter {
+		s.Active = false
+	}
+}
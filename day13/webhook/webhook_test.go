@@ -0,0 +1,291 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/cards"
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+)
+
+// receiver records the requests and answers them with the statuses given,
+// the last one is repeated
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+// eventually waits for the condition or fails the test
+func eventually(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// setup starts a receiver and a dispatcher with fast retries
+func setup(t *testing.T, statuses ...int) (*receiver, *httptest.Server, *webhook.Dispatcher) {
+	rc := &receiver{statuses: statuses}
+	server := httptest.NewServer(rc)
+	d := webhook.NewDispatcher(webhook.Options{
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		DisableAfter: 2,
+		Client:       server.Client(),
+	})
+	t.Cleanup(func() {
+		d.Close()
+		server.Close()
+	})
+	return rc, server, d
+}
+
+func TestSignedDelivery(t *testing.T) {
+	rc, server, d := setup(t, http.StatusOK)
+	s := &webhook.Subscription{URL: server.URL, Events: []string{webhook.EventCreated}, Secret: "s3cret"}
+	if err := d.Subscribe(s); err != nil {
+		t.Fatal(err)
+	}
+	// filtered out
+	d.Publish(webhook.Event{Type: webhook.EventDeleted, Card: &cards.Card{ID: 1}})
+	d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 2, Title: "title"}})
+	eventually(t, "the delivery", func() bool { return rc.received() == 1 })
+
+	rc.mu.Lock()
+	r, body := rc.requests[0], rc.bodies[0]
+	rc.mu.Unlock()
+	if r.Header.Get(webhook.EventHeader) != webhook.EventCreated {
+		t.Errorf("expected event %s but %s was obtained", webhook.EventCreated, r.Header.Get(webhook.EventHeader))
+	}
+	if !webhook.Verify("s3cret", body, r.Header.Get(webhook.SignatureHeader)) {
+		t.Errorf("signature %s does not match the body", r.Header.Get(webhook.SignatureHeader))
+	}
+	if webhook.Verify("other", body, r.Header.Get(webhook.SignatureHeader)) {
+		t.Error("signature matches another secret")
+	}
+	event := webhook.Event{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != webhook.EventCreated || event.Card.ID != 2 || event.At.IsZero() {
+		t.Errorf("expected the created event of card 2 but %+v was obtained", event)
+	}
+	eventually(t, "the delivery log", func() bool {
+		deliveries, _ := d.Deliveries(s.ID)
+		return len(deliveries) == 1 && deliveries[0].Success && deliveries[0].StatusCode == http.StatusOK
+	})
+}
+
+func TestOwnerFilter(t *testing.T) {
+	rc, server, d := setup(t, http.StatusOK)
+	s := &webhook.Subscription{URL: server.URL, Secret: "s3cret", Owner: 1}
+	if err := d.Subscribe(s); err != nil {
+		t.Fatal(err)
+	}
+	// the card of another user is not sent
+	d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 1, OwnerID: 2}})
+	d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 2, OwnerID: 1}})
+	eventually(t, "the delivery", func() bool { return rc.received() == 1 })
+	time.Sleep(20 * time.Millisecond)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	event := webhook.Event{}
+	if err := json.Unmarshal(rc.bodies[0], &event); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.requests) != 1 || event.Card.ID != 2 {
+		t.Errorf("expected only card 2 but %d deliveries were obtained, the first of card %d", len(rc.requests), event.Card.ID)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	rc, server, d := setup(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent)
+	s := &webhook.Subscription{URL: server.URL, Secret: "s3cret"}
+	if err := d.Subscribe(s); err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(webhook.Event{Type: webhook.EventUpdated, Card: &cards.Card{ID: 1}})
+	eventually(t, "three attempts", func() bool {
+		deliveries, _ := d.Deliveries(s.ID)
+		return len(deliveries) == 3
+	})
+	deliveries, _ := d.Deliveries(s.ID)
+	// newest first
+	if !deliveries[0].Success || deliveries[0].Attempt != 3 || deliveries[2].StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected two failures and a success but %+v, %+v, %+v was obtained", deliveries[2], deliveries[1], deliveries[0])
+	}
+	if deliveries[0].ID != deliveries[2].ID {
+		t.Errorf("expected attempts of the same delivery but %d and %d were obtained", deliveries[2].ID, deliveries[0].ID)
+	}
+	if got, _ := d.Subscription(s.ID); !got.Active || got.Failures != 0 {
+		t.Errorf("expected an active subscription without failures but %+v was obtained", got)
+	}
+	if rc.received() != 3 {
+		t.Errorf("expected 3 requests but %d were obtained", rc.received())
+	}
+}
+
+func TestAutoDisable(t *testing.T) {
+	rc, server, d := setup(t, http.StatusInternalServerError)
+	s := &webhook.Subscription{URL: server.URL, Secret: "s3cret"}
+	if err := d.Subscribe(s); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: int64(i)}})
+	}
+	eventually(t, "the subscription to be disabled", func() bool {
+		got, _ := d.Subscription(s.ID)
+		return !got.Active
+	})
+	got, _ := d.Subscription(s.ID)
+	if got.Failures != 2 {
+		t.Errorf("expected 2 failures but %d was obtained", got.Failures)
+	}
+	received := rc.received()
+	if received != 6 {
+		t.Errorf("expected 3 attempts of 2 deliveries but %d requests were obtained", received)
+	}
+	d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 3}})
+	time.Sleep(20 * time.Millisecond)
+	if rc.received() != received {
+		t.Error("expected nothing sent to a disabled subscription")
+	}
+
+	// activating again clears the failures
+	got.Active = true
+	if got, _ = d.Update(got); !got.Active || got.Failures != 0 {
+		t.Errorf("expected an active subscription without failures but %+v was obtained", got)
+	}
+}
+
+func TestSubscribeValidation(t *testing.T) {
+	d := webhook.NewDispatcher(webhook.Options{})
+	defer d.Close()
+	table := []struct {
+		subscription webhook.Subscription
+		expected     error
+	}{
+		{webhook.Subscription{URL: "ftp://example.com", Secret: "s"}, webhook.ErrInvalidURL},
+		{webhook.Subscription{URL: "/relative", Secret: "s"}, webhook.ErrInvalidURL},
+		{webhook.Subscription{URL: "http://example.com", Events: []string{"card.eaten"}, Secret: "s"}, webhook.ErrUnknownEvent},
+		{webhook.Subscription{URL: "http://example.com"}, webhook.ErrMissingSecret},
+		{webhook.Subscription{URL: "https://example.com/hook", Events: []string{webhook.EventDeleted}, Secret: "s"}, nil},
+	}
+	for _, data := range table {
+		if err := d.Subscribe(&data.subscription); err != data.expected {
+			t.Errorf("%+v: expected %v but %v was obtained", data.subscription, data.expected, err)
+		}
+	}
+	if _, err := d.Deliveries(100); err != webhook.ErrSubscriptionNotFound {
+		t.Errorf("expected %v but %v was obtained", webhook.ErrSubscriptionNotFound, err)
+	}
+}
+
+func TestPrivateAddresses(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	for _, test := range []struct {
+		name         string
+		allowPrivate bool
+		success      bool
+	}{
+		{"refused", false, false},
+		{"allowed", true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// the default client, the receiver listens on loopback
+			d := webhook.NewDispatcher(webhook.Options{MaxAttempts: 1, AllowPrivate: test.allowPrivate})
+			defer d.Close()
+			s := &webhook.Subscription{URL: server.URL, Secret: "s3cret"}
+			if err := d.Subscribe(s); err != nil {
+				t.Fatal(err)
+			}
+			d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 1}})
+			var deliveries []*webhook.Delivery
+			eventually(t, "the delivery log", func() bool {
+				deliveries, _ = d.Deliveries(s.ID)
+				return len(deliveries) == 1
+			})
+			refused := strings.Contains(deliveries[0].Error, webhook.ErrPrivateAddress.Error())
+			if deliveries[0].Success != test.success || refused == test.success {
+				t.Errorf("expected success %v but %+v was obtained", test.success, deliveries[0])
+			}
+		})
+	}
+	if rc.received() != 1 {
+		t.Errorf("expected only the allowed delivery but %d were received", rc.received())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	rc, server, d := setup(t, http.StatusOK)
+	s := &webhook.Subscription{URL: server.URL, Secret: "s3cret"}
+	if err := d.Subscribe(s); err != nil {
+		t.Fatal(err)
+	}
+	for id := int64(1); id <= 20; id++ {
+		d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: id}})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rc.received() != 20 {
+		t.Errorf("expected the 20 queued deliveries sent but %d were received", rc.received())
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	d := webhook.NewDispatcher(webhook.Options{Workers: 1, Client: server.Client()})
+	if err := d.Subscribe(&webhook.Subscription{URL: server.URL, Secret: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 1}})
+	d.Publish(webhook.Event{Type: webhook.EventCreated, Card: &cards.Card{ID: 2}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// the delivery being sent finishes, the queued one is dropped
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	if err := d.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v but %v was obtained", context.DeadlineExceeded, err)
+	}
+}
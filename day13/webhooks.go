@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cassiobotaro/60-days-of-go/day13/webhook"
+	"github.com/gorilla/mux"
+)
+
+// webhookBody is the body of POST and PUT /webhooks
+type webhookBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	// Active is kept when omitted
+	Active *bool `json:"active"`
+}
+
+// renderWebhookError maps the errors of webhooks to a status
+func renderWebhookError(w http.ResponseWriter, err error) {
+	switch err {
+	case webhook.ErrSubscriptionNotFound:
+		renderError(w, err, http.StatusNotFound)
+	case webhook.ErrInvalidURL, webhook.ErrUnknownEvent, webhook.ErrMissingSecret:
+		renderError(w, err, http.StatusBadRequest)
+	default:
+		renderError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// userWebhook reads the webhook in path, only when it belongs to the user
+func userWebhook(r *http.Request) (*webhook.Subscription, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	s, err := hooks.Subscription(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Owner != currentUser(r).ID {
+		return nil, webhook.ErrSubscriptionNotFound
+	}
+	return s, nil
+}
+
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	body := webhookBody{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		// STATUS 422 - Unprocessable entity
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	s := &webhook.Subscription{URL: body.URL, Events: body.Events, Secret: body.Secret, Owner: currentUser(r).ID}
+	if err = hooks.Subscribe(s); err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	RenderJSON(w, s, http.StatusCreated)
+}
+
+func allWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions := []*webhook.Subscription{}
+	for _, s := range hooks.Subscriptions() {
+		if s.Owner == currentUser(r).ID {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	RenderJSON(w, subscriptions, http.StatusOK)
+}
+
+func getWebhook(w http.ResponseWriter, r *http.Request) {
+	s, err := userWebhook(r)
+	if err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	RenderJSON(w, s, http.StatusOK)
+}
+
+// updateWebhook replaces a webhook, "active": true turns a disabled one on
+func updateWebhook(w http.ResponseWriter, r *http.Request) {
+	body := webhookBody{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		renderError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	s, err := userWebhook(r)
+	if err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	s.URL, s.Events, s.Secret = body.URL, body.Events, body.Secret
+	if body.Active != nil {
+		s.Active = *body.Active
+	}
+	if s, err = hooks.Update(s); err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	RenderJSON(w, s, http.StatusOK)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	s, err := userWebhook(r)
+	if err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	if err = hooks.Unsubscribe(s.ID); err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	s, err := userWebhook(r)
+	if err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	deliveries, err := hooks.Deliveries(s.ID)
+	if err != nil {
+		renderWebhookError(w, err)
+		return
+	}
+	RenderJSON(w, deliveries, http.StatusOK)
+}
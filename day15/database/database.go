@@ -10,7 +10,17 @@ var db *sqlx.DB
 
 // MustConnect initialize the database in memory
 func MustConnect() {
-	db = sqlx.MustConnect("sqlite3", ":memory:")
+	MustConnectTo(":memory:")
+}
+
+// MustConnectTo initialize the database from a file path or ":memory:"
+func MustConnectTo(dsn string) {
+	db = sqlx.MustConnect("sqlite3", dsn)
+	// every connection to ":memory:" opens a brand new database,
+	// so keep only one connection in the pool
+	if dsn == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
 }
 
 // Get returns the database connection
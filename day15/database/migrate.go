@@ -0,0 +1,208 @@
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationsTable keeps track of which migrations were applied
+const migrationsTable = `
+create table if not exists schema_migrations (
+	version integer not null primary key,
+	name text not null,
+	applied_at timestamp not null
+);
+`
+
+// migration files are named like 0001_create_foo.up.sql and 0001_create_foo.down.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered change on the schema
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells if a migration was applied and when
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the migrations from a directory or an embedded FS.
+// Use os.DirFS("migrations") for a directory.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		matches := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations on a database
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator for the given migrations
+func NewMigrator(db *sqlx.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// applied returns when each applied version was applied
+func (m *Migrator) applied() (map[int64]time.Time, error) {
+	if _, err := m.db.Exec(migrationsTable); err != nil {
+		return nil, err
+	}
+	rows := []struct {
+		Version   int64     `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}{}
+	err := m.db.Select(&rows, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	versions := map[int64]time.Time{}
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+	return versions, nil
+}
+
+// Status lists every known migration and if it was applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := versions[migration.Version]
+		status = append(status, MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return status, nil
+}
+
+// Up applies every pending migration, each one inside a transaction.
+// Returns the migrations that were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, migration := range m.migrations {
+		if _, ok := versions[migration.Version]; ok {
+			continue
+		}
+		err = m.run(migration.Up, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(
+				"insert into schema_migrations (version, name, applied_at) values (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC(),
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last n applied migrations, each one inside a transaction.
+// Returns the migrations that were reverted.
+func (m *Migrator) Down(n int) ([]Migration, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		migration := m.migrations[i]
+		if _, ok := versions[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return done, fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+		err = m.run(migration.Down, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("delete from schema_migrations where version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// run executes a statement and the bookkeeping in the same transaction
+func (m *Migrator) run(stmt string, bookkeeping func(tx *sqlx.Tx) error) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = bookkeeping(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
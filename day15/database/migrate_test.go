@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// testMigrations has two versions, the second one depends on the first
+var testMigrations = fstest.MapFS{
+	"0001_create_foo.up.sql":   {Data: []byte("create table foo (id integer not null primary key, name text);")},
+	"0001_create_foo.down.sql": {Data: []byte("drop table foo;")},
+	"0002_add_age.up.sql":      {Data: []byte("alter table foo add column age integer;")},
+	"0002_add_age.down.sql":    {Data: []byte("create table foo2 (id integer not null primary key, name text); drop table foo; alter table foo2 rename to foo;")},
+	"README.md":                {Data: []byte("ignored")},
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations but %d was obtained", len(migrations))
+	}
+	for i, name := range []string{"create_foo", "add_age"} {
+		if migrations[i].Version != int64(i+1) || migrations[i].Name != name {
+			t.Errorf("expected %d_%s but %d_%s was obtained", i+1, name, migrations[i].Version, migrations[i].Name)
+		}
+	}
+}
+
+func TestLoadMigrationsWithoutUp(t *testing.T) {
+	fsys := fstest.MapFS{"0001_create_foo.down.sql": {Data: []byte("drop table foo;")}}
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Error("expected an error when the up file is missing")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	MustConnect()
+	migrations, err := LoadMigrations(testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := NewMigrator(Get(), migrations)
+
+	applied, err := migrator.Up()
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("expected 2 migrations applied but %d was obtained (%v)", len(applied), err)
+	}
+	if _, err = Get().Exec("insert into foo (id, name, age) values (1, 'foo', 26)"); err != nil {
+		t.Fatal(err)
+	}
+	// nothing pending, nothing to do
+	if applied, _ = migrator.Up(); len(applied) != 0 {
+		t.Errorf("expected no migrations applied but %d was obtained", len(applied))
+	}
+
+	reverted, err := migrator.Down(1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("expected version 2 reverted but %v was obtained (%v)", reverted, err)
+	}
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status[0].Applied || status[1].Applied {
+		t.Errorf("expected only version 1 applied but %+v was obtained", status)
+	}
+
+	if reverted, _ = migrator.Down(5); len(reverted) != 1 {
+		t.Errorf("expected 1 migration reverted but %d was obtained", len(reverted))
+	}
+}
+
+func TestMigratorRollback(t *testing.T) {
+	MustConnect()
+	fsys := fstest.MapFS{
+		"0001_create_foo.up.sql": {Data: []byte("create table foo (id integer not null primary key);")},
+		"0002_broken.up.sql":     {Data: []byte("create table bar (id integer); insert into nowhere values (1);")},
+	}
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := NewMigrator(Get(), migrations)
+	applied, err := migrator.Up()
+	if err == nil || len(applied) != 1 {
+		t.Fatalf("expected only the first migration applied but %d was obtained (%v)", len(applied), err)
+	}
+	// bar was created inside the failed transaction
+	var count int
+	Get().Get(&count, "select count(*) from sqlite_master where name = 'bar'")
+	if count != 0 {
+		t.Error("expected the broken migration to be rolled back")
+	}
+}
@@ -0,0 +1 @@
+create table foo (id integer not null primary key, name text);
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/cassiobotaro/60-days-of-go/day15/database"
 )
@@ -9,27 +15,40 @@ import (
 // This example is based on https://www.goinggo.net/2013/07/singleton-design-pattern-in-go.html
 // also https://github.com/mattn/go-sqlite3/blob/master/_example/simple/simple.go
 
+// migrations are embedded in the binary, use -dir to read them from disk
+//
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// Migrations loads the migrations from dir or from the embedded files
+func Migrations(dir string) []database.Migration {
+	var fsys fs.FS
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	} else {
+		fsys, _ = fs.Sub(embedded, "migrations")
+	}
+	migrations, err := database.LoadMigrations(fsys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return migrations
+}
+
 // CreateTable - creates table foo without data
 func CreateTable() {
 	// Get an instance from db, not a connection
 	// instance should be unique
 	db := database.Get()
-	sqlStmt := `
-	create table foo (id integer not null primary key, name text);
-	delete from foo;
-	`
-
-	// get a connection from pool and execute some statement
-
-	_, err := db.Exec(sqlStmt)
+	// the schema is described by the migrations
+	_, err := database.NewMigrator(db, Migrations("")).Up()
 	if err != nil {
-		log.Printf("%q: %s\n", err, sqlStmt)
-		return
+		log.Fatal(err)
 	}
 }
 
 // PopulateTable insert some records in table foo
-func Populate(){
+func PopulateTable() {
 	// Get an instance from db, not a connection
 	// instance should be unique
 	db := database.Get()
@@ -39,13 +58,13 @@ func Populate(){
 		log.Fatal(err)
 	}
 	// prepare the query that should be executed
-	stmt, err := tx.Prepare("insert into foo(idm name) values (?, ?)")
+	stmt, err := tx.Prepare("insert into foo(id, name) values (?, ?)")
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer stmt.Close()
 	//insert 100 records on database
-	for i : 0; i < 100; i++ {
+	for i := 0; i < 100; i++ {
 		_, err = stmt.Exec(i, fmt.Sprintf("Hello World %03d", i))
 		if err != nil {
 			log.Fatal(err)
@@ -59,11 +78,9 @@ func Populate(){
 func ListFoo() {
 	// Get an instance from db, not a connection
 	// instance should be unique
-	db = database.Get()
-	// start a transaction
-	tx, err := db.begin()
+	db := database.Get()
 	// execute a query
-	rows, err := tx.Query("select id, name from foo")
+	rows, err := db.Query("select id, name from foo")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -72,11 +89,11 @@ func ListFoo() {
 	for rows.Next() {
 		var id int
 		var name string
-		err = rows.Scan(&id, name)
+		err = rows.Scan(&id, &name)
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println(idm name)
+		fmt.Println(id, name)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -84,13 +101,75 @@ func ListFoo() {
 	}
 }
 
-func main(){
+// Migrate runs the migrate subcommands: up, down [n] and status
+func Migrate(args []string) {
+	fset := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dsn := fset.String("dsn", "foo.db", "sqlite file path")
+	dir := fset.String("dir", "", "read migrations from this directory instead of the embedded ones")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "usage: migrate [flags] up|down [n]|status")
+		fset.PrintDefaults()
+	}
+	fset.Parse(args)
+	if fset.NArg() == 0 {
+		fset.Usage()
+		os.Exit(2)
+	}
+
+	database.MustConnectTo(*dsn)
+	migrator := database.NewMigrator(database.Get(), Migrations(*dir))
+
+	switch fset.Arg(0) {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		// by default only the last migration is reverted
+		n := 1
+		if fset.NArg() > 1 {
+			var err error
+			if n, err = strconv.Atoi(fset.Arg(1)); err != nil || n < 1 {
+				log.Fatalf("invalid number of migrations: %q", fset.Arg(1))
+			}
+		}
+		reverted, err := migrator.Down(n)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range status {
+			if s.Applied {
+				fmt.Printf("%04d_%s\tapplied at %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", s.Version, s.Name)
+			}
+		}
+	default:
+		fset.Usage()
+		os.Exit(2)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		Migrate(os.Args[2:])
+		return
+	}
 	// Initialize the database
 	database.MustConnect()
 	CreateTable()
 	PopulateTable()
 	ListFoo()
 }
-
-
-